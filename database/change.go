@@ -0,0 +1,88 @@
+package database
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// dataVersion 中文注释: 订阅相关数据(入站、设置、订阅分组、路由方案和模板)的变更计数，
+// 每次写入这些表时递增，供订阅缓存判断是否失效。
+var dataVersion atomic.Int64
+
+// 中文注释: 影响订阅内容的表。client_traffics 每个统计周期都会更新，不计入变更，
+// 由订阅缓存的有效期保证流量信息的时效。
+var watchedTables = map[string]bool{
+	"inbounds":          true,
+	"settings":          true,
+	"sub_groups":        true,
+	"sub_json_profiles": true,
+	"sub_templates":     true,
+}
+
+// 中文注释: 只更新这些列的入站写入(定时流量统计)不视为配置变更。
+var trafficColumns = map[string]bool{
+	"up":       true,
+	"down":     true,
+	"all_time": true,
+	"raw_up":   true,
+	"raw_down": true,
+}
+
+// GetDataVersion 中文注释: 返回当前数据版本，版本变化说明订阅内容可能已经改变。
+func GetDataVersion() int64 {
+	return dataVersion.Load()
+}
+
+// NotifyDataChanged 中文注释: 手动递增数据版本，用于绕过 GORM 的写入场景。
+func NotifyDataChanged() {
+	dataVersion.Add(1)
+}
+
+func registerChangeCallbacks(db *gorm.DB) error {
+	onWrite := func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil {
+			return
+		}
+		if !watchedTables[tx.Statement.Schema.Table] {
+			return
+		}
+		if updates, ok := tx.Statement.Dest.(map[string]any); ok && tx.Statement.Schema.Table == "inbounds" {
+			onlyTraffic := len(updates) > 0
+			for column := range updates {
+				if !trafficColumns[column] {
+					onlyTraffic = false
+					break
+				}
+			}
+			if onlyTraffic {
+				return
+			}
+		}
+		dataVersion.Add(1)
+	}
+	// 中文注释: 原生 SQL 无法可靠解析目标表，除查询外一律视为变更
+	onRaw := func(tx *gorm.DB) {
+		if tx.Error != nil {
+			return
+		}
+		sql := strings.ToUpper(strings.TrimSpace(tx.Statement.SQL.String()))
+		if strings.HasPrefix(sql, "SELECT") || strings.HasPrefix(sql, "PRAGMA") {
+			return
+		}
+		dataVersion.Add(1)
+	}
+
+	callbacks := db.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("x-ui:data_version", onWrite); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("x-ui:data_version", onWrite); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("x-ui:data_version", onWrite); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("x-ui:data_version", onRaw)
+}
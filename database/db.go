@@ -2,6 +2,7 @@ package database
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
@@ -36,6 +37,18 @@ func initModels() error {
 		&model.InboundClientIps{},
 		&xray.ClientTraffic{},
 		&model.HistoryOfSeeders{},
+		&model.SubGroup{},
+		&model.SubJsonProfile{},
+		&model.SubTemplate{},
+		&model.TrafficHourly{},
+		&model.TrafficDaily{},
+		&model.ClientUsageArchive{},
+		&model.UsageAlert{},
+		&model.UsageAlertTemplate{},
+		&model.DeviceBan{},
+		&model.DeviceIpSighting{},
+		&model.DeviceBanLog{},
+		&model.DeviceExemption{},
 		&LinkHistory{},   // 把 LinkHistory 表也迁移
 	}
 	for _, model := range models {
@@ -102,11 +115,57 @@ func runSeeders(isUsersEmpty bool) error {
 			hashSeeder := &model.HistoryOfSeeders{
 				SeederName: "UserPasswordHash",
 			}
-			return db.Create(hashSeeder).Error
+			if err := db.Create(hashSeeder).Error; err != nil {
+				return err
+			}
 		}
 	}
 
-	return nil
+	return migrateTotalSubscription()
+}
+
+// migrateTotalSubscription 中文注释: 将旧版“总订阅ID”迁移为一个显式列出所有入站的订阅分组，
+// 这样旧链接仍然可用，但之后新增的入站不会再被自动暴露。
+func migrateTotalSubscription() error {
+	var seedersHistory []string
+	if err := db.Model(&model.HistoryOfSeeders{}).Pluck("seeder_name", &seedersHistory).Error; err != nil {
+		return err
+	}
+	if slices.Contains(seedersHistory, "TotalSubscriptionToGroup") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var totalIds []string
+		if err := tx.Model(&model.Setting{}).Where("key = ?", "subTotalId").Pluck("value", &totalIds).Error; err != nil {
+			return err
+		}
+		totalId := ""
+		if len(totalIds) > 0 {
+			totalId = totalIds[0]
+		}
+		if totalId != "" {
+			var tags []string
+			if err := tx.Model(&model.Inbound{}).Pluck("tag", &tags).Error; err != nil {
+				return err
+			}
+			inbounds, _ := json.Marshal(tags)
+			group := &model.SubGroup{
+				SubId:    totalId,
+				Title:    "All",
+				Enable:   true,
+				Inbounds: string(inbounds),
+				Clients:  "[]",
+			}
+			if err := tx.Create(group).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("key = ?", "subTotalId").Delete(&model.Setting{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.HistoryOfSeeders{SeederName: "TotalSubscriptionToGroup"}).Error
+	})
 }
 
 func isTableEmpty(tableName string) (bool, error) {
@@ -137,6 +196,9 @@ func InitDB(dbPath string) error {
 	if err != nil {
 		return err
 	}
+	if err := registerChangeCallbacks(db); err != nil {
+		return err
+	}
 
 	if err := initModels(); err != nil {
 		return err
@@ -1,9 +1,11 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"x-ui/util/json_util"
+	"x-ui/util/random"
 	"x-ui/xray"
 )
 
@@ -33,6 +35,9 @@ type Inbound struct {
 	Down        int64                `json:"down" form:"down"`
 	Total       int64                `json:"total" form:"total"`
 	AllTime     int64                `json:"allTime" form:"allTime" gorm:"default:0"`
+	// 中文注释: Up/Down 为按计费规则折算后的流量，RawUp/RawDown 为 Xray 统计的原始流量
+	RawUp       int64                `json:"rawUp" form:"rawUp" gorm:"default:0"`
+	RawDown     int64                `json:"rawDown" form:"rawDown" gorm:"default:0"`
 	Remark      string               `json:"remark" form:"remark"`
 	Enable      bool                 `json:"enable" form:"enable"`
 	ExpiryTime  int64                `json:"expiryTime" form:"expiryTime"`
@@ -41,6 +46,18 @@ type Inbound struct {
 	// gorm:"column:device_limit;default:0" 定义了数据库中的字段名和默认值。
 	DeviceLimit   int                  `json:"deviceLimit" form:"deviceLimit" gorm:"column:device_limit;default:0"`
 
+	// 中文注释: 入站默认的上行/下行限速(KB/s)，客户端未单独设置限速时沿用，0 表示不限速。
+	UpLimit   int `json:"upLimit" form:"upLimit" gorm:"default:0"`
+	DownLimit int `json:"downLimit" form:"downLimit" gorm:"default:0"`
+	// 中文注释: 入站的限速时段([]SpeedWindow 的 JSON)，时段内替代入站的默认限速，为空表示不按时段限速。
+	SpeedSchedule string `json:"speedSchedule" form:"speedSchedule"`
+
+	// 中文注释: 设备超限时的处理策略(DevicePolicy 的 JSON)，为空表示立即封禁。
+	DevicePolicy string `json:"devicePolicy" form:"devicePolicy"`
+
+	// 中文注释: 流量计费规则(AccountingRule 的 JSON)，为空表示原始流量按 1:1 计费。
+	Accounting string `json:"accounting" form:"accounting"`
+
 	ClientStats []xray.ClientTraffic `gorm:"foreignKey:InboundId;references:Id" json:"clientStats" form:"clientStats"`
 
 	// config part
@@ -53,6 +70,40 @@ type Inbound struct {
 	Sniffing       string   `json:"sniffing" form:"sniffing"`
 }
 
+// AccountingRule 中文注释: 入站的流量计费规则。Multiplier 为计费倍率(省略时为 1)，
+// Direction 为 up/down 时只计上行或下行，FreeWindows 内产生的流量不计费。
+type AccountingRule struct {
+	Multiplier  float64      `json:"multiplier"`
+	Direction   string       `json:"direction"`
+	FreeWindows []FreeWindow `json:"freeWindows"`
+}
+
+// FreeWindow 中文注释: 免费时段，Start/End 为面板时区的 HH:MM，End 不大于 Start 时跨越午夜，
+// 两者相同表示全天。Days 为开始时所在的星期(0 为周日)，为空表示每天。
+type FreeWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Days  []int  `json:"days"`
+}
+
+// SpeedWindow 中文注释: 限速时段，时间和星期的含义与 FreeWindow 相同，
+// 时段内使用 Up/Down 作为上行/下行限速(KB/s)，0 表示该方向不限速。
+type SpeedWindow struct {
+	FreeWindow
+	Up   int `json:"up"`
+	Down int `json:"down"`
+}
+
+// DevicePolicy 中文注释: 设备超限时的处理策略。Mode 为 ban(更换凭据封禁，默认)、kickOldest(阻断最早上线的设备)
+// 或 notify(仅通知)；超限持续 Grace 秒后才处理；Strikes 为逐次加重的封禁时长(分钟)，
+// 按 StrikeWindow 小时(0 为 24 小时)内的封禁次数选取，超出部分使用最后一项，为空时封禁到设备数恢复为止。
+type DevicePolicy struct {
+	Mode         string `json:"mode"`
+	Grace        int    `json:"grace"`
+	Strikes      []int  `json:"strikes"`
+	StrikeWindow int    `json:"strikeWindow"`
+}
+
 type OutboundTraffics struct {
 	Id    int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
 	Tag   string `json:"tag" form:"tag" gorm:"unique"`
@@ -61,12 +112,153 @@ type OutboundTraffics struct {
 	Total int64  `json:"total" form:"total" gorm:"default:0"`
 }
 
+// TrafficHourly 中文注释: 按小时聚合的流量增量。Kind 为 client/inbound/outbound，
+// Name 为客户端 email 或入站/出站 tag，Bucket 为时间段起点的毫秒时间戳。
+type TrafficHourly struct {
+	Id     int64  `json:"-" gorm:"primaryKey;autoIncrement"`
+	Kind   string `json:"kind" gorm:"uniqueIndex:idx_traffic_hourly_bucket"`
+	Name   string `json:"name" gorm:"uniqueIndex:idx_traffic_hourly_bucket"`
+	Bucket int64  `json:"bucket" gorm:"uniqueIndex:idx_traffic_hourly_bucket;index"`
+	Up     int64  `json:"up" gorm:"default:0"`
+	Down   int64  `json:"down" gorm:"default:0"`
+}
+
+// TrafficDaily 中文注释: 按天(面板时区)聚合的流量增量，字段含义同 TrafficHourly，保留时间更长。
+type TrafficDaily struct {
+	Id     int64  `json:"-" gorm:"primaryKey;autoIncrement"`
+	Kind   string `json:"kind" gorm:"uniqueIndex:idx_traffic_daily_bucket"`
+	Name   string `json:"name" gorm:"uniqueIndex:idx_traffic_daily_bucket"`
+	Bucket int64  `json:"bucket" gorm:"uniqueIndex:idx_traffic_daily_bucket;index"`
+	Up     int64  `json:"up" gorm:"default:0"`
+	Down   int64  `json:"down" gorm:"default:0"`
+}
+
+// ClientUsageArchive 中文注释: 客户端在一个计费周期内的用量，按重置计划清零流量前写入。
+// PeriodStart 为上次重置时间(0 表示设置计划之前的用量)，PeriodEnd 为本次重置时间，均为毫秒时间戳。
+type ClientUsageArchive struct {
+	Id          int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Email       string `json:"email" gorm:"index"`
+	InboundId   int    `json:"inboundId"`
+	PeriodStart int64  `json:"periodStart"`
+	PeriodEnd   int64  `json:"periodEnd" gorm:"index"`
+	Up          int64  `json:"up"`
+	Down        int64  `json:"down"`
+	RawUp       int64  `json:"rawUp"`
+	RawDown     int64  `json:"rawDown"`
+}
+
+// UsageAlert 中文注释: 已发送的用量提醒。Kind 为 traffic/expiry，Threshold 为百分比或天数，
+// Period 标识计费周期(流量为上次重置时间，到期为到期时间)，同一周期内每个阈值只提醒一次。
+type UsageAlert struct {
+	Id        int64  `json:"id" gorm:"primaryKey;autoIncrement"`
+	Email     string `json:"email" gorm:"uniqueIndex:idx_usage_alert"`
+	Kind      string `json:"kind" gorm:"uniqueIndex:idx_usage_alert"`
+	Threshold int    `json:"threshold" gorm:"uniqueIndex:idx_usage_alert"`
+	Period    int64  `json:"period" gorm:"uniqueIndex:idx_usage_alert"`
+	SentAt    int64  `json:"sentAt"`
+}
+
+// UsageAlertTemplate 中文注释: 管理员自定义的用量提醒消息模板，按语言(同 tgLang)和提醒类型区分，
+// 没有自定义模板时使用内置翻译。
+type UsageAlertTemplate struct {
+	Id      int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Lang    string `json:"lang" form:"lang" gorm:"uniqueIndex:idx_usage_alert_template"`
+	Kind    string `json:"kind" form:"kind" gorm:"uniqueIndex:idx_usage_alert_template"`
+	Content string `json:"content" form:"content"`
+}
+
+// DeviceBan 中文注释: 因设备数超限被封禁的客户端。封禁期间 Xray 中该客户端使用随机凭据，
+// 面板或 Xray 重启后依然保持封禁，直到设备数恢复、封禁到期或管理员手动解封后删除记录。
+type DeviceBan struct {
+	Id          int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Email       string `json:"email" gorm:"unique"`
+	InboundId   int    `json:"inboundId"`
+	DeviceLimit int    `json:"deviceLimit"`
+	ActiveIps   int    `json:"activeIps"`
+	BannedAt    int64  `json:"bannedAt"`
+	// 中文注释: 按封禁次数加重的封禁到期时间(毫秒)，0 表示封禁到设备数恢复为止
+	Until int64 `json:"until"`
+}
+
+// DeviceIpSighting 中文注释: 客户端最近出现的 IP 及最后活跃时间(毫秒)，用于统计在线设备数。
+type DeviceIpSighting struct {
+	Id       int64  `json:"-" gorm:"primaryKey;autoIncrement"`
+	Email    string `json:"email" gorm:"uniqueIndex:idx_device_ip_sighting"`
+	Ip        string `json:"ip" gorm:"uniqueIndex:idx_device_ip_sighting"`
+	FirstSeen int64  `json:"firstSeen"`
+	LastSeen  int64  `json:"lastSeen" gorm:"index"`
+}
+
+// DeviceBanLog 中文注释: 设备限制的封禁、解封和豁免历史。
+type DeviceBanLog struct {
+	Id          int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Email       string `json:"email" gorm:"index"`
+	InboundId   int    `json:"inboundId"`
+	Action      string `json:"action"`
+	Reason      string `json:"reason"`
+	DeviceLimit int    `json:"deviceLimit"`
+	ActiveIps   int    `json:"activeIps"`
+	CreatedAt   int64  `json:"createdAt" gorm:"index"`
+}
+
+// DeviceExemption 中文注释: 在 Until(毫秒)之前不受设备数限制的客户端。
+type DeviceExemption struct {
+	Id    int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Email string `json:"email" gorm:"unique"`
+	Until int64  `json:"until"`
+}
+
 type InboundClientIps struct {
 	Id          int    `json:"id" gorm:"primaryKey;autoIncrement"`
 	ClientEmail string `json:"clientEmail" form:"clientEmail" gorm:"unique"`
 	Ips         string `json:"ips" form:"ips"`
 }
 
+// SubGroup 中文注释: 订阅分组，由显式选择的入站(tag)和客户端(email)组成，拥有独立的订阅ID。
+// Inbounds 和 Clients 均为 JSON 数组字符串；AllowedIPs 为逗号分隔的 IP/CIDR 列表，为空表示不限制。
+type SubGroup struct {
+	Id             int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	SubId          string `json:"subId" form:"subId" gorm:"unique"`
+	Title          string `json:"title" form:"title"`
+	Enable         bool   `json:"enable" form:"enable" gorm:"default:true"`
+	UpdateInterval int    `json:"updateInterval" form:"updateInterval" gorm:"default:0"`
+	RemarkModel    string `json:"remarkModel" form:"remarkModel"`
+	Inbounds       string `json:"inbounds" form:"inbounds"`
+	Clients        string `json:"clients" form:"clients"`
+	AllowedIPs     string `json:"allowedIps" form:"allowedIps"`
+	ExpiryTime     int64  `json:"expiryTime" form:"expiryTime" gorm:"default:0"`
+	ProfileId      int    `json:"profileId" form:"profileId" gorm:"default:0"`
+	Comment        string `json:"comment" form:"comment"`
+}
+
+// SubJsonProfile 中文注释: JSON 订阅的客户端路由方案（如“伊朗直连”、“全局代理”、“关闭分片”），
+// 可分配给单个客户端或订阅分组。各 JSON 字段为空时沿用全局订阅设置。
+type SubJsonProfile struct {
+	Id              int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name            string `json:"name" form:"name" gorm:"unique"`
+	Rules           string `json:"rules" form:"rules"`
+	ReplaceRules    bool   `json:"replaceRules" form:"replaceRules"`
+	Dns             string `json:"dns" form:"dns"`
+	Fragment        string `json:"fragment" form:"fragment"`
+	Noises          string `json:"noises" form:"noises"`
+	DisableFragment bool   `json:"disableFragment" form:"disableFragment"`
+	Mux             string `json:"mux" form:"mux"`
+	DisableMux      bool   `json:"disableMux" form:"disableMux"`
+	Comment         string `json:"comment" form:"comment"`
+}
+
+// SubTemplate 中文注释: 管理员自定义的订阅输出格式，内容为 Go text/template 模板，
+// 通过订阅地址后缀 Path 访问，并以 ContentType 返回渲染结果。
+type SubTemplate struct {
+	Id          int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name        string `json:"name" form:"name" gorm:"unique"`
+	Path        string `json:"path" form:"path" gorm:"unique"`
+	ContentType string `json:"contentType" form:"contentType"`
+	Content     string `json:"content" form:"content"`
+	Enable      bool   `json:"enable" form:"enable"`
+	Comment     string `json:"comment" form:"comment"`
+}
+
 type HistoryOfSeeders struct {
 	Id         int    `json:"id" gorm:"primaryKey;autoIncrement"`
 	SeederName string `json:"seederName"`
@@ -77,17 +269,127 @@ func (i *Inbound) GenXrayInboundConfig() *xray.InboundConfig {
 	if listen != "" {
 		listen = fmt.Sprintf("\"%v\"", listen)
 	}
+	settings := GenProtocolSettings(i.Protocol, i.Settings)
 	return &xray.InboundConfig{
 		Listen:         json_util.RawMessage(listen),
 		Port:           i.Port,
 		Protocol:       string(i.Protocol),
-		Settings:       json_util.RawMessage(i.Settings),
+		Settings:       json_util.RawMessage(settings),
 		StreamSettings: json_util.RawMessage(i.StreamSettings),
 		Tag:            i.Tag,
 		Sniffing:       json_util.RawMessage(i.Sniffing),
 	}
 }
 
+// GenProtocolSettings 中文注释: 将面板中统一以 clients 保存的账号转换为各协议在 Xray 中的原生格式。
+func GenProtocolSettings(protocol Protocol, settings string) string {
+	switch protocol {
+	case WireGuard:
+		return GenWireguardSettings(settings)
+	case Socks, HTTP:
+		return GenAccountSettings(protocol, settings)
+	}
+	return settings
+}
+
+// GenAccountSettings 中文注释: SOCKS/HTTP 入站的账号在面板中以 clients 保存(email 即用户名、password 即密码)，
+// 生成 Xray 配置时转换为 accounts。Xray 以用户名作为统计用的 email，因此可以按账号统计流量。
+func GenAccountSettings(protocol Protocol, settings string) string {
+	var parsed map[string]any
+	if err := json.Unmarshal([]byte(settings), &parsed); err != nil {
+		return settings
+	}
+	clientsRaw, ok := parsed["clients"]
+	if !ok {
+		return settings
+	}
+	clients, _ := clientsRaw.([]any)
+	accounts := make([]any, 0, len(clients))
+	for _, clientRaw := range clients {
+		c, ok := clientRaw.(map[string]any)
+		if !ok {
+			continue
+		}
+		if enable, ok := c["enable"].(bool); ok && !enable {
+			continue
+		}
+		email, _ := c["email"].(string)
+		password, _ := c["password"].(string)
+		if email == "" {
+			continue
+		}
+		accounts = append(accounts, map[string]any{
+			"user": email,
+			"pass": password,
+		})
+	}
+	if len(accounts) == 0 {
+		// 中文注释: 账号列表为空时 Xray 会允许匿名访问，因此放入一个随机账号以保持拒绝状态
+		accounts = append(accounts, map[string]any{
+			"user": random.Seq(16),
+			"pass": random.Seq(16),
+		})
+	}
+	delete(parsed, "clients")
+	parsed["accounts"] = accounts
+	if protocol == Socks {
+		parsed["auth"] = "password"
+	}
+	result, err := json.Marshal(parsed)
+	if err != nil {
+		return settings
+	}
+	return string(result)
+}
+
+// GenWireguardSettings 中文注释: WireGuard 入站在面板中以 clients 保存对端，
+// 生成 Xray 配置时转换为 peers，并跳过被禁用或缺少公钥的客户端。
+func GenWireguardSettings(settings string) string {
+	var parsed map[string]any
+	if err := json.Unmarshal([]byte(settings), &parsed); err != nil {
+		return settings
+	}
+	clientsRaw, ok := parsed["clients"]
+	if !ok {
+		return settings
+	}
+	clients, _ := clientsRaw.([]any)
+	peers := make([]any, 0, len(clients))
+	for _, clientRaw := range clients {
+		c, ok := clientRaw.(map[string]any)
+		if !ok {
+			continue
+		}
+		if enable, ok := c["enable"].(bool); ok && !enable {
+			continue
+		}
+		publicKey, _ := c["publicKey"].(string)
+		if publicKey == "" {
+			continue
+		}
+		peer := map[string]any{
+			"publicKey":  publicKey,
+			"allowedIPs": c["allowedIPs"],
+		}
+		if psk, _ := c["preSharedKey"].(string); psk != "" {
+			peer["preSharedKey"] = psk
+		}
+		if keepAlive, ok := c["keepAlive"].(float64); ok && keepAlive > 0 {
+			peer["keepAlive"] = keepAlive
+		}
+		peers = append(peers, peer)
+	}
+	delete(parsed, "clients")
+	// 中文注释: clientDns 只用于生成客户端配置，Xray 不需要
+	delete(parsed, "clientDns")
+	parsed["peers"] = peers
+	result, err := json.Marshal(parsed)
+	if err != nil {
+		return settings
+	}
+	return string(result)
+}
+
 type Setting struct {
 	Id    int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
 	Key   string `json:"key" form:"key"`
@@ -112,6 +414,39 @@ type Client struct {
 	SubID      string `json:"subId" form:"subId"`
 	Comment    string `json:"comment" form:"comment"`
 	Reset      int    `json:"reset" form:"reset"`
+
+	// 中文注释: 按日历的流量重置计划，与到期时间无关，为空表示不重置。
+	// 格式为 monthly:<1-31>、weekly:<0-6>(0 为周日) 或 cron:<标准 cron 表达式>，按面板时区计算。
+	ResetSchedule string `json:"resetSchedule" form:"resetSchedule"`
+
+	// 中文注释: 上行/下行限速(KB/s)，大于 0 时优先于 SpeedLimit 和入站的默认限速。
+	UpLimit   int `json:"upLimit,omitempty" form:"upLimit"`
+	DownLimit int `json:"downLimit,omitempty" form:"downLimit"`
+	// 中文注释: 限速时段，处于某个时段时以该时段的限速替代上面的限速和入站设置，时段外恢复。
+	SpeedSchedule []SpeedWindow `json:"speedSchedule,omitempty" form:"speedSchedule"`
+	// 中文注释: 流量用尽后的处理方式：disable(默认，直接禁用)、throttle(限速到 ThrottleSpeed)
+	// 或 throttleThenDisable(限速，再用完 ThrottleAllowance 字节后禁用)。
+	QuotaAction       string `json:"quotaAction,omitempty" form:"quotaAction"`
+	ThrottleSpeed     int    `json:"throttleSpeed,omitempty" form:"throttleSpeed"`
+	ThrottleAllowance int64  `json:"throttleAllowance,omitempty" form:"throttleAllowance"`
+
+	// 中文注释: 设备限制，大于 0 时覆盖入站的 DeviceLimit，0 表示沿用入站设置。
+	DeviceLimit int `json:"deviceLimit,omitempty" form:"deviceLimit"`
+	// 中文注释: 设备超限处理方式，覆盖入站策略中的 Mode，为空表示沿用入站策略。
+	DeviceMode string `json:"deviceMode,omitempty" form:"deviceMode"`
+	// 中文注释: 信任的 IP 或 CIDR，来自这些地址的连接不计入设备数。
+	TrustedIPs []string `json:"trustedIps,omitempty" form:"trustedIps"`
+
+	// 中文注释: JSON 订阅使用的路由方案ID，0 表示沿用订阅分组或全局设置。
+	SubProfileId int `json:"subProfileId" form:"subProfileId"`
+
+	// 中文注释: WireGuard 对端字段，仅 wireguard 入站的客户端使用。
+	PrivateKey   string   `json:"privateKey,omitempty"`
+	PublicKey    string   `json:"publicKey,omitempty"`
+	PreSharedKey string   `json:"preSharedKey,omitempty"`
+	AllowedIPs   []string `json:"allowedIPs,omitempty"`
+	KeepAlive    int      `json:"keepAlive,omitempty"`
+
 	CreatedAt  int64  `json:"created_at,omitempty"`
 	UpdatedAt  int64  `json:"updated_at,omitempty"`
 }
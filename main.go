@@ -460,6 +460,20 @@ func migrateDb() {
 	fmt.Println("Migration done! ------------>>迁移完成！")
 }
 
+// cleanupFirewall 中文注释: 卸载面板时删除内置 IP 限制防火墙创建的表、集合和规则
+func cleanupFirewall() {
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		log.Fatal(err)
+	}
+	ipFirewallService := service.IpFirewallService{}
+	if err := ipFirewallService.Cleanup(); err != nil {
+		fmt.Println("Clean up IP limit firewall failed:", err)
+		return
+	}
+	fmt.Println("IP limit firewall cleaned up")
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		runWebServer()
@@ -513,6 +527,7 @@ func main() {
 		fmt.Println("    run            run web panel")
 		fmt.Println("    migrate        migrate form other/old x-ui")
 		fmt.Println("    setting        set settings")
+		fmt.Println("    firewall-cleanup  remove IP limit firewall tables and rules")
 	}
 
 	flag.Parse()
@@ -568,6 +583,8 @@ func main() {
 		} else {
 			updateCert(webCertFile, webKeyFile)
 		}
+	case "firewall-cleanup":
+		cleanupFirewall()
 	default:
 		fmt.Println("Invalid subcommands ----->>无效命令")
 		fmt.Println()
@@ -0,0 +1,142 @@
+package sub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"x-ui/database"
+)
+
+const (
+	// subCacheTTL 中文注释: 缓存的最长有效期，用于刷新流量用量、剩余天数等随时间变化的信息
+	subCacheTTL = time.Minute
+	// subCacheLimit 中文注释: 缓存条目上限，超过时清理失效条目
+	subCacheLimit = 4096
+)
+
+// subCacheEntry 中文注释: 一次渲染好的订阅内容及其响应头。
+type subCacheEntry struct {
+	body      string
+	header    string
+	etag      string
+	version   int64
+	createdAt time.Time
+}
+
+func (e *subCacheEntry) valid(version int64) bool {
+	return e.version == version && time.Since(e.createdAt) < subCacheTTL
+}
+
+// subCache 中文注释: 按订阅ID、格式和请求主机缓存渲染结果。
+// 入站、客户端、设置、订阅分组或路由方案发生写入时数据版本递增，旧条目随之失效。
+type subCache struct {
+	mu       sync.RWMutex
+	entries  map[string]*subCacheEntry
+	inflight map[string]*subRender
+}
+
+// subRender 中文注释: 正在进行的一次渲染，同一缓存键的其他请求等待 done 后共用结果
+type subRender struct {
+	done  chan struct{}
+	entry *subCacheEntry
+	err   error
+}
+
+func newSubCache() *subCache {
+	return &subCache{
+		entries:  make(map[string]*subCacheEntry),
+		inflight: make(map[string]*subRender),
+	}
+}
+
+// Get 中文注释: 返回有效的缓存条目，否则调用 render 重新生成。
+// 同一缓存键的并发请求只会渲染一次，不同订阅之间的渲染互不等待。
+func (c *subCache) Get(format string, subId string, host string, render func() (string, string, error)) (*subCacheEntry, error) {
+	key := format + "|" + subId + "|" + host
+	if entry := c.lookup(key); entry != nil {
+		return entry, nil
+	}
+
+	c.mu.Lock()
+	if r, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-r.done
+		return r.entry, r.err
+	}
+	// 中文注释: 渲染发生 panic 时等待中的请求得到该错误，而不是空结果
+	r := &subRender{done: make(chan struct{}), err: errors.New("subscription render failed")}
+	c.inflight[key] = r
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		close(r.done)
+	}()
+	r.entry, r.err = c.render(key, render)
+	return r.entry, r.err
+}
+
+// render 中文注释: 渲染并写入缓存，渲染失败时不缓存
+func (c *subCache) render(key string, render func() (string, string, error)) (*subCacheEntry, error) {
+	// 中文注释: 先记录版本再渲染，渲染期间发生的变更会让本次结果在下次请求时失效
+	version := database.GetDataVersion()
+	body, header, err := render()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(header + "\n" + body))
+	entry := &subCacheEntry{
+		body:      body,
+		header:    header,
+		etag:      `"` + hex.EncodeToString(sum[:16]) + `"`,
+		version:   version,
+		createdAt: time.Now(),
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= subCacheLimit {
+		c.purge(version)
+	}
+	c.entries[key] = entry
+	c.mu.Unlock()
+	return entry, nil
+}
+
+func (c *subCache) lookup(key string) *subCacheEntry {
+	version := database.GetDataVersion()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if entry, ok := c.entries[key]; ok && entry.valid(version) {
+		return entry
+	}
+	return nil
+}
+
+// purge 中文注释: 清理失效条目；仍然超出上限时清空缓存。调用方需持有写锁。
+func (c *subCache) purge(version int64) {
+	for key, entry := range c.entries {
+		if !entry.valid(version) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) >= subCacheLimit {
+		c.entries = make(map[string]*subCacheEntry)
+	}
+}
+
+// etagMatches 中文注释: 判断 If-None-Match 请求头是否包含当前 ETag(忽略弱校验前缀)。
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
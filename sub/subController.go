@@ -3,8 +3,12 @@ package sub
 import (
 	"encoding/base64"
 	"net"
+	"strconv"
 	"strings"
 
+	"x-ui/logger"
+	"x-ui/util/common"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -17,6 +21,7 @@ type SUBController struct {
 
 	subService     *SubService
 	subJsonService *SubJsonService
+	cache          *subCache
 }
 
 func NewSUBController(
@@ -43,6 +48,7 @@ func NewSUBController(
 
 		subService:     sub,
 		subJsonService: NewSubJsonService(jsonFragment, jsonNoise, jsonMux, jsonRules, sub),
+		cache:          newSubCache(),
 	}
 	a.initRouter(g)
 	return a
@@ -53,6 +59,7 @@ func (a *SUBController) initRouter(g *gin.RouterGroup) {
 	gJson := g.Group(a.subJsonPath)
 
 	gLink.GET(":subid", a.subs)
+	gLink.GET(":subid/:format", a.subTemplate)
 
 	gJson.GET(":subid", a.subJsons)
 }
@@ -73,25 +80,32 @@ func (a *SUBController) subs(c *gin.Context) {
 			host = c.Request.Host
 		}
 	}
-	subs, header, err := a.subService.GetSubs(subId, host)
-	if err != nil || len(subs) == 0 {
-		c.String(400, "Error!")
-	} else {
+	title, interval, ok := a.profileInfo(c, subId)
+	if !ok {
+		c.String(403, "Forbidden!")
+		return
+	}
+	entry, err := a.cache.Get("links", subId, host, func() (string, string, error) {
+		subs, header, err := a.subService.GetSubs(subId, host)
+		if err != nil {
+			return "", "", err
+		}
+		if len(subs) == 0 {
+			return "", "", common.NewError("No links found with ", subId)
+		}
 		result := ""
 		for _, sub := range subs {
 			result += sub + "\n"
 		}
-
-		// Add headers
-		c.Writer.Header().Set("Subscription-Userinfo", header)
-		c.Writer.Header().Set("Profile-Update-Interval", a.updateInterval)
-		c.Writer.Header().Set("Profile-Title", "base64:"+base64.StdEncoding.EncodeToString([]byte(a.subTitle)))
-
 		if a.subEncrypt {
-			c.String(200, base64.StdEncoding.EncodeToString([]byte(result)))
-		} else {
-			c.String(200, result)
+			result = base64.StdEncoding.EncodeToString([]byte(result))
 		}
+		return result, header, nil
+	})
+	if err != nil {
+		c.String(400, "Error!")
+	} else {
+		a.writeSub(c, entry, title, interval, "text/plain; charset=utf-8")
 	}
 }
 
@@ -111,18 +125,100 @@ func (a *SUBController) subJsons(c *gin.Context) {
 			host = c.Request.Host
 		}
 	}
-	jsonSub, header, err := a.subJsonService.GetJson(subId, host)
-	if err != nil || len(jsonSub) == 0 {
+	title, interval, ok := a.profileInfo(c, subId)
+	if !ok {
+		c.String(403, "Forbidden!")
+		return
+	}
+	entry, err := a.cache.Get("json", subId, host, func() (string, string, error) {
+		jsonSub, header, err := a.subJsonService.GetJson(subId, host)
+		if err != nil {
+			return "", "", err
+		}
+		if len(jsonSub) == 0 {
+			return "", "", common.NewError("No configs found with ", subId)
+		}
+		return jsonSub, header, nil
+	})
+	if err != nil {
+		c.String(400, "Error!")
+	} else {
+		a.writeSub(c, entry, title, interval, "text/plain; charset=utf-8")
+	}
+}
+
+// subTemplate 中文注释: 使用管理员自定义的模板输出订阅，模板由地址后缀 format 选择。
+func (a *SUBController) subTemplate(c *gin.Context) {
+	subId := c.Param("subid")
+	tpl, err := a.subService.subTemplateService.GetSubTemplateByPath(c.Param("format"))
+	if err != nil || tpl == nil {
+		c.String(404, "Not Found!")
+		return
+	}
+	var host string
+	if h, err := getHostFromXFH(c.GetHeader("X-Forwarded-Host")); err == nil {
+		host = h
+	}
+	if host == "" {
+		host = c.GetHeader("X-Real-IP")
+	}
+	if host == "" {
+		var err error
+		host, _, err = net.SplitHostPort(c.Request.Host)
+		if err != nil {
+			host = c.Request.Host
+		}
+	}
+	title, interval, ok := a.profileInfo(c, subId)
+	if !ok {
+		c.String(403, "Forbidden!")
+		return
+	}
+	entry, err := a.cache.Get("template:"+tpl.Path, subId, host, func() (string, string, error) {
+		return a.subService.GetTemplateSub(tpl, subId, host, title)
+	})
+	if err != nil {
+		logger.Warning("SubController - template", tpl.Path, "failed:", err)
 		c.String(400, "Error!")
 	} else {
+		a.writeSub(c, entry, title, interval, a.subService.subTemplateService.GetContentType(tpl))
+	}
+}
 
-		// Add headers
-		c.Writer.Header().Set("Subscription-Userinfo", header)
-		c.Writer.Header().Set("Profile-Update-Interval", a.updateInterval)
-		c.Writer.Header().Set("Profile-Title", "base64:"+base64.StdEncoding.EncodeToString([]byte(a.subTitle)))
+// writeSub 中文注释: 写入订阅响应头和内容。客户端携带的 If-None-Match 与当前 ETag 一致时返回 304。
+func (a *SUBController) writeSub(c *gin.Context, entry *subCacheEntry, title string, interval string, contentType string) {
+	// Add headers
+	c.Writer.Header().Set("Subscription-Userinfo", entry.header)
+	c.Writer.Header().Set("Profile-Update-Interval", interval)
+	c.Writer.Header().Set("Profile-Title", "base64:"+base64.StdEncoding.EncodeToString([]byte(title)))
+	c.Writer.Header().Set("ETag", entry.etag)
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+
+	if etagMatches(c.GetHeader("If-None-Match"), entry.etag) {
+		c.Status(304)
+		return
+	}
+	c.Data(200, contentType, []byte(entry.body))
+}
 
-		c.String(200, jsonSub)
+// profileInfo 中文注释: 返回订阅的标题和更新间隔。订阅分组可以覆盖全局设置；
+// 分组被禁用、已过期或来源 IP 不在允许列表中时返回 ok=false。
+func (a *SUBController) profileInfo(c *gin.Context, subId string) (title string, interval string, ok bool) {
+	title, interval = a.subTitle, a.updateInterval
+	group, err := a.subService.GetSubGroup(subId)
+	if err != nil || group == nil {
+		return title, interval, true
+	}
+	if !a.subService.IsAccessible(group, c.ClientIP()) {
+		return "", "", false
+	}
+	if group.Title != "" {
+		title = group.Title
+	}
+	if group.UpdateInterval > 0 {
+		interval = strconv.Itoa(group.UpdateInterval)
 	}
+	return title, interval, true
 }
 
 func getHostFromXFH(s string) (string, error) {
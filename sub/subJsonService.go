@@ -4,14 +4,14 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"net"
 	"strings"
 
 	"x-ui/database/model"
-	"x-ui/logger"
+	"x-ui/util/crypto"
 	"x-ui/util/json_util"
 	"x-ui/util/random"
 	"x-ui/web/service"
-	"x-ui/xray"
 )
 
 //go:embed default.json
@@ -23,8 +23,10 @@ type SubJsonService struct {
 	fragment         string
 	noises           string
 	mux              string
+	rules            string
 
 	inboundService service.InboundService
+	profileService service.SubJsonProfileService
 	SubService     *SubService
 }
 
@@ -63,84 +65,107 @@ func NewSubJsonService(fragment string, noises string, mux string, rules string,
 		fragment:         fragment,
 		noises:           noises,
 		mux:              mux,
+		rules:            rules,
 		SubService:       subService,
 	}
 }
 
-func (s *SubJsonService) GetJson(subId string, host string) (string, string, error) {
-	var inbounds []*model.Inbound
-	var err error
-	
-	// 检查是否为总订阅ID
-	if s.SubService.isTotalSubscription(subId) {
-		inbounds, err = s.SubService.getAllInbounds()
-	} else {
-		inbounds, err = s.SubService.getInboundsBySubId(subId)
-	}
-	
-	if err != nil || len(inbounds) == 0 {
-		return "", "", err
+// withProfile 中文注释: 以全局 JSON 订阅设置为基础合并路由方案的规则、DNS、分片和多路复用设置，
+// 返回仅用于本次生成的服务副本。profile 为 nil 时直接返回全局配置。
+func (s *SubJsonService) withProfile(profile *model.SubJsonProfile) *SubJsonService {
+	if profile == nil {
+		return s
 	}
 
-	var header string
-	var traffic xray.ClientTraffic
-	var clientTraffics []xray.ClientTraffic
-	var configArray []json_util.RawMessage
+	rules := s.rules
+	if profile.ReplaceRules {
+		rules = profile.Rules
+	} else if profile.Rules != "" {
+		rules = mergeRules(profile.Rules, s.rules)
+	}
 
-	// Prepare Inbounds
-	for _, inbound := range inbounds {
-		clients, err := s.inboundService.GetClients(inbound)
-		if err != nil {
-			logger.Error("SubJsonService - GetClients: Unable to get clients from inbound")
-		}
-		if clients == nil {
-			continue
+	fragment, noises := s.fragment, s.noises
+	if profile.DisableFragment {
+		fragment, noises = "", ""
+	} else {
+		if profile.Fragment != "" {
+			fragment = profile.Fragment
 		}
-		if len(inbound.Listen) > 0 && inbound.Listen[0] == '@' {
-			listen, port, streamSettings, err := s.SubService.getFallbackMaster(inbound.Listen, inbound.StreamSettings)
-			if err == nil {
-				inbound.Listen = listen
-				inbound.Port = port
-				inbound.StreamSettings = streamSettings
-			}
+		if profile.Noises != "" {
+			noises = profile.Noises
 		}
+	}
 
-		for _, client := range clients {
-			// 如果是总订阅，包含所有启用的客户端
-			// 如果是普通订阅，只包含匹配 subId 的客户端
-			if client.Enable && (s.SubService.isTotalSubscription(subId) || client.SubID == subId) {
-				clientTraffics = append(clientTraffics, s.SubService.getClientTraffics(inbound.ClientStats, client.Email))
-				newConfigs := s.getConfig(inbound, client, host)
-				configArray = append(configArray, newConfigs...)
-			}
+	mux := s.mux
+	if profile.DisableMux {
+		mux = ""
+	} else if profile.Mux != "" {
+		mux = profile.Mux
+	}
+
+	result := NewSubJsonService(fragment, noises, mux, rules, s.SubService)
+	if profile.Dns != "" {
+		var dns map[string]any
+		if err := json.Unmarshal([]byte(profile.Dns), &dns); err == nil {
+			result.configJson["dns"] = dns
 		}
 	}
+	return result
+}
 
-	if len(configArray) == 0 {
-		return "", "", nil
+// getProfileService 中文注释: 按客户端 > 订阅分组 > 全局 的优先级选择路由方案，同一方案只构建一次。
+func (s *SubJsonService) getProfileService(client model.Client, group *model.SubGroup, profiles map[int]*model.SubJsonProfile, cache map[int]*SubJsonService) *SubJsonService {
+	profileId := client.SubProfileId
+	if _, ok := profiles[profileId]; !ok && group != nil {
+		profileId = group.ProfileId
 	}
+	profile, ok := profiles[profileId]
+	if !ok {
+		return s
+	}
+	if cached, ok := cache[profileId]; ok {
+		return cached
+	}
+	cache[profileId] = s.withProfile(profile)
+	return cache[profileId]
+}
 
-	// Prepare statistics
-	for index, clientTraffic := range clientTraffics {
-		if index == 0 {
-			traffic.Up = clientTraffic.Up
-			traffic.Down = clientTraffic.Down
-			traffic.Total = clientTraffic.Total
-			if clientTraffic.ExpiryTime > 0 {
-				traffic.ExpiryTime = clientTraffic.ExpiryTime
-			}
-		} else {
-			traffic.Up += clientTraffic.Up
-			traffic.Down += clientTraffic.Down
-			if traffic.Total == 0 || clientTraffic.Total == 0 {
-				traffic.Total = 0
-			} else {
-				traffic.Total += clientTraffic.Total
-			}
-			if clientTraffic.ExpiryTime != traffic.ExpiryTime {
-				traffic.ExpiryTime = 0
-			}
-		}
+func mergeRules(first string, second string) string {
+	var firstRules, secondRules []any
+	json.Unmarshal([]byte(first), &firstRules)
+	json.Unmarshal([]byte(second), &secondRules)
+	merged, _ := json.Marshal(append(firstRules, secondRules...))
+	return string(merged)
+}
+
+func (s *SubJsonService) GetJson(subId string, host string) (string, string, error) {
+	profiles, err := s.profileService.GetProfileMap()
+	if err != nil {
+		return "", "", err
+	}
+	profileServices := make(map[int]*SubJsonService)
+
+	// 中文注释: 使用本次请求的 SubService 副本，路由方案生成的服务也基于该副本
+	sub, group, err := s.SubService.forRequest(subId, host)
+	if err != nil {
+		return "", "", err
+	}
+	r := *s
+	r.SubService = sub
+
+	var configArray []json_util.RawMessage
+	traffic, err := sub.walkClients(subId, group, func(inbound *model.Inbound, client model.Client) {
+		newConfigs := r.getProfileService(client, group, profiles, profileServices).getConfig(inbound, client, host)
+		configArray = append(configArray, withSpeedLimit(newConfigs, s.inboundService.CurrentSpeedLimit(inbound, &client))...)
+	}, func(remark string) {
+		configArray = append(configArray, s.getPlaceholderConfig(remark)...)
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(configArray) == 0 {
+		return "", "", nil
 	}
 
 	// Combile outbounds
@@ -151,11 +176,17 @@ func (s *SubJsonService) GetJson(subId string, host string) (string, string, err
 		finalJson, _ = json.MarshalIndent(configArray, "", "  ")
 	}
 
-	header = fmt.Sprintf("upload=%d; download=%d; total=%d; expire=%d", traffic.Up, traffic.Down, traffic.Total, traffic.ExpiryTime/1000)
-	return string(finalJson), header, nil
+	return string(finalJson), formatUserinfo(traffic), nil
 }
 
 func (s *SubJsonService) getConfig(inbound *model.Inbound, client model.Client, host string) []json_util.RawMessage {
+	switch inbound.Protocol {
+	case model.WireGuard:
+		return s.getWireguardConfig(inbound, client, host)
+	case model.Socks, model.HTTP:
+		return s.getAccountConfig(inbound, client, host)
+	}
+
 	var newJsonArray []json_util.RawMessage
 	stream := s.streamData(inbound.StreamSettings)
 
@@ -222,6 +253,131 @@ func (s *SubJsonService) getConfig(inbound *model.Inbound, client model.Client,
 	return newJsonArray
 }
 
+// withSpeedLimit 中文注释: 在配置中附带客户端实际生效的上下行限速(KB/s)，供客户端展示，不限速时不添加。
+func withSpeedLimit(configs []json_util.RawMessage, limit service.SpeedLimit) []json_util.RawMessage {
+	if limit.IsZero() {
+		return configs
+	}
+	for i, config := range configs {
+		var configJson map[string]any
+		if err := json.Unmarshal(config, &configJson); err != nil {
+			continue
+		}
+		configJson["speedLimit"] = limit
+		if newConfig, err := json.MarshalIndent(configJson, "", "  "); err == nil {
+			configs[i] = newConfig
+		}
+	}
+	return configs
+}
+
+// getWireguardConfig 中文注释: WireGuard 没有传输层设置，直接生成 wireguard 出站。
+func (s *SubJsonService) getWireguardConfig(inbound *model.Inbound, client model.Client, host string) []json_util.RawMessage {
+	var settings map[string]any
+	json.Unmarshal([]byte(inbound.Settings), &settings)
+	secretKey, _ := settings["secretKey"].(string)
+	serverPublicKey, err := crypto.GetWireguardPublicKey(secretKey)
+	if err != nil || client.PrivateKey == "" {
+		return nil
+	}
+
+	address := host
+	if inbound.Listen != "" && inbound.Listen[0] != '@' && inbound.Listen != "0.0.0.0" && inbound.Listen != "::" && inbound.Listen != "::0" {
+		address = inbound.Listen
+	}
+	peer := map[string]any{
+		"publicKey":  serverPublicKey,
+		"endpoint":   net.JoinHostPort(address, fmt.Sprint(inbound.Port)),
+		"allowedIPs": []string{"0.0.0.0/0", "::/0"},
+	}
+	if client.PreSharedKey != "" {
+		peer["preSharedKey"] = client.PreSharedKey
+	}
+	if client.KeepAlive > 0 {
+		peer["keepAlive"] = client.KeepAlive
+	}
+	wgSettings := map[string]any{
+		"secretKey": client.PrivateKey,
+		"address":   client.AllowedIPs,
+		"peers":     []any{peer},
+	}
+	if mtu, ok := settings["mtu"].(float64); ok && mtu > 0 {
+		wgSettings["mtu"] = int(mtu)
+	}
+	outbound, _ := json.MarshalIndent(map[string]any{
+		"protocol": "wireguard",
+		"tag":      "proxy",
+		"settings": wgSettings,
+	}, "", "  ")
+	return s.genSingleConfig(outbound, s.SubService.genRemark(inbound, client.Email, ""))
+}
+
+// getAccountConfig 中文注释: 为 SOCKS/HTTP 账号生成对应的 socks/http 出站，email 即用户名。
+func (s *SubJsonService) getAccountConfig(inbound *model.Inbound, client model.Client, host string) []json_util.RawMessage {
+	address := host
+	if inbound.Listen != "" && inbound.Listen[0] != '@' && inbound.Listen != "0.0.0.0" && inbound.Listen != "::" && inbound.Listen != "::0" {
+		address = inbound.Listen
+	}
+	outbound, _ := json.MarshalIndent(map[string]any{
+		"protocol": string(inbound.Protocol),
+		"tag":      "proxy",
+		"settings": map[string]any{
+			"servers": []any{
+				map[string]any{
+					"address": address,
+					"port":    inbound.Port,
+					"users": []any{
+						map[string]any{
+							"user":  client.Email,
+							"pass":  client.Password,
+							"level": 8,
+						},
+					},
+				},
+			},
+		},
+	}, "", "  ")
+	return s.genSingleConfig(outbound, s.SubService.genRemark(inbound, client.Email, ""))
+}
+
+// genSingleConfig 中文注释: 用给定的代理出站和默认出站组装一份完整的客户端配置。
+func (s *SubJsonService) genSingleConfig(outbound json_util.RawMessage, remark string) []json_util.RawMessage {
+	newOutbounds := []json_util.RawMessage{outbound}
+	newOutbounds = append(newOutbounds, s.defaultOutbounds...)
+	newConfigJson := make(map[string]any)
+	for key, value := range s.configJson {
+		newConfigJson[key] = value
+	}
+	newConfigJson["outbounds"] = newOutbounds
+	newConfigJson["remarks"] = remark
+
+	newConfig, _ := json.MarshalIndent(newConfigJson, "", "  ")
+	return []json_util.RawMessage{newConfig}
+}
+
+// getPlaceholderConfig 中文注释: 生成指向本机无效端口的占位配置，仅用于通过名称向用户展示账号状态。
+func (s *SubJsonService) getPlaceholderConfig(remark string) []json_util.RawMessage {
+	outbound, _ := json.MarshalIndent(map[string]any{
+		"protocol": "vless",
+		"tag":      "proxy",
+		"settings": map[string]any{
+			"vnext": []any{
+				map[string]any{
+					"address": placeholderAddress,
+					"port":    placeholderPort,
+					"users": []any{
+						map[string]any{
+							"id":         placeholderId,
+							"encryption": "none",
+						},
+					},
+				},
+			},
+		},
+	}, "", "  ")
+	return s.genSingleConfig(outbound, remark)
+}
+
 func (s *SubJsonService) streamData(stream string) map[string]any {
 	var streamSettings map[string]any
 	json.Unmarshal([]byte(stream), &streamSettings)
@@ -3,6 +3,7 @@ package sub
 import (
 	"encoding/base64"
 	"fmt"
+	"net"
 	"net/url"
 	"strings"
 	"time"
@@ -11,20 +12,32 @@ import (
 	"x-ui/database/model"
 	"x-ui/logger"
 	"x-ui/util/common"
+	"x-ui/util/crypto"
 	"x-ui/util/random"
+	"x-ui/web/locale"
 	"x-ui/web/service"
 	"x-ui/xray"
 
 	"github.com/goccy/go-json"
 )
 
+// 中文注释: 状态占位节点的连接参数，指向本机的保留端口，客户端无法通过它连接。
+const (
+	placeholderId      = "00000000-0000-0000-0000-000000000000"
+	placeholderAddress = "127.0.0.1"
+	placeholderPort    = 1
+)
+
 type SubService struct {
-	address        string
-	showInfo       bool
-	remarkModel    string
-	datepicker     string
-	inboundService service.InboundService
-	settingService service.SettingService
+	address         string
+	showInfo        bool
+	remarkModel     string
+	datepicker      string
+	inboundService  service.InboundService
+	settingService  service.SettingService
+	subGroupService service.SubGroupService
+
+	subTemplateService service.SubTemplateService
 }
 
 func NewSubService(showInfo bool, remarkModel string) *SubService {
@@ -34,35 +47,66 @@ func NewSubService(showInfo bool, remarkModel string) *SubService {
 	}
 }
 
+// forRequest 中文注释: SubService 由所有请求共用，每次生成订阅时复制一份并写入本次请求的地址、日期格式和
+// 分组的备注格式，生成过程只读写副本，避免并发请求互相覆盖。同时返回订阅ID对应的分组(普通订阅为 nil)。
+func (s *SubService) forRequest(subId string, host string) (*SubService, *model.SubGroup, error) {
+	group, err := s.subGroupService.GetSubGroupBySubId(subId)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := *s
+	r.address = host
+	r.datepicker, err = s.settingService.GetDatepicker()
+	if err != nil {
+		r.datepicker = "gregorian"
+	}
+	if group != nil && len(group.RemarkModel) > 1 {
+		r.remarkModel = group.RemarkModel
+	}
+	return &r, group, nil
+}
+
 func (s *SubService) GetSubs(subId string, host string) ([]string, string, error) {
-	s.address = host
+	r, group, err := s.forRequest(subId, host)
+	if err != nil {
+		return nil, "", err
+	}
 	var result []string
-	var header string
+	traffic, err := r.walkClients(subId, group, func(inbound *model.Inbound, client model.Client) {
+		result = append(result, r.getLink(inbound, client.Email))
+	}, func(remark string) {
+		result = append(result, genPlaceholderLink(remark))
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return result, formatUserinfo(traffic), nil
+}
+
+// walkClients 中文注释: 遍历订阅包含的全部入站和客户端，对每个选中的客户端调用 visit，
+// 并返回这些客户端合计的流量统计。各种订阅格式共用这一选择逻辑，应在 forRequest 返回的副本上调用，
+// group 为订阅分组，普通订阅为 nil。
+// 开启状态占位时，已禁用、已过期或流量耗尽的客户端改为调用 placeholder，相同状态只输出一次。
+func (s *SubService) walkClients(
+	subId string,
+	group *model.SubGroup,
+	visit func(inbound *model.Inbound, client model.Client),
+	placeholder func(remark string),
+) (xray.ClientTraffic, error) {
 	var traffic xray.ClientTraffic
 	var clientTraffics []xray.ClientTraffic
-	
-	var inbounds []*model.Inbound
-	var err error
-	
-	// 检查是否为总订阅ID
-	if s.isTotalSubscription(subId) {
-		inbounds, err = s.getAllInbounds()
-	} else {
-		inbounds, err = s.getInboundsBySubId(subId)
-	}
-	
+
+	inbounds, err := s.getInbounds(subId, group)
 	if err != nil {
-		return nil, "", err
+		return traffic, err
 	}
 
 	if len(inbounds) == 0 {
-		return nil, "", common.NewError("No inbounds found with ", subId)
+		return traffic, common.NewError("No inbounds found with ", subId)
 	}
 
-	s.datepicker, err = s.settingService.GetDatepicker()
-	if err != nil {
-		s.datepicker = "gregorian"
-	}
+	showPlaceholder, _ := s.settingService.GetSubPlaceholder()
+	shownPlaceholders := make(map[string]bool)
 	for _, inbound := range inbounds {
 		clients, err := s.inboundService.GetClients(inbound)
 		if err != nil {
@@ -80,12 +124,23 @@ func (s *SubService) GetSubs(subId string, host string) ([]string, string, error
 			}
 		}
 		for _, client := range clients {
-			// 如果是总订阅，包含所有启用的客户端
-			// 如果是普通订阅，只包含匹配 subId 的客户端
-			if client.Enable && (s.isTotalSubscription(subId) || client.SubID == subId) {
-				link := s.getLink(inbound, client.Email)
-				result = append(result, link)
-				clientTraffics = append(clientTraffics, s.getClientTraffics(inbound.ClientStats, client.Email))
+			if !s.isClientSelected(subId, group, inbound, client) {
+				continue
+			}
+			clientTraffic := s.getClientTraffics(inbound.ClientStats, client.Email)
+			if showPlaceholder {
+				if remark := s.getStatusRemark(client, clientTraffic); remark != "" {
+					if !shownPlaceholders[remark] {
+						shownPlaceholders[remark] = true
+						placeholder(remark)
+					}
+					clientTraffics = append(clientTraffics, clientTraffic)
+					continue
+				}
+			}
+			if client.Enable {
+				visit(inbound, client)
+				clientTraffics = append(clientTraffics, clientTraffic)
 			}
 		}
 	}
@@ -112,8 +167,71 @@ func (s *SubService) GetSubs(subId string, host string) ([]string, string, error
 			}
 		}
 	}
-	header = fmt.Sprintf("upload=%d; download=%d; total=%d; expire=%d", traffic.Up, traffic.Down, traffic.Total, traffic.ExpiryTime/1000)
-	return result, header, nil
+	return traffic, nil
+}
+
+// getStatusRemark 中文注释: 客户端不可用时返回说明原因的占位备注，可用时返回空字符串。
+// 备注文字来自翻译文件，语言与 Telegram 机器人一致。
+func (s *SubService) getStatusRemark(client model.Client, traffic xray.ClientTraffic) string {
+	now := time.Now().UnixMilli()
+	switch {
+	case !client.Enable:
+		return locale.I18n(locale.Bot, "subPlaceholder.disabled")
+	case traffic.ExpiryTime > 0 && traffic.ExpiryTime <= now:
+		loc, err := s.settingService.GetTimeLocation()
+		if err != nil {
+			loc = time.Local
+		}
+		date := time.UnixMilli(traffic.ExpiryTime).In(loc).Format("2006-01-02")
+		return locale.I18n(locale.Bot, "subPlaceholder.expired", "Date=="+date)
+	case traffic.Total > 0 && traffic.Up+traffic.Down >= traffic.Total && !service.QuotaThrottled(&client, &traffic):
+		return locale.I18n(locale.Bot, "subPlaceholder.depleted")
+	case traffic.Email != "" && !traffic.Enable:
+		return locale.I18n(locale.Bot, "subPlaceholder.disabled")
+	}
+	return ""
+}
+
+// genPlaceholderLink 中文注释: 生成指向本机无效端口的占位节点，仅用于通过名称向用户展示账号状态。
+func genPlaceholderLink(remark string) string {
+	link := &url.URL{
+		Scheme:   "vless",
+		User:     url.User(placeholderId),
+		Host:     net.JoinHostPort(placeholderAddress, fmt.Sprint(placeholderPort)),
+		RawQuery: "encryption=none&security=none&type=tcp",
+		Fragment: remark,
+	}
+	return link.String()
+}
+
+func formatUserinfo(traffic xray.ClientTraffic) string {
+	return fmt.Sprintf("upload=%d; download=%d; total=%d; expire=%d", traffic.Up, traffic.Down, traffic.Total, traffic.ExpiryTime/1000)
+}
+
+// GetSubGroup 中文注释: 返回订阅ID对应的订阅分组，普通客户端订阅返回 nil。
+func (s *SubService) GetSubGroup(subId string) (*model.SubGroup, error) {
+	return s.subGroupService.GetSubGroupBySubId(subId)
+}
+
+// IsAccessible 中文注释: 检查订阅分组的启用状态、有效期和来源 IP 限制。
+func (s *SubService) IsAccessible(group *model.SubGroup, remoteIp string) bool {
+	return s.subGroupService.IsAccessible(group, remoteIp)
+}
+
+// getInbounds 中文注释: 根据当前请求是分组订阅还是客户端订阅，加载对应的入站。
+func (s *SubService) getInbounds(subId string, group *model.SubGroup) ([]*model.Inbound, error) {
+	if group != nil {
+		return s.getInboundsBySubGroup(group)
+	}
+	return s.getInboundsBySubId(subId)
+}
+
+// isClientSelected 中文注释: 分组订阅按分组选择器匹配，普通订阅只包含 subId 相同的客户端。
+func (s *SubService) isClientSelected(subId string, group *model.SubGroup, inbound *model.Inbound, client model.Client) bool {
+	if group != nil {
+		return s.subGroupService.Matches(group, inbound.Tag, client.Email)
+	}
+	return client.SubID == subId
 }
 
 func (s *SubService) getInboundsBySubId(subId string) ([]*model.Inbound, error) {
@@ -124,7 +242,7 @@ func (s *SubService) getInboundsBySubId(subId string) ([]*model.Inbound, error)
 		FROM inbounds,
 			JSON_EACH(JSON_EXTRACT(inbounds.settings, '$.clients')) AS client 
 		WHERE
-			protocol in ('vmess','vless','trojan','shadowsocks')
+			protocol in ('vmess','vless','trojan','shadowsocks','wireguard','socks','http')
 			AND JSON_EXTRACT(client.value, '$.subId') = ? AND enable = ?
 	)`, subId, true).Find(&inbounds).Error
 	if err != nil {
@@ -133,59 +251,39 @@ func (s *SubService) getInboundsBySubId(subId string) ([]*model.Inbound, error)
 	return inbounds, nil
 }
 
-func (s *SubService) getAllInbounds() ([]*model.Inbound, error) {
-	db := database.GetDB()
-	var inbounds []*model.Inbound
-	err := db.Model(model.Inbound{}).Preload("ClientStats").Where(
-		"protocol in ('vmess','vless','trojan','shadowsocks') AND enable = ?", true,
-	).Find(&inbounds).Error
+func (s *SubService) getInboundsBySubGroup(group *model.SubGroup) ([]*model.Inbound, error) {
+	tags, err := s.subGroupService.GetInboundTags(group)
 	if err != nil {
 		return nil, err
 	}
-	return inbounds, nil
-}
-
-// 检查是否为总订阅ID
-func (s *SubService) isTotalSubscription(subId string) bool {
-	totalId, err := s.settingService.GetSubTotalId()
+	emails, err := s.subGroupService.GetClientEmails(group)
 	if err != nil {
-		return false
+		return nil, err
 	}
-	return totalId != "" && totalId == subId
-}
-
-// 仅获取总订阅ID，不自动生成
-func (s *SubService) GetTotalSubscriptionId() (string, error) {
-	return s.settingService.GetSubTotalId()
-}
-
-// 生成新的总订阅ID
-func (s *SubService) GenerateNewTotalSubscriptionId() (string, error) {
-	totalId := random.Seq(16)
-	err := s.settingService.SetSubTotalId(totalId)
-	if err != nil {
-		return "", err
+	if len(tags) == 0 && len(emails) == 0 {
+		return nil, nil
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	if emails == nil {
+		emails = []string{}
 	}
-	return totalId, nil
-}
 
-// 获取或生成总订阅ID（保留用于其他地方）
-func (s *SubService) GetOrCreateTotalSubscriptionId() (string, error) {
-	totalId, err := s.settingService.GetSubTotalId()
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err = db.Model(model.Inbound{}).Preload("ClientStats").Where(`id in (
+		SELECT DISTINCT inbounds.id
+		FROM inbounds,
+			JSON_EACH(JSON_EXTRACT(inbounds.settings, '$.clients')) AS client
+		WHERE
+			protocol in ('vmess','vless','trojan','shadowsocks','wireguard','socks','http')
+			AND (inbounds.tag IN (?) OR JSON_EXTRACT(client.value, '$.email') IN (?)) AND enable = ?
+	)`, tags, emails, true).Find(&inbounds).Error
 	if err != nil {
-		return "", err
-	}
-	
-	// 如果总订阅ID为空，生成一个新的
-	if totalId == "" {
-		totalId = random.Seq(16)
-		err = s.settingService.SetSubTotalId(totalId)
-		if err != nil {
-			return "", err
-		}
+		return nil, err
 	}
-	
-	return totalId, nil
+	return inbounds, nil
 }
 
 func (s *SubService) getClientTraffics(traffics []xray.ClientTraffic, email string) xray.ClientTraffic {
@@ -230,6 +328,10 @@ func (s *SubService) getLink(inbound *model.Inbound, email string) string {
 		return s.genTrojanLink(inbound, email)
 	case "shadowsocks":
 		return s.genShadowsocksLink(inbound, email)
+	case "wireguard":
+		return s.genWireguardLink(inbound, email)
+	case "socks", "http":
+		return s.genAccountLink(inbound, email)
 	}
 	return ""
 }
@@ -942,9 +1044,96 @@ func (s *SubService) genShadowsocksLink(inbound *model.Inbound, email string) st
 	return url.String()
 }
 
+// genWireguardLink 中文注释: 生成 wireguard:// 分享链接，私钥作为用户信息，服务端公钥和地址放在查询参数中。
+func (s *SubService) genWireguardLink(inbound *model.Inbound, email string) string {
+	if inbound.Protocol != model.WireGuard {
+		return ""
+	}
+	clients, _ := s.inboundService.GetClients(inbound)
+	var client *model.Client
+	for i := range clients {
+		if clients[i].Email == email {
+			client = &clients[i]
+			break
+		}
+	}
+	if client == nil || client.PrivateKey == "" {
+		return ""
+	}
+
+	var settings map[string]any
+	json.Unmarshal([]byte(inbound.Settings), &settings)
+	secretKey, _ := settings["secretKey"].(string)
+	serverPublicKey, err := crypto.GetWireguardPublicKey(secretKey)
+	if err != nil {
+		return ""
+	}
+
+	params := make(map[string]string)
+	params["publickey"] = serverPublicKey
+	params["address"] = strings.Join(client.AllowedIPs, ",")
+	if mtu, ok := settings["mtu"].(float64); ok && mtu > 0 {
+		params["mtu"] = fmt.Sprintf("%d", int(mtu))
+	}
+	if client.PreSharedKey != "" {
+		params["presharedkey"] = client.PreSharedKey
+	}
+	if client.KeepAlive > 0 {
+		params["keepalive"] = fmt.Sprintf("%d", client.KeepAlive)
+	}
+
+	link := fmt.Sprintf("wireguard://%s@%s", url.PathEscape(client.PrivateKey), net.JoinHostPort(s.address, fmt.Sprint(inbound.Port)))
+	url, _ := url.Parse(link)
+	q := url.Query()
+
+	for k, v := range params {
+		q.Add(k, v)
+	}
+
+	// Set the new query values on the URL
+	url.RawQuery = q.Encode()
+
+	url.Fragment = s.genRemark(inbound, email, "")
+	return url.String()
+}
+
+// genAccountLink 中文注释: 生成 socks:// 或 http:// 分享链接，账号的 email 即用户名。
+// socks 链接的用户信息按常见客户端的格式使用 base64(user:pass)。
+func (s *SubService) genAccountLink(inbound *model.Inbound, email string) string {
+	if inbound.Protocol != model.Socks && inbound.Protocol != model.HTTP {
+		return ""
+	}
+	clients, _ := s.inboundService.GetClients(inbound)
+	var client *model.Client
+	for i := range clients {
+		if clients[i].Email == email {
+			client = &clients[i]
+			break
+		}
+	}
+	if client == nil {
+		return ""
+	}
+
+	var userInfo *url.Userinfo
+	if inbound.Protocol == model.Socks {
+		userInfo = url.User(base64.StdEncoding.EncodeToString([]byte(client.Email + ":" + client.Password)))
+	} else {
+		userInfo = url.UserPassword(client.Email, client.Password)
+	}
+	link := &url.URL{
+		Scheme:   string(inbound.Protocol),
+		User:     userInfo,
+		Host:     net.JoinHostPort(s.address, fmt.Sprint(inbound.Port)),
+		Fragment: s.genRemark(inbound, email, ""),
+	}
+	return link.String()
+}
+
 func (s *SubService) genRemark(inbound *model.Inbound, email string, extra string) string {
-	separationChar := string(s.remarkModel[0])
-	orderChars := s.remarkModel[1:]
+	remarkModel := s.remarkModel
+	separationChar := string(remarkModel[0])
+	orderChars := remarkModel[1:]
 	orders := map[byte]string{
 		'i': "",
 		'e': "",
@@ -0,0 +1,292 @@
+package sub
+
+import (
+	"bytes"
+	"strings"
+
+	"x-ui/database/model"
+	"x-ui/util/crypto"
+	"x-ui/util/random"
+
+	"github.com/goccy/go-json"
+)
+
+// SubNode 中文注释: 提供给自定义订阅模板的节点数据。每个客户端在每个入站(以及每个外部代理)下对应一个节点，
+// 字段按协议填充，未使用的字段为空值。
+type SubNode struct {
+	Remark   string
+	Protocol string
+	Address  string
+	Port     int
+	Email    string
+	// Placeholder 为 true 表示这是说明账号状态的占位节点
+	Placeholder bool
+
+	// 凭据: vmess/vless 使用 ID，trojan/shadowsocks/socks/http 使用 Password
+	ID         string
+	Password   string
+	Method     string
+	Flow       string
+	Security   string
+	Encryption string
+
+	// 传输层
+	Network     string
+	HeaderType  string
+	Path        string
+	Host        string
+	ServiceName string
+	Authority   string
+	Mode        string
+	Seed        string
+
+	// TLS / Reality
+	TLS           string
+	SNI           string
+	ALPN          []string
+	Fingerprint   string
+	AllowInsecure bool
+	PublicKey     string
+	ShortID       string
+	SpiderX       string
+
+	// WireGuard
+	PrivateKey      string
+	ServerPublicKey string
+	PreSharedKey    string
+	AllowedIPs      []string
+	KeepAlive       int
+	MTU             int
+}
+
+// SubTemplateData 中文注释: 模板的根数据，流量单位为字节，ExpiryTime 为毫秒时间戳(0 表示不限)。
+type SubTemplateData struct {
+	SubId      string
+	Title      string
+	Nodes      []SubNode
+	Upload     int64
+	Download   int64
+	Total      int64
+	ExpiryTime int64
+}
+
+// GetTemplateSub 中文注释: 使用自定义模板渲染订阅，返回内容和 Subscription-Userinfo 响应头。
+func (s *SubService) GetTemplateSub(tpl *model.SubTemplate, subId string, host string, title string) (string, string, error) {
+	parsed, err := s.subTemplateService.Parse(tpl)
+	if err != nil {
+		return "", "", err
+	}
+	r, group, err := s.forRequest(subId, host)
+	if err != nil {
+		return "", "", err
+	}
+	data := SubTemplateData{
+		SubId: subId,
+		Title: title,
+	}
+	traffic, err := r.walkClients(subId, group, func(inbound *model.Inbound, client model.Client) {
+		data.Nodes = append(data.Nodes, r.getNodes(inbound, client)...)
+	}, func(remark string) {
+		data.Nodes = append(data.Nodes, SubNode{
+			Remark:      remark,
+			Protocol:    string(model.VLESS),
+			Address:     placeholderAddress,
+			Port:        placeholderPort,
+			ID:          placeholderId,
+			Encryption:  "none",
+			Network:     "tcp",
+			TLS:         "none",
+			Placeholder: true,
+		})
+	})
+	if err != nil {
+		return "", "", err
+	}
+	data.Upload = traffic.Up
+	data.Download = traffic.Down
+	data.Total = traffic.Total
+	data.ExpiryTime = traffic.ExpiryTime
+
+	var buf bytes.Buffer
+	if err := parsed.Execute(&buf, data); err != nil {
+		return "", "", err
+	}
+	return buf.String(), formatUserinfo(traffic), nil
+}
+
+// getNodes 中文注释: 生成客户端在入站下的节点，配置了外部代理时每个代理各生成一个节点。
+func (s *SubService) getNodes(inbound *model.Inbound, client model.Client) []SubNode {
+	node := SubNode{
+		Remark:   s.genRemark(inbound, client.Email, ""),
+		Protocol: string(inbound.Protocol),
+		Address:  s.address,
+		Port:     inbound.Port,
+		Email:    client.Email,
+	}
+
+	var settings map[string]any
+	json.Unmarshal([]byte(inbound.Settings), &settings)
+	switch inbound.Protocol {
+	case model.VMESS:
+		node.ID = client.ID
+		node.Security = client.Security
+	case model.VLESS:
+		node.ID = client.ID
+		node.Encryption, _ = settings["encryption"].(string)
+	case model.Trojan:
+		node.Password = client.Password
+	case model.Shadowsocks:
+		node.Method, _ = settings["method"].(string)
+		node.Password = client.Password
+		if strings.HasPrefix(node.Method, "2022") {
+			inboundPassword, _ := settings["password"].(string)
+			node.Password = inboundPassword + ":" + client.Password
+		}
+	case model.Socks, model.HTTP:
+		node.Password = client.Password
+	case model.WireGuard:
+		if client.PrivateKey == "" {
+			return nil
+		}
+		secretKey, _ := settings["secretKey"].(string)
+		serverPublicKey, err := crypto.GetWireguardPublicKey(secretKey)
+		if err != nil {
+			return nil
+		}
+		node.PrivateKey = client.PrivateKey
+		node.ServerPublicKey = serverPublicKey
+		node.PreSharedKey = client.PreSharedKey
+		node.AllowedIPs = client.AllowedIPs
+		node.KeepAlive = client.KeepAlive
+		if mtu, ok := settings["mtu"].(float64); ok {
+			node.MTU = int(mtu)
+		}
+		return []SubNode{node}
+	default:
+		return nil
+	}
+
+	var stream map[string]any
+	json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+	fillNodeStream(&node, stream)
+	if inbound.Protocol == model.VLESS && node.Network == "tcp" && (node.TLS == "tls" || node.TLS == "reality") {
+		node.Flow = client.Flow
+	}
+
+	externalProxies, _ := stream["externalProxy"].([]any)
+	if len(externalProxies) == 0 {
+		return []SubNode{node}
+	}
+	nodes := make([]SubNode, 0, len(externalProxies))
+	for _, externalProxy := range externalProxies {
+		ep, _ := externalProxy.(map[string]any)
+		newNode := node
+		newNode.Address, _ = ep["dest"].(string)
+		if port, ok := ep["port"].(float64); ok {
+			newNode.Port = int(port)
+		}
+		remark, _ := ep["remark"].(string)
+		newNode.Remark = s.genRemark(inbound, client.Email, remark)
+		switch forceTls, _ := ep["forceTls"].(string); forceTls {
+		case "none":
+			newNode.TLS = "none"
+			newNode.SNI = ""
+			newNode.ALPN = nil
+			newNode.Fingerprint = ""
+			newNode.AllowInsecure = false
+		case "tls":
+			newNode.TLS = "tls"
+		}
+		nodes = append(nodes, newNode)
+	}
+	return nodes
+}
+
+// fillNodeStream 中文注释: 从入站的 streamSettings 中提取传输层和 TLS/Reality 参数。
+func fillNodeStream(node *SubNode, stream map[string]any) {
+	node.Network, _ = stream["network"].(string)
+	switch node.Network {
+	case "tcp":
+		tcp, _ := stream["tcpSettings"].(map[string]any)
+		header, _ := tcp["header"].(map[string]any)
+		node.HeaderType, _ = header["type"].(string)
+		if node.HeaderType == "http" {
+			request, _ := header["request"].(map[string]any)
+			if requestPath, _ := request["path"].([]any); len(requestPath) > 0 {
+				node.Path, _ = requestPath[0].(string)
+			}
+			headers, _ := request["headers"].(map[string]any)
+			node.Host = searchHost(headers)
+		}
+	case "kcp":
+		kcp, _ := stream["kcpSettings"].(map[string]any)
+		header, _ := kcp["header"].(map[string]any)
+		node.HeaderType, _ = header["type"].(string)
+		node.Seed, _ = kcp["seed"].(string)
+	case "ws", "httpupgrade", "xhttp":
+		transport, _ := stream[node.Network+"Settings"].(map[string]any)
+		node.Path, _ = transport["path"].(string)
+		if host, ok := transport["host"].(string); ok && len(host) > 0 {
+			node.Host = host
+		} else {
+			headers, _ := transport["headers"].(map[string]any)
+			node.Host = searchHost(headers)
+		}
+		node.Mode, _ = transport["mode"].(string)
+	case "grpc":
+		grpc, _ := stream["grpcSettings"].(map[string]any)
+		node.ServiceName, _ = grpc["serviceName"].(string)
+		node.Authority, _ = grpc["authority"].(string)
+		if multiMode, _ := grpc["multiMode"].(bool); multiMode {
+			node.Mode = "multi"
+		}
+	}
+
+	node.TLS, _ = stream["security"].(string)
+	switch node.TLS {
+	case "tls":
+		tlsSetting, _ := stream["tlsSettings"].(map[string]any)
+		alpns, _ := tlsSetting["alpn"].([]any)
+		for _, a := range alpns {
+			if alpn, ok := a.(string); ok {
+				node.ALPN = append(node.ALPN, alpn)
+			}
+		}
+		if sniValue, ok := searchKey(tlsSetting, "serverName"); ok {
+			node.SNI, _ = sniValue.(string)
+		}
+		if tlsSettings, ok := searchKey(tlsSetting, "settings"); ok {
+			if fpValue, ok := searchKey(tlsSettings, "fingerprint"); ok {
+				node.Fingerprint, _ = fpValue.(string)
+			}
+			if insecure, ok := searchKey(tlsSettings, "allowInsecure"); ok {
+				node.AllowInsecure, _ = insecure.(bool)
+			}
+		}
+	case "reality":
+		realitySetting, _ := stream["realitySettings"].(map[string]any)
+		if sniValue, ok := searchKey(realitySetting, "serverNames"); ok {
+			if sNames, _ := sniValue.([]any); len(sNames) > 0 {
+				node.SNI, _ = sNames[random.Num(len(sNames))].(string)
+			}
+		}
+		if sidValue, ok := searchKey(realitySetting, "shortIds"); ok {
+			if shortIds, _ := sidValue.([]any); len(shortIds) > 0 {
+				node.ShortID, _ = shortIds[random.Num(len(shortIds))].(string)
+			}
+		}
+		if realitySettings, ok := searchKey(realitySetting, "settings"); ok {
+			if pbkValue, ok := searchKey(realitySettings, "publicKey"); ok {
+				node.PublicKey, _ = pbkValue.(string)
+			}
+			if fpValue, ok := searchKey(realitySettings, "fingerprint"); ok {
+				node.Fingerprint, _ = fpValue.(string)
+			}
+			if spxValue, ok := searchKey(realitySettings, "spiderX"); ok {
+				node.SpiderX, _ = spxValue.(string)
+			}
+		}
+	default:
+		node.TLS = "none"
+	}
+}
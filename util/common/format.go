@@ -2,6 +2,9 @@ package common
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 func FormatTraffic(trafficBytes int64) string {
@@ -15,3 +18,23 @@ func FormatTraffic(trafficBytes int64) string {
 	}
 	return fmt.Sprintf("%.2f%s", size, units[unitIndex])
 }
+
+// ParseIntList 中文注释: 解析以逗号分隔的正整数列表(如 "50,80,95")，去重并升序返回，空字符串返回 nil。
+func ParseIntList(text string) ([]int, error) {
+	var values []int
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		value, err := strconv.Atoi(part)
+		if err != nil || value <= 0 {
+			return nil, NewError("invalid number:", part)
+		}
+		if !slices.Contains(values, value) {
+			values = append(values, value)
+		}
+	}
+	slices.Sort(values)
+	return values, nil
+}
@@ -1,7 +1,11 @@
 package crypto
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/curve25519"
 )
 
 func HashPasswordAsBcrypt(password string) (string, error) {
@@ -13,3 +17,32 @@ func CheckPasswordHash(hash, password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// GenerateWireguardKeyPair 中文注释: 生成 WireGuard 密钥对，返回 base64 编码的私钥和公钥。
+func GenerateWireguardKeyPair() (string, string, error) {
+	privateKey := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(privateKey); err != nil {
+		return "", "", err
+	}
+	// 中文注释: 按 curve25519 规范对私钥进行 clamp
+	privateKey[0] &= 248
+	privateKey[31] = (privateKey[31] & 127) | 64
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(privateKey), base64.StdEncoding.EncodeToString(publicKey), nil
+}
+
+// GetWireguardPublicKey 中文注释: 根据 base64 编码的私钥计算公钥。
+func GetWireguardPublicKey(privateKey string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return "", err
+	}
+	publicKey, err := curve25519.X25519(key, curve25519.Basepoint)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(publicKey), nil
+}
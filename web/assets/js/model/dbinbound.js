@@ -13,6 +13,12 @@ class DBInbound {
         
       // 新增：入站级设备限制（0 表示不限制）
         this.deviceLimit = 0;
+        // 中文注释: 入站默认的上行/下行限速(KB/s)，0 表示不限速
+        this.upLimit = 0;
+        this.downLimit = 0;
+        // 中文注释: 限速时段，speedSchedule 为提交给后端的 JSON，speedScheduleRule 供表单编辑
+        this.speedSchedule = "";
+        this.speedScheduleRule = new SpeedSchedule();
 
         this.listen = "";
         this.port = 0;
@@ -22,10 +28,21 @@ class DBInbound {
         this.tag = "";
         this.sniffing = "";
         this.clientStats = ""
+        // 中文注释: 流量计费规则，accounting 为提交给后端的 JSON，accountingRule 供表单编辑
+        this.accounting = "";
+        this.rawUp = 0;
+        this.rawDown = 0;
+        this.accountingRule = new AccountingRule();
+        // 中文注释: 设备超限策略，devicePolicy 为提交给后端的 JSON，devicePolicyRule 供表单编辑
+        this.devicePolicy = "";
+        this.devicePolicyRule = new DevicePolicy();
         if (data == null) {
             return;
         }
-        ObjectUtil.cloneProps(this, data);
+        ObjectUtil.cloneProps(this, data, 'accountingRule', 'devicePolicyRule', 'speedScheduleRule');
+        this.accountingRule = AccountingRule.fromString(this.accounting);
+        this.devicePolicyRule = DevicePolicy.fromString(this.devicePolicy);
+        this.speedScheduleRule = SpeedSchedule.fromString(this.speedSchedule);
     }
 
     get totalGB() {
@@ -150,3 +167,140 @@ class DBInbound {
         return inbound.genInboundLinks(this.remark, remarkModel);
     }
 }
+
+class AccountingRule {
+    constructor(multiplier = 1, direction = '', freeWindows = []) {
+        this.multiplier = multiplier;
+        this.direction = direction;
+        this.freeWindows = freeWindows;
+    }
+
+    static fromString(text) {
+        if (ObjectUtil.isEmpty(text)) {
+            return new AccountingRule();
+        }
+        try {
+            const json = JSON.parse(text);
+            return new AccountingRule(
+                json.multiplier ?? 1,
+                json.direction ?? '',
+                (json.freeWindows ?? []).map(w => ({ start: w.start, end: w.end, days: w.days ?? [] })),
+            );
+        } catch (e) {
+            return new AccountingRule();
+        }
+    }
+
+    get isDefault() {
+        return this.multiplier === 1 && this.direction === '' && this.freeWindows.length === 0;
+    }
+
+    addFreeWindow() {
+        this.freeWindows.push({ start: '00:00', end: '06:00', days: [] });
+    }
+
+    delFreeWindow(index) {
+        this.freeWindows.splice(index, 1);
+    }
+
+    toString() {
+        if (this.isDefault) {
+            return '';
+        }
+        return JSON.stringify({
+            multiplier: this.multiplier,
+            direction: this.direction,
+            freeWindows: this.freeWindows,
+        });
+    }
+}
+
+class DevicePolicy {
+    constructor(mode = 'ban', grace = 0, strikes = '', strikeWindow = 0) {
+        this.mode = mode;
+        this.grace = grace;
+        // 中文注释: 逐次加重的封禁时长(分钟)，以逗号分隔
+        this.strikes = strikes;
+        this.strikeWindow = strikeWindow;
+    }
+
+    static fromString(text) {
+        if (ObjectUtil.isEmpty(text)) {
+            return new DevicePolicy();
+        }
+        try {
+            const json = JSON.parse(text);
+            return new DevicePolicy(
+                json.mode || 'ban',
+                json.grace ?? 0,
+                (json.strikes ?? []).join(','),
+                json.strikeWindow ?? 0,
+            );
+        } catch (e) {
+            return new DevicePolicy();
+        }
+    }
+
+    get strikeList() {
+        return this.strikes.split(',').map(s => parseInt(s.trim())).filter(n => n > 0);
+    }
+
+    get isDefault() {
+        return this.mode === 'ban' && !this.grace && this.strikeList.length === 0;
+    }
+
+    toString() {
+        if (this.isDefault) {
+            return '';
+        }
+        return JSON.stringify({
+            mode: this.mode,
+            grace: this.grace || 0,
+            strikes: this.strikeList,
+            strikeWindow: this.strikeWindow || 0,
+        });
+    }
+}
+
+// 中文注释: 限速时段列表，入站保存为 JSON 字符串，客户端直接保存为数组
+class SpeedSchedule {
+    constructor(windows = []) {
+        this.windows = windows;
+    }
+
+    static fromJson(list) {
+        return new SpeedSchedule((list ?? []).map(w => ({
+            start: w.start,
+            end: w.end,
+            days: w.days ?? [],
+            up: w.up ?? 0,
+            down: w.down ?? 0,
+        })));
+    }
+
+    static fromString(text) {
+        if (ObjectUtil.isEmpty(text)) {
+            return new SpeedSchedule();
+        }
+        try {
+            return SpeedSchedule.fromJson(JSON.parse(text));
+        } catch (e) {
+            return new SpeedSchedule();
+        }
+    }
+
+    addWindow() {
+        this.windows.push({ start: '19:00', end: '23:00', days: [], up: 2048, down: 2048 });
+    }
+
+    delWindow(index) {
+        this.windows.splice(index, 1);
+    }
+
+    toString() {
+        if (this.windows.length === 0) {
+            return '';
+        }
+        return JSON.stringify(this.windows);
+    }
+}
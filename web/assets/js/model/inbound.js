@@ -1678,7 +1678,9 @@ class Inbound extends XrayCommonClass {
         let txt = `[Interface]\n`
         txt += `PrivateKey = ${this.settings.peers[peerId].privateKey}\n`
         txt += `Address = ${this.settings.peers[peerId].allowedIPs[0]}\n`
-        txt += `DNS = 1.1.1.1, 1.0.0.1\n`
+        if (this.settings.clientDns) {
+            txt += `DNS = ${this.settings.clientDns}\n`
+        }
         if (this.settings.mtu) {
             txt += `MTU = ${this.settings.mtu}\n`
         }
@@ -1888,7 +1890,18 @@ Inbound.VmessSettings.VMESS = class extends XrayCommonClass {
         comment = '',
         reset = 0,
         created_at = undefined,
-        updated_at = undefined
+        updated_at = undefined,
+        subProfileId = 0, // 中文注释: JSON 订阅路由方案ID
+        resetSchedule = '', // 中文注释: 按日历的流量重置计划
+        upLimit = 0, // 中文注释: 上行限速(KB/s)，0 为沿用 speedLimit 或入站默认限速
+        downLimit = 0, // 中文注释: 下行限速(KB/s)，0 为沿用 speedLimit 或入站默认限速
+        speedSchedule = [], // 中文注释: 限速时段，时段内替代上面的限速
+        quotaAction = '', // 中文注释: 流量用尽后的处理方式，空为直接禁用
+        throttleSpeed = 0, // 中文注释: 流量用尽后的限速(KB/s)
+        throttleAllowance = 0, // 中文注释: 限速后再禁用前的额外流量(字节)
+        deviceLimit = 0, // 中文注释: 设备限制，0 为沿用入站设置
+        deviceMode = '', // 中文注释: 设备超限处理方式，空为沿用入站策略
+        trustedIps = [], // 中文注释: 信任的 IP 或 CIDR，不计入设备数
     ) {
         super();
         this.id = id;
@@ -1905,6 +1918,17 @@ Inbound.VmessSettings.VMESS = class extends XrayCommonClass {
         this.reset = reset;
         this.created_at = created_at;
         this.updated_at = updated_at;
+        this.subProfileId = subProfileId;
+        this.resetSchedule = resetSchedule;
+        this.upLimit = upLimit;
+        this.downLimit = downLimit;
+        this.speedSchedule = speedSchedule;
+        this.quotaAction = quotaAction;
+        this.throttleSpeed = throttleSpeed;
+        this.throttleAllowance = throttleAllowance;
+        this.deviceLimit = deviceLimit;
+        this.deviceMode = deviceMode;
+        this.trustedIps = trustedIps;
     }
     
     
@@ -1924,6 +1948,17 @@ Inbound.VmessSettings.VMESS = class extends XrayCommonClass {
             json.reset,
             json.created_at,
             json.updated_at,
+            json.subProfileId ?? 0,
+            json.resetSchedule ?? '',
+            json.upLimit ?? 0,
+            json.downLimit ?? 0,
+            json.speedSchedule ?? [],
+            json.quotaAction ?? '',
+            json.throttleSpeed ?? 0,
+            json.throttleAllowance ?? 0,
+            json.deviceLimit ?? 0,
+            json.deviceMode ?? '',
+            json.trustedIps ?? [],
         );
     }
     get _expiryTime() {
@@ -1951,6 +1986,14 @@ Inbound.VmessSettings.VMESS = class extends XrayCommonClass {
         this.totalGB = NumberFormatter.toFixed(gb * SizeFormatter.ONE_GB, 0);
     }
 
+    get _throttleAllowanceGB() {
+        return NumberFormatter.toFixed(this.throttleAllowance / SizeFormatter.ONE_GB, 2);
+    }
+
+    set _throttleAllowanceGB(gb) {
+        this.throttleAllowance = NumberFormatter.toFixed(gb * SizeFormatter.ONE_GB, 0);
+    }
+
 };
 
 Inbound.VLESSSettings = class extends Inbound.Settings {
@@ -2031,7 +2074,18 @@ Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
         comment = '',
         reset = 0,
         created_at = undefined,
-        updated_at = undefined
+        updated_at = undefined,
+        subProfileId = 0, // 中文注释: JSON 订阅路由方案ID
+        resetSchedule = '', // 中文注释: 按日历的流量重置计划
+        upLimit = 0, // 中文注释: 上行限速(KB/s)，0 为沿用 speedLimit 或入站默认限速
+        downLimit = 0, // 中文注释: 下行限速(KB/s)，0 为沿用 speedLimit 或入站默认限速
+        speedSchedule = [], // 中文注释: 限速时段，时段内替代上面的限速
+        quotaAction = '', // 中文注释: 流量用尽后的处理方式，空为直接禁用
+        throttleSpeed = 0, // 中文注释: 流量用尽后的限速(KB/s)
+        throttleAllowance = 0, // 中文注释: 限速后再禁用前的额外流量(字节)
+        deviceLimit = 0, // 中文注释: 设备限制，0 为沿用入站设置
+        deviceMode = '', // 中文注释: 设备超限处理方式，空为沿用入站策略
+        trustedIps = [], // 中文注释: 信任的 IP 或 CIDR，不计入设备数
     ) {
         super();
         this.id = id;
@@ -2048,6 +2102,17 @@ Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
         this.reset = reset;
         this.created_at = created_at;
         this.updated_at = updated_at;
+        this.subProfileId = subProfileId;
+        this.resetSchedule = resetSchedule;
+        this.upLimit = upLimit;
+        this.downLimit = downLimit;
+        this.speedSchedule = speedSchedule;
+        this.quotaAction = quotaAction;
+        this.throttleSpeed = throttleSpeed;
+        this.throttleAllowance = throttleAllowance;
+        this.deviceLimit = deviceLimit;
+        this.deviceMode = deviceMode;
+        this.trustedIps = trustedIps;
     }
     
 
@@ -2067,6 +2132,17 @@ Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
             json.reset,
             json.created_at,
             json.updated_at,
+            json.subProfileId ?? 0,
+            json.resetSchedule ?? '',
+            json.upLimit ?? 0,
+            json.downLimit ?? 0,
+            json.speedSchedule ?? [],
+            json.quotaAction ?? '',
+            json.throttleSpeed ?? 0,
+            json.throttleAllowance ?? 0,
+            json.deviceLimit ?? 0,
+            json.deviceMode ?? '',
+            json.trustedIps ?? [],
         );
     }
 
@@ -2094,6 +2170,14 @@ Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
     set _totalGB(gb) {
         this.totalGB = NumberFormatter.toFixed(gb * SizeFormatter.ONE_GB, 0);
     }
+
+    get _throttleAllowanceGB() {
+        return NumberFormatter.toFixed(this.throttleAllowance / SizeFormatter.ONE_GB, 2);
+    }
+
+    set _throttleAllowanceGB(gb) {
+        this.throttleAllowance = NumberFormatter.toFixed(gb * SizeFormatter.ONE_GB, 0);
+    }
 };
 Inbound.VLESSSettings.Fallback = class extends XrayCommonClass {
     constructor(name = "", alpn = '', path = '', dest = '', xver = 0) {
@@ -2180,7 +2264,18 @@ Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
         comment = '',
         reset = 0,
         created_at = undefined,
-        updated_at = undefined
+        updated_at = undefined,
+        subProfileId = 0, // 中文注释: JSON 订阅路由方案ID
+        resetSchedule = '', // 中文注释: 按日历的流量重置计划
+        upLimit = 0, // 中文注释: 上行限速(KB/s)，0 为沿用 speedLimit 或入站默认限速
+        downLimit = 0, // 中文注释: 下行限速(KB/s)，0 为沿用 speedLimit 或入站默认限速
+        speedSchedule = [], // 中文注释: 限速时段，时段内替代上面的限速
+        quotaAction = '', // 中文注释: 流量用尽后的处理方式，空为直接禁用
+        throttleSpeed = 0, // 中文注释: 流量用尽后的限速(KB/s)
+        throttleAllowance = 0, // 中文注释: 限速后再禁用前的额外流量(字节)
+        deviceLimit = 0, // 中文注释: 设备限制，0 为沿用入站设置
+        deviceMode = '', // 中文注释: 设备超限处理方式，空为沿用入站策略
+        trustedIps = [], // 中文注释: 信任的 IP 或 CIDR，不计入设备数
     ) {
         super();
         this.password = password;
@@ -2196,6 +2291,17 @@ Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
         this.reset = reset;
         this.created_at = created_at;
         this.updated_at = updated_at;
+        this.subProfileId = subProfileId;
+        this.resetSchedule = resetSchedule;
+        this.upLimit = upLimit;
+        this.downLimit = downLimit;
+        this.speedSchedule = speedSchedule;
+        this.quotaAction = quotaAction;
+        this.throttleSpeed = throttleSpeed;
+        this.throttleAllowance = throttleAllowance;
+        this.deviceLimit = deviceLimit;
+        this.deviceMode = deviceMode;
+        this.trustedIps = trustedIps;
     }
 
     toJson() {
@@ -2213,6 +2319,17 @@ Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
             reset: this.reset,
             created_at: this.created_at,
             updated_at: this.updated_at,
+            subProfileId: this.subProfileId,
+            resetSchedule: this.resetSchedule,
+            upLimit: this.upLimit,
+            downLimit: this.downLimit,
+            speedSchedule: this.speedSchedule,
+            quotaAction: this.quotaAction,
+            throttleSpeed: this.throttleSpeed,
+            throttleAllowance: this.throttleAllowance,
+            deviceLimit: this.deviceLimit,
+            deviceMode: this.deviceMode,
+            trustedIps: this.trustedIps,
         };
     }
 
@@ -2231,6 +2348,17 @@ Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
             json.reset,
             json.created_at,
             json.updated_at,
+            json.subProfileId ?? 0,
+            json.resetSchedule ?? '',
+            json.upLimit ?? 0,
+            json.downLimit ?? 0,
+            json.speedSchedule ?? [],
+            json.quotaAction ?? '',
+            json.throttleSpeed ?? 0,
+            json.throttleAllowance ?? 0,
+            json.deviceLimit ?? 0,
+            json.deviceMode ?? '',
+            json.trustedIps ?? [],
         );
     }
 
@@ -2259,6 +2387,14 @@ Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
         this.totalGB = NumberFormatter.toFixed(gb * SizeFormatter.ONE_GB, 0);
     }
 
+    get _throttleAllowanceGB() {
+        return NumberFormatter.toFixed(this.throttleAllowance / SizeFormatter.ONE_GB, 2);
+    }
+
+    set _throttleAllowanceGB(gb) {
+        this.throttleAllowance = NumberFormatter.toFixed(gb * SizeFormatter.ONE_GB, 0);
+    }
+
 };
 
 Inbound.TrojanSettings.Fallback = class extends XrayCommonClass {
@@ -2353,7 +2489,18 @@ Inbound.ShadowsocksSettings.Shadowsocks = class extends XrayCommonClass {
         comment = '',
         reset = 0,
         created_at = undefined,
-        updated_at = undefined
+        updated_at = undefined,
+        subProfileId = 0, // 中文注释: JSON 订阅路由方案ID
+        resetSchedule = '', // 中文注释: 按日历的流量重置计划
+        upLimit = 0, // 中文注释: 上行限速(KB/s)，0 为沿用 speedLimit 或入站默认限速
+        downLimit = 0, // 中文注释: 下行限速(KB/s)，0 为沿用 speedLimit 或入站默认限速
+        speedSchedule = [], // 中文注释: 限速时段，时段内替代上面的限速
+        quotaAction = '', // 中文注释: 流量用尽后的处理方式，空为直接禁用
+        throttleSpeed = 0, // 中文注释: 流量用尽后的限速(KB/s)
+        throttleAllowance = 0, // 中文注释: 限速后再禁用前的额外流量(字节)
+        deviceLimit = 0, // 中文注释: 设备限制，0 为沿用入站设置
+        deviceMode = '', // 中文注释: 设备超限处理方式，空为沿用入站策略
+        trustedIps = [], // 中文注释: 信任的 IP 或 CIDR，不计入设备数
     ) {
         super();
         this.method = method;
@@ -2370,6 +2517,17 @@ Inbound.ShadowsocksSettings.Shadowsocks = class extends XrayCommonClass {
         this.reset = reset;
         this.created_at = created_at;
         this.updated_at = updated_at;
+        this.subProfileId = subProfileId;
+        this.resetSchedule = resetSchedule;
+        this.upLimit = upLimit;
+        this.downLimit = downLimit;
+        this.speedSchedule = speedSchedule;
+        this.quotaAction = quotaAction;
+        this.throttleSpeed = throttleSpeed;
+        this.throttleAllowance = throttleAllowance;
+        this.deviceLimit = deviceLimit;
+        this.deviceMode = deviceMode;
+        this.trustedIps = trustedIps;
     }
     
     toJson() {
@@ -2388,6 +2546,17 @@ Inbound.ShadowsocksSettings.Shadowsocks = class extends XrayCommonClass {
             reset: this.reset,
             created_at: this.created_at,
             updated_at: this.updated_at,
+            subProfileId: this.subProfileId,
+            resetSchedule: this.resetSchedule,
+            upLimit: this.upLimit,
+            downLimit: this.downLimit,
+            speedSchedule: this.speedSchedule,
+            quotaAction: this.quotaAction,
+            throttleSpeed: this.throttleSpeed,
+            throttleAllowance: this.throttleAllowance,
+            deviceLimit: this.deviceLimit,
+            deviceMode: this.deviceMode,
+            trustedIps: this.trustedIps,
         };
     }
 
@@ -2407,6 +2576,17 @@ Inbound.ShadowsocksSettings.Shadowsocks = class extends XrayCommonClass {
             json.reset,
             json.created_at,
             json.updated_at,
+            json.subProfileId ?? 0,
+            json.resetSchedule ?? '',
+            json.upLimit ?? 0,
+            json.downLimit ?? 0,
+            json.speedSchedule ?? [],
+            json.quotaAction ?? '',
+            json.throttleSpeed ?? 0,
+            json.throttleAllowance ?? 0,
+            json.deviceLimit ?? 0,
+            json.deviceMode ?? '',
+            json.trustedIps ?? [],
         );
     }
 
@@ -2435,6 +2615,14 @@ Inbound.ShadowsocksSettings.Shadowsocks = class extends XrayCommonClass {
         this.totalGB = NumberFormatter.toFixed(gb * SizeFormatter.ONE_GB, 0);
     }
 
+    get _throttleAllowanceGB() {
+        return NumberFormatter.toFixed(this.throttleAllowance / SizeFormatter.ONE_GB, 2);
+    }
+
+    set _throttleAllowanceGB(gb) {
+        this.throttleAllowance = NumberFormatter.toFixed(gb * SizeFormatter.ONE_GB, 0);
+    }
+
 };
 
 Inbound.TunnelSettings = class extends Inbound.Settings {
@@ -2496,7 +2684,7 @@ Inbound.SocksSettings = class extends Inbound.Settings {
     static fromJson(json = {}) {
         let accounts;
         if (json.auth === 'password') {
-            accounts = json.accounts.map(
+            accounts = (json.clients ?? json.accounts ?? []).map(
                 account => Inbound.SocksSettings.SocksAccount.fromJson(account)
             )
         }
@@ -2512,21 +2700,115 @@ Inbound.SocksSettings = class extends Inbound.Settings {
     toJson() {
         return {
             auth: this.auth,
-            accounts: this.auth === 'password' ? this.accounts.map(account => account.toJson()) : undefined,
+            // 中文注释: 账号以 clients 保存，由面板在生成 Xray 配置时转换为 accounts
+            clients: this.auth === 'password' ? this.accounts.map(account => account.toJson()) : undefined,
             udp: this.udp,
             ip: this.ip,
         };
     }
 };
 Inbound.SocksSettings.SocksAccount = class extends XrayCommonClass {
-    constructor(user = RandomUtil.randomSeq(10), pass = RandomUtil.randomSeq(10)) {
+    constructor(
+        user = RandomUtil.randomSeq(10),
+        pass = RandomUtil.randomSeq(10),
+        enable = true, // 中文注释: 账号作为客户端管理，以下为客户端字段
+        limitIp = 0,
+        totalGB = 0,
+        expiryTime = 0,
+        tgId = '',
+        subId = RandomUtil.randomLowerAndNum(16),
+        comment = '',
+        reset = 0,
+        created_at = undefined,
+        updated_at = undefined,
+        resetSchedule = '', // 中文注释: 按日历的流量重置计划
+        upLimit = 0, // 中文注释: 上行限速(KB/s)，0 为沿用 speedLimit 或入站默认限速
+        downLimit = 0, // 中文注释: 下行限速(KB/s)，0 为沿用 speedLimit 或入站默认限速
+        speedSchedule = [], // 中文注释: 限速时段，时段内替代上面的限速
+        quotaAction = '', // 中文注释: 流量用尽后的处理方式，空为直接禁用
+        throttleSpeed = 0, // 中文注释: 流量用尽后的限速(KB/s)
+        throttleAllowance = 0, // 中文注释: 限速后再禁用前的额外流量(字节)
+        deviceLimit = 0, // 中文注释: 设备限制，0 为沿用入站设置
+        deviceMode = '', // 中文注释: 设备超限处理方式，空为沿用入站策略
+        trustedIps = [], // 中文注释: 信任的 IP 或 CIDR，不计入设备数
+    ) {
         super();
         this.user = user;
         this.pass = pass;
+        this.enable = enable;
+        this.limitIp = limitIp;
+        this.totalGB = totalGB;
+        this.expiryTime = expiryTime;
+        this.tgId = tgId;
+        this.subId = subId;
+        this.comment = comment;
+        this.reset = reset;
+        this.created_at = created_at;
+        this.updated_at = updated_at;
+        this.resetSchedule = resetSchedule;
+        this.upLimit = upLimit;
+        this.downLimit = downLimit;
+        this.speedSchedule = speedSchedule;
+        this.quotaAction = quotaAction;
+        this.throttleSpeed = throttleSpeed;
+        this.throttleAllowance = throttleAllowance;
+        this.deviceLimit = deviceLimit;
+        this.deviceMode = deviceMode;
+        this.trustedIps = trustedIps;
     }
 
     static fromJson(json = {}) {
-        return new Inbound.SocksSettings.SocksAccount(json.user, json.pass);
+        return new this(
+            json.email ?? json.user,
+            json.password ?? json.pass,
+            json.enable ?? true,
+            json.limitIp,
+            json.totalGB,
+            json.expiryTime,
+            json.tgId,
+            json.subId,
+            json.comment,
+            json.reset,
+            json.created_at,
+            json.updated_at,
+            json.resetSchedule ?? '',
+            json.upLimit ?? 0,
+            json.downLimit ?? 0,
+            json.speedSchedule ?? [],
+            json.quotaAction ?? '',
+            json.throttleSpeed ?? 0,
+            json.throttleAllowance ?? 0,
+            json.deviceLimit ?? 0,
+            json.deviceMode ?? '',
+            json.trustedIps ?? [],
+        );
+    }
+
+    toJson() {
+        return {
+            email: this.user,
+            password: this.pass,
+            enable: this.enable,
+            limitIp: this.limitIp,
+            totalGB: this.totalGB,
+            expiryTime: this.expiryTime,
+            tgId: this.tgId,
+            subId: this.subId,
+            comment: this.comment,
+            reset: this.reset,
+            created_at: this.created_at,
+            updated_at: this.updated_at,
+            resetSchedule: this.resetSchedule,
+            upLimit: this.upLimit,
+            downLimit: this.downLimit,
+            speedSchedule: this.speedSchedule,
+            quotaAction: this.quotaAction,
+            throttleSpeed: this.throttleSpeed,
+            throttleAllowance: this.throttleAllowance,
+            deviceLimit: this.deviceLimit,
+            deviceMode: this.deviceMode,
+            trustedIps: this.trustedIps,
+        };
     }
 };
 
@@ -2552,30 +2834,20 @@ Inbound.HttpSettings = class extends Inbound.Settings {
     static fromJson(json = {}) {
         return new Inbound.HttpSettings(
             Protocols.HTTP,
-            json.accounts.map(account => Inbound.HttpSettings.HttpAccount.fromJson(account)),
+            (json.clients ?? json.accounts ?? []).map(account => Inbound.HttpSettings.HttpAccount.fromJson(account)),
             json.allowTransparent,
         );
     }
 
     toJson() {
         return {
-            accounts: Inbound.HttpSettings.toJsonArray(this.accounts),
+            clients: Inbound.HttpSettings.toJsonArray(this.accounts),
             allowTransparent: this.allowTransparent,
         };
     }
 };
 
-Inbound.HttpSettings.HttpAccount = class extends XrayCommonClass {
-    constructor(user = RandomUtil.randomSeq(10), pass = RandomUtil.randomSeq(10)) {
-        super();
-        this.user = user;
-        this.pass = pass;
-    }
-
-    static fromJson(json = {}) {
-        return new Inbound.HttpSettings.HttpAccount(json.user, json.pass);
-    }
-};
+Inbound.HttpSettings.HttpAccount = class extends Inbound.SocksSettings.SocksAccount {};
 
 Inbound.WireguardSettings = class extends XrayCommonClass {
     constructor(
@@ -2583,7 +2855,8 @@ Inbound.WireguardSettings = class extends XrayCommonClass {
         mtu = 1420,
         secretKey = Wireguard.generateKeypair().privateKey,
         peers = [new Inbound.WireguardSettings.Peer()],
-        noKernelTun = false
+        noKernelTun = false,
+        clientDns = '1.1.1.1, 1.0.0.1',
     ) {
         super(protocol);
         this.mtu = mtu;
@@ -2591,6 +2864,7 @@ Inbound.WireguardSettings = class extends XrayCommonClass {
         this.pubKey = secretKey.length > 0 ? Wireguard.generateKeypair(secretKey).publicKey : '';
         this.peers = peers;
         this.noKernelTun = noKernelTun;
+        this.clientDns = clientDns;
     }
 
     addPeer() {
@@ -2606,8 +2880,9 @@ Inbound.WireguardSettings = class extends XrayCommonClass {
             Protocols.WIREGUARD,
             json.mtu,
             json.secretKey,
-            json.peers.map(peer => Inbound.WireguardSettings.Peer.fromJson(peer)),
+            (json.clients ?? json.peers ?? []).map(peer => Inbound.WireguardSettings.Peer.fromJson(peer)),
             json.noKernelTun,
+            json.clientDns,
         );
     }
 
@@ -2615,14 +2890,44 @@ Inbound.WireguardSettings = class extends XrayCommonClass {
         return {
             mtu: this.mtu ?? undefined,
             secretKey: this.secretKey,
-            peers: Inbound.WireguardSettings.Peer.toJsonArray(this.peers),
+            // 中文注释: 对端以 clients 保存，由面板在生成 Xray 配置时转换为 peers
+            clients: Inbound.WireguardSettings.Peer.toJsonArray(this.peers),
             noKernelTun: this.noKernelTun,
+            // 中文注释: 写入客户端 .conf 的 DNS，仅面板使用，不会写入 Xray 配置
+            clientDns: this.clientDns,
         };
     }
 };
 
 Inbound.WireguardSettings.Peer = class extends XrayCommonClass {
-    constructor(privateKey, publicKey, psk = '', allowedIPs = ['10.0.0.2/32'], keepAlive = 0) {
+    constructor(
+        privateKey,
+        publicKey,
+        psk = '',
+        allowedIPs = ['10.0.0.2/32'],
+        keepAlive = 0,
+        email = RandomUtil.randomLowerAndNum(8), // 中文注释: WireGuard 对端作为客户端管理，以下为客户端字段
+        enable = true,
+        limitIp = 0,
+        totalGB = 0,
+        expiryTime = 0,
+        tgId = '',
+        subId = RandomUtil.randomLowerAndNum(16),
+        comment = '',
+        reset = 0,
+        created_at = undefined,
+        updated_at = undefined,
+        resetSchedule = '', // 中文注释: 按日历的流量重置计划
+        upLimit = 0, // 中文注释: 上行限速(KB/s)，0 为沿用 speedLimit 或入站默认限速
+        downLimit = 0, // 中文注释: 下行限速(KB/s)，0 为沿用 speedLimit 或入站默认限速
+        speedSchedule = [], // 中文注释: 限速时段，时段内替代上面的限速
+        quotaAction = '', // 中文注释: 流量用尽后的处理方式，空为直接禁用
+        throttleSpeed = 0, // 中文注释: 流量用尽后的限速(KB/s)
+        throttleAllowance = 0, // 中文注释: 限速后再禁用前的额外流量(字节)
+        deviceLimit = 0, // 中文注释: 设备限制，0 为沿用入站设置
+        deviceMode = '', // 中文注释: 设备超限处理方式，空为沿用入站策略
+        trustedIps = [], // 中文注释: 信任的 IP 或 CIDR，不计入设备数
+    ) {
         super();
         this.privateKey = privateKey
         this.publicKey = publicKey;
@@ -2635,6 +2940,27 @@ Inbound.WireguardSettings.Peer = class extends XrayCommonClass {
         })
         this.allowedIPs = allowedIPs;
         this.keepAlive = keepAlive;
+        this.email = email;
+        this.enable = enable;
+        this.limitIp = limitIp;
+        this.totalGB = totalGB;
+        this.expiryTime = expiryTime;
+        this.tgId = tgId;
+        this.subId = subId;
+        this.comment = comment;
+        this.reset = reset;
+        this.created_at = created_at;
+        this.updated_at = updated_at;
+        this.resetSchedule = resetSchedule;
+        this.upLimit = upLimit;
+        this.downLimit = downLimit;
+        this.speedSchedule = speedSchedule;
+        this.quotaAction = quotaAction;
+        this.throttleSpeed = throttleSpeed;
+        this.throttleAllowance = throttleAllowance;
+        this.deviceLimit = deviceLimit;
+        this.deviceMode = deviceMode;
+        this.trustedIps = trustedIps;
     }
 
     static fromJson(json = {}) {
@@ -2643,7 +2969,28 @@ Inbound.WireguardSettings.Peer = class extends XrayCommonClass {
             json.publicKey,
             json.preSharedKey,
             json.allowedIPs,
-            json.keepAlive
+            json.keepAlive,
+            json.email,
+            json.enable ?? true,
+            json.limitIp,
+            json.totalGB,
+            json.expiryTime,
+            json.tgId,
+            json.subId,
+            json.comment,
+            json.reset,
+            json.created_at,
+            json.updated_at,
+            json.resetSchedule ?? '',
+            json.upLimit ?? 0,
+            json.downLimit ?? 0,
+            json.speedSchedule ?? [],
+            json.quotaAction ?? '',
+            json.throttleSpeed ?? 0,
+            json.throttleAllowance ?? 0,
+            json.deviceLimit ?? 0,
+            json.deviceMode ?? '',
+            json.trustedIps ?? [],
         );
     }
 
@@ -2657,6 +3004,27 @@ Inbound.WireguardSettings.Peer = class extends XrayCommonClass {
             preSharedKey: this.psk.length > 0 ? this.psk : undefined,
             allowedIPs: this.allowedIPs,
             keepAlive: this.keepAlive ?? undefined,
+            email: this.email,
+            enable: this.enable,
+            limitIp: this.limitIp,
+            totalGB: this.totalGB,
+            expiryTime: this.expiryTime,
+            tgId: this.tgId,
+            subId: this.subId,
+            comment: this.comment,
+            reset: this.reset,
+            created_at: this.created_at,
+            updated_at: this.updated_at,
+            resetSchedule: this.resetSchedule,
+            upLimit: this.upLimit,
+            downLimit: this.downLimit,
+            speedSchedule: this.speedSchedule,
+            quotaAction: this.quotaAction,
+            throttleSpeed: this.throttleSpeed,
+            throttleAllowance: this.throttleAllowance,
+            deviceLimit: this.deviceLimit,
+            deviceMode: this.deviceMode,
+            trustedIps: this.trustedIps,
         };
     }
 };
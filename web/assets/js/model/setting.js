@@ -11,6 +11,15 @@ class AllSetting {
         this.pageSize = 50;
         this.expireDiff = 0;
         this.trafficDiff = 0;
+        this.trafficHourlyDays = 7;
+        this.trafficDailyDays = 365;
+        this.deviceIpv4Prefix = 32;
+        this.deviceIpv6Prefix = 64;
+        this.deviceMinSightings = 1;
+        this.ipLimitBackend = "auto";
+        this.ipLimitBanTime = 30;
+        this.ipLimitKeepBans = false;
+        this.speedLevelPresets = "256,512,1024,2048,5120,10240,20480,51200,102400";
         this.remarkModel = "-ieo";
         this.datepicker = "gregorian";
         this.tgBotEnable = false;
@@ -23,6 +32,11 @@ class AllSetting {
         this.tgBotLoginNotify = true;
         this.tgCpu = 80;
         this.tgLang = "zh-CN";
+        this.tgReportPeriod = "";
+        this.tgReportFormat = "xlsx";
+        this.usageAlertTraffic = "";
+        this.usageAlertExpiry = "";
+        this.usageAlertAdmins = false;
         this.twoFactorEnable = false;
         this.twoFactorToken = "";
         this.xrayTemplateConfig = "";
@@ -36,13 +50,13 @@ class AllSetting {
         this.subUpdates = 12;
         this.subEncrypt = true;
         this.subShowInfo = true;
+        this.subPlaceholder = false;
         this.subURI = "";
         this.subJsonURI = "";
         this.subJsonFragment = "";
         this.subJsonNoises = "";
         this.subJsonMux = "";
         this.subJsonRules = "";
-        this.subTotalId = "";
 
         this.timeLocation = "Local";
 
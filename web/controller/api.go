@@ -1,7 +1,6 @@
 package controller
 
 import (
-	"x-ui/sub"
 	"x-ui/web/service"
 
 	"github.com/gin-gonic/gin"
@@ -9,9 +8,17 @@ import (
 
 type APIController struct {
 	BaseController
-	inboundController *InboundController
-	serverController  *ServerController
-	Tgbot             service.Tgbot
+	inboundController  *InboundController
+	serverController   *ServerController
+	subGroupController *SubGroupController
+	profileController  *SubJsonProfileController
+	templateController *SubTemplateController
+	trafficController  *TrafficController
+	reportController   *ReportController
+	alertController    *UsageAlertController
+	deviceController   *DeviceLimitController
+	ipLimitController  *IpLimitController
+	Tgbot              service.Tgbot
 }
 
 func NewAPIController(g *gin.RouterGroup) *APIController {
@@ -33,9 +40,37 @@ func (a *APIController) initRouter(g *gin.RouterGroup) {
 	server := api.Group("/server")
 	a.serverController = NewServerController(server)
 
-	// Subscription API
-	sub := api.Group("/sub")
-	sub.GET("/total-id", a.getTotalSubscriptionId)
+	// Subscription groups API
+	subGroups := api.Group("/subGroups")
+	a.subGroupController = NewSubGroupController(subGroups)
+
+	// JSON subscription profiles API
+	profiles := api.Group("/subJsonProfiles")
+	a.profileController = NewSubJsonProfileController(profiles)
+
+	// Subscription templates API
+	templates := api.Group("/subTemplates")
+	a.templateController = NewSubTemplateController(templates)
+
+	// Traffic history API
+	traffic := api.Group("/traffic")
+	a.trafficController = NewTrafficController(traffic)
+
+	// Usage reports API
+	reports := api.Group("/reports")
+	a.reportController = NewReportController(reports)
+
+	// Usage alert templates API
+	alerts := api.Group("/usageAlerts")
+	a.alertController = NewUsageAlertController(alerts)
+
+	// Device limit bans API
+	deviceLimit := api.Group("/deviceLimit")
+	a.deviceController = NewDeviceLimitController(deviceLimit)
+
+	// IP limit firewall API
+	ipLimit := api.Group("/ipLimit")
+	a.ipLimitController = NewIpLimitController(ipLimit)
 
 	// Extra routes
 	api.GET("/backuptotgbot", a.BackuptoTgbot)
@@ -45,27 +80,3 @@ func (a *APIController) BackuptoTgbot(c *gin.Context) {
 	a.Tgbot.SendBackupToAdmins()
 	jsonObj(c, "", nil)
 }
-
-func (a *APIController) getTotalSubscriptionId(c *gin.Context) {
-	subService := sub.NewSubService(false, "")
-	
-	// 检查是否有 generate 参数
-	generateNew := c.Query("generate")
-	
-	var totalId string
-	var err error
-	
-	if generateNew == "true" {
-		// 生成新的总订阅ID
-		totalId, err = subService.GenerateNewTotalSubscriptionId()
-	} else {
-		// 只获取现有的ID，不自动生成
-		totalId, err = subService.GetTotalSubscriptionId()
-	}
-	
-	if err != nil {
-		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain", "Total Subscription ID"), err)
-		return
-	}
-	jsonObj(c, totalId, nil)
-}
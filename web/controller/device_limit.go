@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"strconv"
+
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeviceLimitController struct {
+	deviceLimitService service.DeviceLimitService
+}
+
+func NewDeviceLimitController(g *gin.RouterGroup) *DeviceLimitController {
+	a := &DeviceLimitController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *DeviceLimitController) initRouter(g *gin.RouterGroup) {
+	g.GET("/bans", a.getBans)
+	g.GET("/exemptions", a.getExemptions)
+	g.GET("/logs", a.getLogs)
+
+	g.POST("/unban", a.unban)
+	g.POST("/exempt", a.exempt)
+	g.POST("/exemptions/del", a.delExemption)
+}
+
+// getBans 中文注释: 当前封禁的客户端，附带封禁时间和仍在线的 IP。
+func (a *DeviceLimitController) getBans(c *gin.Context) {
+	bans, err := a.deviceLimitService.GetBanDetails()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, bans, nil)
+}
+
+func (a *DeviceLimitController) getExemptions(c *gin.Context) {
+	exemptions, err := a.deviceLimitService.GetExemptions()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, exemptions, nil)
+}
+
+// getLogs 中文注释: 封禁历史，可用 email 参数筛选客户端，limit 参数限制条数。
+func (a *DeviceLimitController) getLogs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	logs, err := a.deviceLimitService.GetBanLogs(c.Query("email"), limit)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, logs, nil)
+}
+
+// unban 中文注释: 手动解封客户端，minutes 大于 0 时同时豁免 minutes 分钟。
+func (a *DeviceLimitController) unban(c *gin.Context) {
+	minutes, _ := strconv.Atoi(c.PostForm("minutes"))
+	err := a.deviceLimitService.UnbanClient(c.PostForm("email"), minutes)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.deviceLimit.toasts.unbanSuccess"), nil)
+}
+
+// exempt 中文注释: 豁免客户端 minutes 分钟，期间不因设备数超限被封禁。
+func (a *DeviceLimitController) exempt(c *gin.Context) {
+	minutes, _ := strconv.Atoi(c.PostForm("minutes"))
+	err := a.deviceLimitService.ExemptClient(c.PostForm("email"), minutes)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.deviceLimit.toasts.exemptSuccess"), nil)
+}
+
+func (a *DeviceLimitController) delExemption(c *gin.Context) {
+	err := a.deviceLimitService.DelExemption(c.PostForm("email"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.deviceLimit.toasts.delExemptionSuccess"), nil)
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"strconv"
 
 	"x-ui/database/model"
@@ -28,6 +29,8 @@ func (a *InboundController) initRouter(g *gin.RouterGroup) {
 	g.GET("/get/:id", a.getInbound)
 	g.GET("/getClientTraffics/:email", a.getClientTraffics)
 	g.GET("/getClientTrafficsById/:id", a.getClientTrafficsById)
+	g.GET("/wireguardConf/:email", a.getWireguardConf)
+	g.GET("/speedLimit/:email", a.getClientSpeedLimit)
 
 	g.POST("/add", a.addInbound)
 	g.POST("/del/:id", a.delInbound)
@@ -91,6 +94,32 @@ func (a *InboundController) getClientTrafficsById(c *gin.Context) {
 	jsonObj(c, clientTraffics, nil)
 }
 
+// getWireguardConf 中文注释: 下载 WireGuard 客户端的 .conf 配置文件，内容同样可用于生成二维码。
+// getClientSpeedLimit 中文注释: 查询客户端实际生效的上下行限速，单位 KB/s，0 表示不限速
+func (a *InboundController) getClientSpeedLimit(c *gin.Context) {
+	limit, err := a.inboundService.GetClientSpeedLimit(c.Param("email"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, limit, nil)
+}
+
+func (a *InboundController) getWireguardConf(c *gin.Context) {
+	email := c.Param("email")
+	host, _, err := net.SplitHostPort(c.Request.Host)
+	if err != nil {
+		host = c.Request.Host
+	}
+	conf, err := a.inboundService.GetWireguardConfig(email, host)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", email+".conf"))
+	c.Data(200, "text/plain; charset=utf-8", []byte(conf))
+}
+
 func (a *InboundController) addInbound(c *gin.Context) {
 	inbound := &model.Inbound{}
 	err := c.ShouldBind(inbound)
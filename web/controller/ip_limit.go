@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"strconv"
+	"time"
+
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IpLimitController struct {
+	ipFirewallService service.IpFirewallService
+}
+
+func NewIpLimitController(g *gin.RouterGroup) *IpLimitController {
+	a := &IpLimitController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *IpLimitController) initRouter(g *gin.RouterGroup) {
+	g.GET("/bans", a.getBans)
+
+	g.POST("/ban", a.ban)
+	g.POST("/unban", a.unban)
+}
+
+// getBans 中文注释: 当前使用的执行方式，以及内置防火墙中被封禁的 IP 和到期时间。
+func (a *IpLimitController) getBans(c *gin.Context) {
+	backend := a.ipFirewallService.GetBackend()
+	result := gin.H{"backend": backend, "ips": []service.IpFirewallEntry{}}
+	if backend == service.IpLimitBackendNftables || backend == service.IpLimitBackendIpset {
+		ips, err := a.ipFirewallService.GetBannedIPs()
+		if err != nil {
+			jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+			return
+		}
+		result["ips"] = ips
+	}
+	jsonObj(c, result, nil)
+}
+
+// ban 中文注释: 手动封禁 IP minutes 分钟，0 表示直到解封或面板退出。
+func (a *IpLimitController) ban(c *gin.Context) {
+	minutes, _ := strconv.Atoi(c.PostForm("minutes"))
+	err := a.ipFirewallService.BanIP(c.PostForm("ip"), time.Duration(minutes)*time.Minute)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.ipLimit.toasts.banSuccess"), nil)
+}
+
+func (a *IpLimitController) unban(c *gin.Context) {
+	err := a.ipFirewallService.UnbanIP(c.PostForm("ip"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.ipLimit.toasts.unbanSuccess"), nil)
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReportController struct {
+	reportService service.ReportService
+}
+
+func NewReportController(g *gin.RouterGroup) *ReportController {
+	a := &ReportController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *ReportController) initRouter(g *gin.RouterGroup) {
+	g.GET("/usage", a.getUsage)
+	g.GET("/usage/:format", a.exportUsage)
+}
+
+// getRange 中文注释: 读取 from/to 查询参数(毫秒时间戳)，缺省为本月开始到当前。
+func (a *ReportController) getRange(c *gin.Context) (int64, int64) {
+	from, to := a.reportService.GetCurrentMonth()
+	if value, err := strconv.ParseInt(c.Query("from"), 10, 64); err == nil {
+		from = value
+	}
+	if value, err := strconv.ParseInt(c.Query("to"), 10, 64); err == nil {
+		to = value
+	}
+	return from, to
+}
+
+func (a *ReportController) getUsage(c *gin.Context) {
+	from, to := a.getRange(c)
+	rows, err := a.reportService.GetUsageReport(from, to)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, rows, nil)
+}
+
+// exportUsage 中文注释: 以 csv 或 xlsx 附件形式导出用量报表。
+func (a *ReportController) exportUsage(c *gin.Context) {
+	format := c.Param("format")
+	from, to := a.getRange(c)
+	name, data, err := a.reportService.ExportUsageReport(format, from, to)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	contentType := "text/csv; charset=utf-8"
+	if format == service.ReportFormatXLSX {
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	c.Data(200, contentType, data)
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"strconv"
+
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SubGroupController struct {
+	subGroupService service.SubGroupService
+}
+
+func NewSubGroupController(g *gin.RouterGroup) *SubGroupController {
+	a := &SubGroupController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *SubGroupController) initRouter(g *gin.RouterGroup) {
+	g.GET("/list", a.getSubGroups)
+	g.GET("/get/:id", a.getSubGroup)
+
+	g.POST("/add", a.addSubGroup)
+	g.POST("/del/:id", a.delSubGroup)
+	g.POST("/update/:id", a.updateSubGroup)
+}
+
+func (a *SubGroupController) getSubGroups(c *gin.Context) {
+	groups, err := a.subGroupService.GetSubGroups()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, groups, nil)
+}
+
+func (a *SubGroupController) getSubGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	group, err := a.subGroupService.GetSubGroup(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, group, nil)
+}
+
+func (a *SubGroupController) addSubGroup(c *gin.Context) {
+	group := &model.SubGroup{}
+	err := c.ShouldBind(group)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	group, err = a.subGroupService.AddSubGroup(group)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.subGroups.toasts.addSuccess"), group, nil)
+}
+
+func (a *SubGroupController) delSubGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	err = a.subGroupService.DelSubGroup(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.subGroups.toasts.deleteSuccess"), id, nil)
+}
+
+func (a *SubGroupController) updateSubGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	group := &model.SubGroup{
+		Id: id,
+	}
+	err = c.ShouldBind(group)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	group.Id = id
+	group, err = a.subGroupService.UpdateSubGroup(group)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.subGroups.toasts.updateSuccess"), group, nil)
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"strconv"
+
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SubJsonProfileController struct {
+	profileService service.SubJsonProfileService
+}
+
+func NewSubJsonProfileController(g *gin.RouterGroup) *SubJsonProfileController {
+	a := &SubJsonProfileController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *SubJsonProfileController) initRouter(g *gin.RouterGroup) {
+	g.GET("/list", a.getProfiles)
+	g.GET("/get/:id", a.getProfile)
+
+	g.POST("/add", a.addProfile)
+	g.POST("/del/:id", a.delProfile)
+	g.POST("/update/:id", a.updateProfile)
+}
+
+func (a *SubJsonProfileController) getProfiles(c *gin.Context) {
+	profiles, err := a.profileService.GetProfiles()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, profiles, nil)
+}
+
+func (a *SubJsonProfileController) getProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	profile, err := a.profileService.GetProfile(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, profile, nil)
+}
+
+func (a *SubJsonProfileController) addProfile(c *gin.Context) {
+	profile := &model.SubJsonProfile{}
+	err := c.ShouldBind(profile)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	profile, err = a.profileService.AddProfile(profile)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.subJsonProfiles.toasts.addSuccess"), profile, nil)
+}
+
+func (a *SubJsonProfileController) delProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	err = a.profileService.DelProfile(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.subJsonProfiles.toasts.deleteSuccess"), id, nil)
+}
+
+func (a *SubJsonProfileController) updateProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	profile := &model.SubJsonProfile{
+		Id: id,
+	}
+	err = c.ShouldBind(profile)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	profile.Id = id
+	profile, err = a.profileService.UpdateProfile(profile)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.subJsonProfiles.toasts.updateSuccess"), profile, nil)
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"strconv"
+
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SubTemplateController struct {
+	templateService service.SubTemplateService
+}
+
+func NewSubTemplateController(g *gin.RouterGroup) *SubTemplateController {
+	a := &SubTemplateController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *SubTemplateController) initRouter(g *gin.RouterGroup) {
+	g.GET("/list", a.getSubTemplates)
+	g.GET("/get/:id", a.getSubTemplate)
+
+	g.POST("/add", a.addSubTemplate)
+	g.POST("/del/:id", a.delSubTemplate)
+	g.POST("/update/:id", a.updateSubTemplate)
+}
+
+func (a *SubTemplateController) getSubTemplates(c *gin.Context) {
+	templates, err := a.templateService.GetSubTemplates()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, templates, nil)
+}
+
+func (a *SubTemplateController) getSubTemplate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	tpl, err := a.templateService.GetSubTemplate(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, tpl, nil)
+}
+
+func (a *SubTemplateController) addSubTemplate(c *gin.Context) {
+	tpl := &model.SubTemplate{}
+	err := c.ShouldBind(tpl)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	tpl, err = a.templateService.AddSubTemplate(tpl)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.subTemplates.toasts.addSuccess"), tpl, nil)
+}
+
+func (a *SubTemplateController) delSubTemplate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	err = a.templateService.DelSubTemplate(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.subTemplates.toasts.deleteSuccess"), id, nil)
+}
+
+func (a *SubTemplateController) updateSubTemplate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	tpl := &model.SubTemplate{
+		Id: id,
+	}
+	err = c.ShouldBind(tpl)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	tpl.Id = id
+	tpl, err = a.templateService.UpdateSubTemplate(tpl)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.subTemplates.toasts.updateSuccess"), tpl, nil)
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"strconv"
+
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TrafficController struct {
+	trafficHistoryService service.TrafficHistoryService
+	inboundService        service.InboundService
+}
+
+func NewTrafficController(g *gin.RouterGroup) *TrafficController {
+	a := &TrafficController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *TrafficController) initRouter(g *gin.RouterGroup) {
+	g.GET("/history", a.getHistory)
+	g.GET("/archives", a.getArchives)
+}
+
+// getHistory 中文注释: 查询流量曲线，参数 kind、name、interval、from、to 见 TrafficHistoryService.GetHistory。
+func (a *TrafficController) getHistory(c *gin.Context) {
+	from, _ := strconv.ParseInt(c.Query("from"), 10, 64)
+	to, _ := strconv.ParseInt(c.Query("to"), 10, 64)
+	points, err := a.trafficHistoryService.GetHistory(c.Query("kind"), c.Query("name"), c.Query("interval"), from, to)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, points, nil)
+}
+
+// getArchives 中文注释: 查询按重置计划归档的计费周期用量，可用 email 参数筛选客户端。
+func (a *TrafficController) getArchives(c *gin.Context) {
+	archives, err := a.inboundService.GetUsageArchives(c.Query("email"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, archives, nil)
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"strconv"
+
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UsageAlertController struct {
+	usageAlertService service.UsageAlertService
+}
+
+func NewUsageAlertController(g *gin.RouterGroup) *UsageAlertController {
+	a := &UsageAlertController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *UsageAlertController) initRouter(g *gin.RouterGroup) {
+	g.GET("/templates", a.getTemplates)
+
+	g.POST("/templates/save", a.saveTemplate)
+	g.POST("/templates/del/:id", a.delTemplate)
+}
+
+func (a *UsageAlertController) getTemplates(c *gin.Context) {
+	templates, err := a.usageAlertService.GetTemplates()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, templates, nil)
+}
+
+// saveTemplate 中文注释: 保存某语言(lang，同 tgLang)和类型(kind 为 traffic/expiry)的提醒模板，已存在时覆盖。
+func (a *UsageAlertController) saveTemplate(c *gin.Context) {
+	tpl := &model.UsageAlertTemplate{}
+	err := c.ShouldBind(tpl)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	err = a.usageAlertService.SaveTemplate(tpl)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.usageAlerts.toasts.saveSuccess"), nil)
+}
+
+func (a *UsageAlertController) delTemplate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	err = a.usageAlertService.DelTemplate(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.usageAlerts.toasts.deleteSuccess"), id, nil)
+}
@@ -27,6 +27,15 @@ type AllSetting struct {
 	PageSize                    int    `json:"pageSize" form:"pageSize"`
 	ExpireDiff                  int    `json:"expireDiff" form:"expireDiff"`
 	TrafficDiff                 int    `json:"trafficDiff" form:"trafficDiff"`
+	TrafficHourlyDays           int    `json:"trafficHourlyDays" form:"trafficHourlyDays"`
+	TrafficDailyDays            int    `json:"trafficDailyDays" form:"trafficDailyDays"`
+	DeviceIpv4Prefix            int    `json:"deviceIpv4Prefix" form:"deviceIpv4Prefix"`
+	DeviceIpv6Prefix            int    `json:"deviceIpv6Prefix" form:"deviceIpv6Prefix"`
+	DeviceMinSightings          int    `json:"deviceMinSightings" form:"deviceMinSightings"`
+	IpLimitBackend              string `json:"ipLimitBackend" form:"ipLimitBackend"`
+	IpLimitBanTime              int    `json:"ipLimitBanTime" form:"ipLimitBanTime"`
+	IpLimitKeepBans             bool   `json:"ipLimitKeepBans" form:"ipLimitKeepBans"`
+	SpeedLevelPresets           string `json:"speedLevelPresets" form:"speedLevelPresets"`
 	RemarkModel                 string `json:"remarkModel" form:"remarkModel"`
 	TgBotEnable                 bool   `json:"tgBotEnable" form:"tgBotEnable"`
 	TgBotToken                  string `json:"tgBotToken" form:"tgBotToken"`
@@ -38,6 +47,11 @@ type AllSetting struct {
 	TgBotLoginNotify            bool   `json:"tgBotLoginNotify" form:"tgBotLoginNotify"`
 	TgCpu                       int    `json:"tgCpu" form:"tgCpu"`
 	TgLang                      string `json:"tgLang" form:"tgLang"`
+	TgReportPeriod              string `json:"tgReportPeriod" form:"tgReportPeriod"`
+	TgReportFormat              string `json:"tgReportFormat" form:"tgReportFormat"`
+	UsageAlertTraffic           string `json:"usageAlertTraffic" form:"usageAlertTraffic"`
+	UsageAlertExpiry            string `json:"usageAlertExpiry" form:"usageAlertExpiry"`
+	UsageAlertAdmins            bool   `json:"usageAlertAdmins" form:"usageAlertAdmins"`
 	TimeLocation                string `json:"timeLocation" form:"timeLocation"`
 	TwoFactorEnable             bool   `json:"twoFactorEnable" form:"twoFactorEnable"`
 	TwoFactorToken              string `json:"twoFactorToken" form:"twoFactorToken"`
@@ -50,6 +64,7 @@ type AllSetting struct {
 	ExternalTrafficInformURI    string `json:"externalTrafficInformURI" form:"externalTrafficInformURI"`
 	SubEncrypt                  bool   `json:"subEncrypt" form:"subEncrypt"`
 	SubShowInfo                 bool   `json:"subShowInfo" form:"subShowInfo"`
+	SubPlaceholder              bool   `json:"subPlaceholder" form:"subPlaceholder"`
 	SubURI                      string `json:"subURI" form:"subURI"`
 	SubJsonPath                 string `json:"subJsonPath" form:"subJsonPath"`
 	SubJsonURI                  string `json:"subJsonURI" form:"subJsonURI"`
@@ -57,7 +72,6 @@ type AllSetting struct {
 	SubJsonNoises               string `json:"subJsonNoises" form:"subJsonNoises"`
 	SubJsonMux                  string `json:"subJsonMux" form:"subJsonMux"`
 	SubJsonRules                string `json:"subJsonRules" form:"subJsonRules"`
-	SubTotalId                  string `json:"subTotalId" form:"subTotalId"`
 	Datepicker                  string `json:"datepicker" form:"datepicker"`
 }
 
@@ -105,5 +119,47 @@ func (s *AllSetting) CheckValid() error {
 		return common.NewError("time location not exist:", s.TimeLocation)
 	}
 
+	trafficThresholds, err := common.ParseIntList(s.UsageAlertTraffic)
+	if err != nil {
+		return common.NewError("usage alert traffic thresholds invalid:", err)
+	}
+	if len(trafficThresholds) > 0 && trafficThresholds[len(trafficThresholds)-1] > 100 {
+		return common.NewError("usage alert traffic threshold must not exceed 100:", s.UsageAlertTraffic)
+	}
+	if _, err = common.ParseIntList(s.UsageAlertExpiry); err != nil {
+		return common.NewError("usage alert expiry thresholds invalid:", err)
+	}
+
+	if s.TrafficHourlyDays < 0 || s.TrafficDailyDays < 0 {
+		return common.NewError("traffic history retention must not be negative")
+	}
+
+	if s.DeviceIpv4Prefix < 1 || s.DeviceIpv4Prefix > 32 {
+		return common.NewError("device IPv4 prefix must be between 1 and 32:", s.DeviceIpv4Prefix)
+	}
+	if s.DeviceIpv6Prefix < 1 || s.DeviceIpv6Prefix > 128 {
+		return common.NewError("device IPv6 prefix must be between 1 and 128:", s.DeviceIpv6Prefix)
+	}
+	if s.DeviceMinSightings < 1 {
+		return common.NewError("device minimum sightings must be at least 1:", s.DeviceMinSightings)
+	}
+
+	switch s.IpLimitBackend {
+	case "auto", "fail2ban", "nftables", "ipset":
+	default:
+		return common.NewError("invalid IP limit backend:", s.IpLimitBackend)
+	}
+	if s.IpLimitBanTime < 0 {
+		return common.NewError("IP limit ban time must not be negative:", s.IpLimitBanTime)
+	}
+
+	speedPresets, err := common.ParseIntList(s.SpeedLevelPresets)
+	if err != nil {
+		return common.NewError("speed level presets invalid:", err)
+	}
+	if len(speedPresets) > 20 {
+		return common.NewError("too many speed level presets:", len(speedPresets))
+	}
+
 	return nil
 }
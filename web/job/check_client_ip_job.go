@@ -5,10 +5,11 @@ import (
 	"encoding/json"
 	"io"
 	"log"
+	"net"
 	"os"
-	"os/exec"
 	"regexp"
 	"sort"
+	"strings"
 	"time"
 	"sync"
 	"crypto/rand"
@@ -28,11 +29,16 @@ import (
 
 // ActiveClientIPs 中文注释: 用于在内存中跟踪每个用户的活跃IP (TTL机制)
 // 结构: map[用户email] -> map[IP地址] -> 最后活跃时间
+// 同时写入数据库(DeviceIpSighting)，面板重启后从数据库恢复
 var ActiveClientIPs = make(map[string]map[string]time.Time)
 var activeClientsLock sync.RWMutex
 
+// ipFirstSeen 中文注释: 活跃IP首次出现的时间，kickOldest 策略据此阻断最早上线的设备，与 ActiveClientIPs 共用锁
+var ipFirstSeen = make(map[string]map[string]time.Time)
+
 // ClientStatus 中文注释: 用于跟踪每个用户的状态（是否因为设备超限而被禁用）
 // 结构: map[用户email] -> 是否被禁用(true/false)
+// 封禁状态同时写入数据库(DeviceBan)，面板重启后从数据库恢复
 var ClientStatus = make(map[string]bool)
 var clientStatusLock sync.RWMutex
 
@@ -40,12 +46,30 @@ var clientStatusLock sync.RWMutex
 type CheckDeviceLimitJob struct {
 	inboundService service.InboundService
 	xrayService    *service.XrayService
-	// 中文注释: 新增 xrayApi 字段，用于持有 Xray API 客户端实例
-	xrayApi xray.XrayAPI
+	// 中文注释: 封禁、解封和阻断操作提交到 worker 异步执行，检测过程不调用 Xray API
+	worker *deviceLimitWorker
 	// lastPosition 中文注释: 用于记录上次读取 access.log 的位置，避免重复读取
 	lastPosition int64
                  // 〔中文注释〕: 注入 Telegram 服务用于发送通知，确保此行存在。
 	telegramService   service.TelegramService
+	// 中文注释: 持久化封禁状态和IP活跃记录；restored 表示是否已从数据库恢复
+	deviceLimitService service.DeviceLimitService
+	restored           bool
+	// 中文注释: overSince 记录超限开始时间(宽限期)，notified 记录仅通知模式本次超限是否已通知，
+	// kicked 记录 kickOldest 策略当前阻断的 IP
+	overSince  map[string]time.Time
+	notified   map[string]bool
+	kicked     map[string][]string
+	kickedLock sync.Mutex
+	// 中文注释: 设备计数的网段前缀等设置；pending 记录出现次数尚未达到最少次数的IP(网段)
+	settingService service.SettingService
+	pending        map[string]map[string]*ipSighting
+}
+
+// ipSighting 中文注释: 尚未计为活跃设备的IP(网段)的出现次数和最后出现时间
+type ipSighting struct {
+	count    int
+	lastSeen time.Time
 }
 
 // RandomUUID 中文注释: 新增一个辅助函数，用于生成一个随机的 UUID
@@ -60,13 +84,17 @@ func RandomUUID() string {
 // NewCheckDeviceLimitJob 中文注释: 创建一个新的任务实例
 // 〔中文注释〕：增加一个 service.TelegramService 类型的参数。
 func NewCheckDeviceLimitJob(xrayService *service.XrayService, telegramService service.TelegramService) *CheckDeviceLimitJob {
-	return &CheckDeviceLimitJob{
+	j := &CheckDeviceLimitJob{
 		xrayService: xrayService,
-		// 中文注释: 初始化 xrayApi 字段
-		xrayApi: xray.XrayAPI{},
                                  // 〔中文注释〕: 将传入的 telegramService 赋值给结构体实例。
 		telegramService: telegramService,
+		overSince:       make(map[string]time.Time),
+		notified:        make(map[string]bool),
+		kicked:          make(map[string][]string),
+		pending:         make(map[string]map[string]*ipSighting),
 	}
+	j.worker = newDeviceLimitWorker(j.runAction)
+	return j
 }
 
 // Run 中文注释: 定时任务的主函数，每次定时器触发时执行
@@ -76,14 +104,60 @@ func (j *CheckDeviceLimitJob) Run() {
 		return
 	}
 
+	// 0. 首次运行时从数据库恢复封禁状态和活跃IP
+	if !j.restored {
+		j.restoreState()
+	}
+
 	// 1. 清理过期的IP
 	j.cleanupExpiredIPs()
 
-	// 2. 解析新的日志并更新IP列表
-	j.parseAccessLog()
+	// 2. 获取在线IP：优先查询 Xray 的在线IP统计，旧版本 Xray 不支持时解析新的日志
+	limits := j.loadDeviceLimits()
+	if !j.collectOnlineIps(limits) {
+		j.parseAccessLog()
+	}
 
 	// 3. 检查所有用户的设备限制状态
-	j.checkAllClientsLimit()
+	j.checkAllClientsLimit(limits)
+}
+
+// restoreState 中文注释: 从数据库恢复仍在 TTL 内的活跃IP和封禁状态。
+// 已恢复的IP不需要重新读取旧日志，因此从 access.log 的末尾开始增量读取。
+func (j *CheckDeviceLimitJob) restoreState() {
+	sightings, err := j.deviceLimitService.GetSightings(time.Now().Add(-service.DeviceActiveTTL))
+	if err != nil {
+		logger.Warning("〔设备限制〕恢复活跃IP失败:", err)
+		return
+	}
+	firstSeen, err := j.deviceLimitService.GetFirstSeen(time.Now().Add(-service.DeviceActiveTTL))
+	if err != nil {
+		logger.Warning("〔设备限制〕恢复活跃IP失败:", err)
+		return
+	}
+	bans, err := j.deviceLimitService.GetBans()
+	if err != nil {
+		logger.Warning("〔设备限制〕恢复封禁状态失败:", err)
+		return
+	}
+
+	activeClientsLock.Lock()
+	ActiveClientIPs = sightings
+	ipFirstSeen = firstSeen
+	activeClientsLock.Unlock()
+
+	clientStatusLock.Lock()
+	ClientStatus = make(map[string]bool, len(bans))
+	for _, ban := range bans {
+		ClientStatus[ban.Email] = true
+	}
+	clientStatusLock.Unlock()
+
+	j.skipAccessLog()
+	j.restored = true
+	if len(bans) > 0 {
+		logger.Infof("〔设备限制〕已从数据库恢复 %d 个封禁用户", len(bans))
+	}
 }
 
 // cleanupExpiredIPs 中文注释: 清理长时间不活跃的IP
@@ -92,18 +166,35 @@ func (j *CheckDeviceLimitJob) cleanupExpiredIPs() {
 	defer activeClientsLock.Unlock()
 
 	now := time.Now()
-	// 中文注释: 活跃判断窗口(TTL): 近3分钟内出现过就算“活跃”
-	const activeTTL = 3 * time.Minute
+	if err := j.deviceLimitService.DeleteSightingsBefore(now.Add(-service.DeviceActiveTTL)); err != nil {
+		logger.Warning("〔设备限制〕清理过期IP记录失败:", err)
+	}
+	if err := j.deviceLimitService.DeleteExpiredExemptions(); err != nil {
+		logger.Warning("〔设备限制〕清理过期豁免失败:", err)
+	}
 	for email, ips := range ActiveClientIPs {
 		for ip, lastSeen := range ips {
 			// 中文注释: 如果一个IP超过3分钟没有新的连接日志，我们就认为它已经下线
-			if now.Sub(lastSeen) > activeTTL {
+			if now.Sub(lastSeen) > service.DeviceActiveTTL {
 				delete(ActiveClientIPs[email], ip)
+				delete(ipFirstSeen[email], ip)
 			}
 		}
 		// 中文注释: 如果一个用户的所有IP都下线了，就从大Map中移除这个用户，节省内存
 		if len(ActiveClientIPs[email]) == 0 {
 			delete(ActiveClientIPs, email)
+			delete(ipFirstSeen, email)
+		}
+	}
+	// 中文注释: 在活跃窗口内没有达到最少出现次数的IP重新计数
+	for email, ips := range j.pending {
+		for ip, sighting := range ips {
+			if now.Sub(sighting.lastSeen) > service.DeviceActiveTTL {
+				delete(ips, ip)
+			}
+		}
+		if len(ips) == 0 {
+			delete(j.pending, email)
 		}
 	}
 }
@@ -130,10 +221,11 @@ func (j *CheckDeviceLimitJob) parseAccessLog() {
 	emailRegex := regexp.MustCompile(`email: ([^ ]+)`)
 	ipRegex := regexp.MustCompile(`from (?:tcp:|udp:)?\[?([0-9a-fA-F\.:]+)\]?:\d+ accepted`)
 
+	recorder := j.newSightingRecorder()
+
 	activeClientsLock.Lock()
 	defer activeClientsLock.Unlock()
 
-	now := time.Now()
 	for scanner.Scan() {
 		line := scanner.Text()
 		
@@ -141,19 +233,10 @@ func (j *CheckDeviceLimitJob) parseAccessLog() {
 		ipMatch := ipRegex.FindStringSubmatch(line)
 
 		if len(emailMatch) > 1 && len(ipMatch) > 1 {
-			email := emailMatch[1]
-			ip := ipMatch[1]
-
-			if ip == "127.0.0.1" || ip == "::1" {
-				continue
-			}
-
-			if _, ok := ActiveClientIPs[email]; !ok {
-				ActiveClientIPs[email] = make(map[string]time.Time)
-			}
-			ActiveClientIPs[email][ip] = now
+			recorder.record(emailMatch[1], ipMatch[1])
 		}
 	}
+	recorder.save()
 
 	currentPosition, err := file.Seek(0, os.SEEK_END)
 	if err == nil {
@@ -165,14 +248,233 @@ func (j *CheckDeviceLimitJob) parseAccessLog() {
 	}
 }
 
-// checkAllClientsLimit 中文注释: 核心功能，检查所有用户，对超限的执行封禁，对恢复的执行解封
-func (j *CheckDeviceLimitJob) checkAllClientsLimit() {
+// skipAccessLog 中文注释: 把 access.log 的读取位置移到末尾，之后改为解析日志时不会把旧记录当作新的活跃IP
+func (j *CheckDeviceLimitJob) skipAccessLog() {
+	if logPath, err := xray.GetAccessLogPath(); err == nil && logPath != "none" && logPath != "" {
+		if info, err := os.Stat(logPath); err == nil {
+			j.lastPosition = info.Size()
+		}
+	}
+}
+
+// collectOnlineIps 中文注释: 通过 Xray 的在线IP统计(statsUserOnline)获取受限用户的在线IP，无需开启访问日志。
+// 返回 false 表示无法使用统计接口(API未就绪或旧版本 Xray)，需要改为解析日志。
+func (j *CheckDeviceLimitJob) collectOnlineIps(limits *deviceLimits) bool {
+	apiPort := j.xrayService.GetApiPort()
+	if apiPort == 0 {
+		return false
+	}
+	var api xray.XrayAPI
+	if err := api.Init(apiPort); err != nil {
+		return false
+	}
+	defer api.Close()
+
+	online := make(map[string]map[string]time.Time, len(limits.emails))
+	for _, email := range limits.emails {
+		ips, err := api.GetOnlineIps(email)
+		if err == xray.ErrOnlineIpsUnsupported {
+			return false
+		}
+		if err != nil {
+			logger.Debug("〔设备限制〕查询在线IP失败:", email, err)
+			continue
+		}
+		online[email] = ips
+	}
+
+	// 中文注释: 每次查询到的在线IP计为一次出现
+	recorder := j.newSightingRecorder()
+	activeClientsLock.Lock()
+	for email, ips := range online {
+		for ip := range ips {
+			recorder.record(email, ip)
+		}
+	}
+	recorder.save()
+	activeClientsLock.Unlock()
+
+	j.skipAccessLog()
+	return true
+}
+
+// sightingRecorder 中文注释: 按设备计数设置记录本次运行中出现的IP，解析日志和查询统计接口共用。
+// 调用 record 和 save 时需要持有 activeClientsLock
+type sightingRecorder struct {
+	job          *CheckDeviceLimitJob
+	v4Prefix     int
+	v6Prefix     int
+	minSightings int
+	trusted      map[string][]*net.IPNet
+	now          time.Time
+	// 中文注释: 本次新出现的IP，稍后统一写入数据库
+	seen map[string]map[string]time.Time
+}
+
+func (j *CheckDeviceLimitJob) newSightingRecorder() *sightingRecorder {
+	// 中文注释: 同一网段内的地址算作一个设备；信任IP不计入设备数
+	v4Prefix, err := j.settingService.GetDeviceIpv4Prefix()
+	if err != nil {
+		v4Prefix = 32
+	}
+	v6Prefix, err := j.settingService.GetDeviceIpv6Prefix()
+	if err != nil {
+		v6Prefix = 64
+	}
+	minSightings, err := j.settingService.GetDeviceMinSightings()
+	if err != nil || minSightings < 1 {
+		minSightings = 1
+	}
+	trusted, err := j.deviceLimitService.GetTrustedNets()
+	if err != nil {
+		logger.Warning("〔设备限制〕读取信任IP失败:", err)
+	}
+	return &sightingRecorder{
+		job:          j,
+		v4Prefix:     v4Prefix,
+		v6Prefix:     v6Prefix,
+		minSightings: minSightings,
+		trusted:      trusted,
+		now:          time.Now(),
+		seen:         make(map[string]map[string]time.Time),
+	}
+}
+
+func (r *sightingRecorder) record(email string, rawIp string) {
+	addr := net.ParseIP(rawIp)
+	if addr == nil || addr.IsLoopback() || isTrustedIP(addr, r.trusted[email]) {
+		return
+	}
+	ip := service.DeviceKey(addr, r.v4Prefix, r.v6Prefix)
+	now := r.now
+	pending := r.job.pending
+
+	// 中文注释: 新IP出现次数达到最少次数后才计为活跃设备，已在线的IP直接刷新
+	if _, active := ActiveClientIPs[email][ip]; !active && r.minSightings > 1 {
+		if _, ok := pending[email]; !ok {
+			pending[email] = make(map[string]*ipSighting)
+		}
+		sighting, ok := pending[email][ip]
+		if !ok {
+			sighting = &ipSighting{}
+			pending[email][ip] = sighting
+		}
+		sighting.count++
+		sighting.lastSeen = now
+		if sighting.count < r.minSightings {
+			return
+		}
+		delete(pending[email], ip)
+	}
+
+	if _, ok := ActiveClientIPs[email]; !ok {
+		ActiveClientIPs[email] = make(map[string]time.Time)
+	}
+	ActiveClientIPs[email][ip] = now
+	if _, ok := ipFirstSeen[email]; !ok {
+		ipFirstSeen[email] = make(map[string]time.Time)
+	}
+	if _, ok := ipFirstSeen[email][ip]; !ok {
+		ipFirstSeen[email][ip] = now
+	}
+	if _, ok := r.seen[email]; !ok {
+		r.seen[email] = make(map[string]time.Time)
+	}
+	r.seen[email][ip] = now
+}
+
+func (r *sightingRecorder) save() {
+	if err := r.job.deviceLimitService.SaveSightings(r.seen); err != nil {
+		logger.Warning("〔设备限制〕保存活跃IP失败:", err)
+	}
+}
+
+// isTrustedIP 中文注释: 判断 IP 是否属于客户端的信任网段
+func isTrustedIP(ip net.IP, nets []*net.IPNet) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceLimitInfo 中文注释: 启用了设备限制的入站信息及其超限策略
+type deviceLimitInfo struct {
+	Limit    int
+	Tag      string
+	Protocol model.Protocol
+	Policy   *model.DevicePolicy
+}
+
+func newDeviceLimitInfo(inbound *model.Inbound) deviceLimitInfo {
+	policy, err := service.ParseDevicePolicy(inbound.DevicePolicy)
+	if err != nil {
+		// 中文注释: 策略无效时按默认的立即封禁处理
+		logger.Warningf("〔设备限制〕入站 %s 的设备超限策略无效: %v", inbound.Tag, err)
+		policy, _ = service.ParseDevicePolicy("")
+	}
+	return deviceLimitInfo{Limit: inbound.DeviceLimit, Tag: inbound.Tag, Protocol: inbound.Protocol, Policy: policy}
+}
+
+// forClient 中文注释: 返回客户端实际生效的设备限制，客户端设置了设备限制时覆盖入站的设置
+func (info deviceLimitInfo) forClient(client *model.Client) deviceLimitInfo {
+	if client.DeviceLimit > 0 {
+		info.Limit = client.DeviceLimit
+	}
+	return info
+}
+
+// deviceLimits 中文注释: 开启状态的入站中启用了设备限制的入站信息、各客户端的设置，以及实际受限的客户端
+type deviceLimits struct {
+	inbounds map[int]deviceLimitInfo
+	clients  map[string]model.Client
+	emails   []string
+}
+
+// loadDeviceLimits 中文注释: 查询所有开启状态的入站，客户端可以单独设置设备限制来覆盖入站的设置
+func (j *CheckDeviceLimitJob) loadDeviceLimits() *deviceLimits {
 	db := database.GetDB()
 	var inbounds []*model.Inbound
-	// 中文注释: 这里仅查询启用了设备限制(device_limit > 0)并且自身是开启状态的入站规则
-	db.Where("device_limit > 0 AND enable = ?", true).Find(&inbounds)
+	db.Where("enable = ?", true).Find(&inbounds)
 
-	if len(inbounds) == 0 {
+	// 中文注释: 优化 - 在一次循环中同时获取 tag、protocol、超限策略和各客户端的设置
+	limits := &deviceLimits{
+		inbounds: make(map[int]deviceLimitInfo),
+		clients:  make(map[string]model.Client),
+	}
+	for _, inbound := range inbounds {
+		clients, err := j.inboundService.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		limited := false
+		for _, client := range clients {
+			limits.clients[client.Email] = client
+			if client.DeviceLimit > 0 || inbound.DeviceLimit > 0 {
+				limited = true
+				if client.Enable {
+					limits.emails = append(limits.emails, client.Email)
+				}
+			}
+		}
+		if limited {
+			limits.inbounds[inbound.Id] = newDeviceLimitInfo(inbound)
+		}
+	}
+	return limits
+}
+
+// checkAllClientsLimit 中文注释: 核心功能，检查所有用户，对超限的按策略处理，对恢复的执行解封
+func (j *CheckDeviceLimitJob) checkAllClientsLimit(limits *deviceLimits) {
+	db := database.GetDB()
+	inboundInfoMap, clientMap := limits.inbounds, limits.clients
+
+	clientStatusLock.RLock()
+	bannedCount := len(ClientStatus)
+	clientStatusLock.RUnlock()
+	// 中文注释: 没有限制设备的入站、客户端，且没有待解封、待解除阻断的用户时无需处理
+	if len(inboundInfoMap) == 0 && bannedCount == 0 && len(j.kickedEmails()) == 0 {
 		return
 	}
 
@@ -181,22 +483,20 @@ func (j *CheckDeviceLimitJob) checkAllClientsLimit() {
 	if apiPort == 0 {
 		return
 	}
-	// 中文注释: 使用获取到的端口号初始化 API 客户端
-	j.xrayApi.Init(apiPort)
-	defer j.xrayApi.Close()
-
-	// 中文注释: 优化 - 在一次循环中同时获取 tag 和 protocol
-	inboundInfoMap := make(map[int]struct {
-		Limit    int
-		Tag      string
-		Protocol model.Protocol
-	})
-	for _, inbound := range inbounds {
-		inboundInfoMap[inbound.Id] = struct {
-			Limit    int
-			Tag      string
-			Protocol model.Protocol
-		}{Limit: inbound.DeviceLimit, Tag: inbound.Tag, Protocol: inbound.Protocol}
+	// 中文注释: 数据库中的封禁记录和豁免；管理员手动解封后数据库中已没有对应记录
+	bans, err := j.deviceLimitService.GetBans()
+	if err != nil {
+		logger.Warning("〔设备限制〕读取封禁记录失败:", err)
+		return
+	}
+	banMap := make(map[string]*model.DeviceBan, len(bans))
+	for _, ban := range bans {
+		banMap[ban.Email] = ban
+	}
+	exemptEmails, err := j.deviceLimitService.GetExemptEmails()
+	if err != nil {
+		logger.Warning("〔设备限制〕读取豁免失败:", err)
+		return
 	}
 
 	activeClientsLock.RLock()
@@ -204,6 +504,9 @@ func (j *CheckDeviceLimitJob) checkAllClientsLimit() {
 	defer activeClientsLock.RUnlock()
 	defer clientStatusLock.Unlock()
 
+	now := time.Now()
+	over := make(map[string]bool)
+
 	// 第一步: 处理当前在线的用户
 	for email, ips := range ActiveClientIPs {
 		traffic, err := j.inboundService.GetClientTrafficByEmail(email)
@@ -212,70 +515,137 @@ func (j *CheckDeviceLimitJob) checkAllClientsLimit() {
 		}
 
 		info, ok := inboundInfoMap[traffic.InboundId]
-		if !ok || info.Limit <= 0 {
+		if !ok {
+			continue
+		}
+		client := clientMap[email]
+		info = info.forClient(&client)
+		if info.Limit <= 0 {
 			continue
 		}
-
 
 		isBanned := ClientStatus[email]
 		activeIPCount := len(ips)
 
-                                  // 调用封禁函数
-		if activeIPCount > info.Limit && !isBanned {
-			// 中文注释: 调用封禁函数时，传入当前的IP数用于记录日志
+		if activeIPCount <= info.Limit || exemptEmails[email] {
+			// 调用解封函数；按次数加重的封禁要等到期后才解封
+			if activeIPCount <= info.Limit && isBanned && banMap[email] != nil && banMap[email].Until == 0 {
+				// 中文注释: 调用解封函数时，传入当前的IP数用于记录日志
+				j.unbanUser(email, activeIPCount, &info, service.DeviceUnbanRecovered)
+			}
+			continue
+		}
+		if isBanned {
+			continue
+		}
+
+		// 中文注释: 超限持续时间未超过宽限期时暂不处理
+		over[email] = true
+		since, ok := j.overSince[email]
+		if !ok {
+			since = now
+			j.overSince[email] = now
+		}
+		if now.Sub(since) < time.Duration(info.Policy.Grace)*time.Second {
+			continue
+		}
+
+		mode := info.Policy.Mode
+		if client.DeviceMode != "" {
+			mode = client.DeviceMode
+		}
+		switch mode {
+		case service.DeviceModeNotify:
+			j.notifyUser(email, activeIPCount, &info)
+		case service.DeviceModeKickOldest:
+			j.kickOldest(email, ips, &info)
+		default:
+			// 调用封禁函数，传入当前的IP数用于记录日志
 			j.banUser(email, activeIPCount, &info)
 		}
+	}
 
-                                  // 调用解封函数
-		if activeIPCount <= info.Limit && isBanned {
-			// 中文注释: 调用解封函数时，传入当前的IP数用于记录日志
-			j.unbanUser(email, activeIPCount, &info)
+	// 中文注释: 不再超限的用户清除宽限期和通知状态，并解除对旧设备的阻断
+	for email := range j.overSince {
+		if !over[email] {
+			delete(j.overSince, email)
+			delete(j.notified, email)
+		}
+	}
+	for _, email := range j.kickedEmails() {
+		if !over[email] {
+			j.releaseKick(email)
 		}
 	}
 
-	// 第二步: 专门处理那些“已被封禁”但“已不在线”的用户，为他们解封
+	// 第二步: 专门处理那些“已被封禁”但“已不在线”的用户、封禁到期的用户、被管理员手动解封的用户，以及所在入站已取消设备限制的用户，为他们解封
 	for email, isBanned := range ClientStatus {
 		if !isBanned {
 			continue
 		}
-		if _, online := ActiveClientIPs[email]; !online {
-			traffic, err := j.inboundService.GetClientTrafficByEmail(email)
-			if err != nil || traffic == nil {
+		traffic, err := j.inboundService.GetClientTrafficByEmail(email)
+		if err != nil {
+			continue
+		}
+		if traffic == nil {
+			// 中文注释: 用户已被删除，只需清除封禁记录
+			j.releaseBan(email, service.DeviceUnbanReleased, 0)
+			continue
+		}
+		info, limited := inboundInfoMap[traffic.InboundId]
+		if limited {
+			client := clientMap[email]
+			info = info.forClient(&client)
+			limited = info.Limit > 0
+		}
+		if limited {
+			ban := banMap[email]
+			if ban == nil {
+				logger.Infof("已封禁用户 %s 已被管理员手动解封，执行解封操作。", email)
+				j.unbanUser(email, len(ActiveClientIPs[email]), &info, service.DeviceUnbanManual)
 				continue
 			}
-			info, ok := inboundInfoMap[traffic.InboundId]
-			if !ok {
+			if ban.Until > 0 {
+				if now.UnixMilli() >= ban.Until {
+					logger.Infof("已封禁用户 %s 的封禁时长已到，执行解封操作。", email)
+					j.unbanUser(email, len(ActiveClientIPs[email]), &info, service.DeviceUnbanExpired)
+				}
+				continue
+			}
+			if _, online := ActiveClientIPs[email]; online {
 				continue
 			}
 			logger.Infof("已封禁用户 %s 已完全下线，执行解封操作。", email)
 
 			// 调用解封函数，这种情况下：活跃IP数为0，我们直接传入0用于记录日志
-			j.unbanUser(email, 0, &info)
+			j.unbanUser(email, 0, &info, service.DeviceUnbanOffline)
+			continue
 		}
+
+		// 中文注释: 入站或客户端已取消设备限制，或入站被禁用、已删除
+		inbound := &model.Inbound{}
+		if err := db.Model(model.Inbound{}).Where("id = ?", traffic.InboundId).First(inbound).Error; err != nil || !inbound.Enable {
+			j.releaseBan(email, service.DeviceUnbanReleased, len(ActiveClientIPs[email]))
+			continue
+		}
+		logger.Infof("已封禁用户 %s 所在入站或客户端已取消设备限制，执行解封操作。", email)
+		info = newDeviceLimitInfo(inbound)
+		j.unbanUser(email, len(ActiveClientIPs[email]), &info, service.DeviceUnbanReleased)
 	}
 }
 
-// banUser 中文注释: 封装的封禁用户函数；IP数量超限，且用户当前未被封禁 -> 执行封禁 (UUID 替换)
-func (j *CheckDeviceLimitJob) banUser(email string, activeIPCount int, info *struct {
-	Limit    int
-	Tag      string
-	Protocol model.Protocol
-}) {
-    // =================================================================
-    // 这一行代码是整个解封逻辑的灵魂！
-    // GetClientByEmail 函数会去查询您的数据库 (x-ui.db)，
-    // 找到 `inbounds` 表，解析其中的 `settings` 字段，并从中去，
-    // 读取出您最初设置的、最原始、最正确的用户信息（包括最原始的UUID），
-    // 然后把它赋值给 `client` 这个变量；此时，`client` 变量就持有了那个“老链接”的正确原始 UUID。
-    // =================================================================
-	_, client, err := j.inboundService.GetClientByEmail(email)
-	if err != nil || client == nil {
+// releaseBan 中文注释: 不经过 Xray API，直接清除内存和数据库中的封禁状态。
+// 用于用户或入站已不存在、入站已禁用的情况，之后重新启用时会按原始配置加入 Xray。
+func (j *CheckDeviceLimitJob) releaseBan(email string, reason string, activeIPCount int) {
+	if err := j.deviceLimitService.ReleaseBan(email, reason, activeIPCount); err != nil {
+		logger.Warningf("〔设备限制〕清除用户 %s 的封禁记录失败: %v", email, err)
 		return
 	}
-	logger.Infof("〔设备限制〕超限：用户 %s. 限制: %d, 当前活跃: %d. 执行封禁掐网。", email, info.Limit, activeIPCount)
-	
-	// 〔中文注释〕: 以下是发送 Telegram 通知的核心代码，
-	// 它会调用我们注入的 telegramService 的 SendMessage 方法。
+	delete(ClientStatus, email)
+}
+
+// sendNotice 中文注释: 异步发送设备超限的 Telegram 通知
+func (j *CheckDeviceLimitJob) sendNotice(email string, limit int, activeIPCount int, action string) {
 	go func() {
 		// 〔中文注释〕: 在调用前，先判断服务实例是否为 nil，增加代码健壮性。
 		if j.telegramService == nil {
@@ -283,29 +653,232 @@ func (j *CheckDeviceLimitJob) banUser(email string, activeIPCount int, info *str
 		}
 		tgMessage := fmt.Sprintf(
 			"<b> Next-Panel 面板设备超限提醒</b>\n\n"+
-				"  ------------------------------------\n"+
-				"  👤 用户 Email：%s\n"+
-				"  🖥️ 设备限制数量：%d\n"+
-				"  🌐 当前在线IP数：%d\n"+
-				"  ------------------------------------\n\n"+
-				"<b><i>⚠ 该用户已被自动掐网封禁！</i></b>",
-			email, info.Limit, activeIPCount,
+				"  ------------------------------------\n"+
+				"  👤 用户 Email：%s\n"+
+				"  🖥️ 设备限制数量：%d\n"+
+				"  🌐 当前在线IP数：%d\n"+
+				"  ------------------------------------\n\n"+
+				"<b><i>⚠ %s</i></b>",
+			email, limit, activeIPCount, action,
 		)
 		// 〔中文注释〕: 调用接口方法发送消息。
 		err := j.telegramService.SendMessage(tgMessage)
 		if err != nil {
-			logger.Warningf("发送 Telegram 封禁通知失败: %v", err)
+			logger.Warningf("发送 Telegram 设备超限通知失败: %v", err)
 		}
 	}()
+}
+
+// notifyUser 中文注释: 仅通知模式，每次超限只通知并记录一次，不做任何限制
+func (j *CheckDeviceLimitJob) notifyUser(email string, activeIPCount int, info *deviceLimitInfo) {
+	if j.notified[email] {
+		return
+	}
+	j.notified[email] = true
+	logger.Infof("〔设备限制〕超限：用户 %s. 限制: %d, 当前活跃: %d. 仅通知。", email, info.Limit, activeIPCount)
+	j.sendNotice(email, info.Limit, activeIPCount, "该用户设备数超限（仅通知，未做限制）")
+	err := j.deviceLimitService.AddLog(&model.DeviceBanLog{
+		Email:       email,
+		Action:      service.DeviceBanActionNotify,
+		DeviceLimit: info.Limit,
+		ActiveIps:   activeIPCount,
+	})
+	if err != nil {
+		logger.Warningf("〔设备限制〕保存用户 %s 的通知记录失败: %v", email, err)
+	}
+}
+
+// deviceRuleTag 中文注释: kickOldest 策略为每个用户添加的路由规则标签
+func deviceRuleTag(email string) string {
+	return "device-limit-" + email
+}
+
+// kickOldest 中文注释: 保留最近上线的 Limit 个设备，通过路由规则把该用户来自其余(最早上线)IP 的连接转发到 blocked 出站。
+// 被阻断的设备仍会出现在访问日志中，因此它们持续重连时会一直被阻断，停止重连并过期后自动解除。
+func (j *CheckDeviceLimitJob) kickOldest(email string, ips map[string]time.Time, info *deviceLimitInfo) {
+	sorted := make([]string, 0, len(ips))
+	for ip := range ips {
+		sorted = append(sorted, ip)
+	}
+	firstSeen := ipFirstSeen[email]
+	sort.Slice(sorted, func(a, b int) bool {
+		ta, tb := firstSeen[sorted[a]], firstSeen[sorted[b]]
+		if ta.Equal(tb) {
+			return sorted[a] < sorted[b]
+		}
+		return ta.Before(tb)
+	})
+	kick := sorted[:len(sorted)-info.Limit]
+	sort.Strings(kick)
+	j.worker.submit(deviceAction{kind: deviceActionKick, email: email, activeIPCount: len(ips), info: *info, kick: kick})
+}
+
+// applyKick 中文注释: 由操作队列执行，添加或更新 kickOldest 策略的路由规则
+func (j *CheckDeviceLimitJob) applyKick(api *xray.XrayAPI, action deviceAction) {
+	email, kick, info := action.email, action.kick, &action.info
+
+	j.kickedLock.Lock()
+	previous, applied := j.kicked[email]
+	j.kickedLock.Unlock()
+	changed := !applied || strings.Join(previous, ",") != strings.Join(kick, ",")
+	if changed && applied {
+		if err := retryXrayCall(func() error { return api.RemoveRoutingRule(deviceRuleTag(email)) }); err != nil {
+			logger.Warningf("〔设备限制〕移除用户 %s 的阻断规则失败: %v", email, err)
+			return
+		}
+	}
+	rule, _ := json.Marshal(map[string]any{
+		"type":        "field",
+		"ruleTag":     deviceRuleTag(email),
+		"user":        []string{email},
+		"source":      kick,
+		"outboundTag": "blocked",
+	})
+	// 中文注释: 规则未变化时也重新添加，以便 Xray 重启后恢复；规则已存在时 Xray 返回重复错误，忽略即可
+	err := retryXrayCall(func() error {
+		err := api.AddRoutingRule(rule)
+		if err != nil && !changed && strings.Contains(err.Error(), "duplicate") {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		logger.Warningf("〔设备限制〕添加用户 %s 的阻断规则失败: %v", email, err)
+		j.kickedLock.Lock()
+		delete(j.kicked, email)
+		j.kickedLock.Unlock()
+		return
+	}
+	j.kickedLock.Lock()
+	j.kicked[email] = kick
+	j.kickedLock.Unlock()
+	if !changed {
+		return
+	}
+	logger.Infof("〔设备限制〕超限：用户 %s. 限制: %d, 当前活跃: %d. 阻断最早上线的设备: %v", email, info.Limit, action.activeIPCount, kick)
+	j.sendNotice(email, info.Limit, action.activeIPCount, fmt.Sprintf("已阻断该用户最早上线的 %d 个设备！", len(kick)))
+	err = j.deviceLimitService.AddLog(&model.DeviceBanLog{
+		Email:       email,
+		Action:      service.DeviceBanActionKick,
+		DeviceLimit: info.Limit,
+		ActiveIps:   action.activeIPCount,
+	})
+	if err != nil {
+		logger.Warningf("〔设备限制〕保存用户 %s 的阻断记录失败: %v", email, err)
+	}
+}
+
+// kickedEmails 中文注释: 返回当前被 kickOldest 策略阻断了旧设备的用户
+func (j *CheckDeviceLimitJob) kickedEmails() []string {
+	j.kickedLock.Lock()
+	defer j.kickedLock.Unlock()
+	emails := make([]string, 0, len(j.kicked))
+	for email := range j.kicked {
+		emails = append(emails, email)
+	}
+	return emails
+}
+
+// releaseKick 中文注释: 用户不再超限时删除 kickOldest 策略添加的路由规则
+func (j *CheckDeviceLimitJob) releaseKick(email string) {
+	j.worker.submit(deviceAction{kind: deviceActionReleaseKick, email: email})
+}
+
+func (j *CheckDeviceLimitJob) applyReleaseKick(api *xray.XrayAPI, action deviceAction) {
+	email := action.email
+	j.kickedLock.Lock()
+	_, applied := j.kicked[email]
+	j.kickedLock.Unlock()
+	if !applied {
+		return
+	}
+	if err := retryXrayCall(func() error { return api.RemoveRoutingRule(deviceRuleTag(email)) }); err != nil {
+		logger.Warningf("〔设备限制〕移除用户 %s 的阻断规则失败: %v", email, err)
+		return
+	}
+	logger.Infof("〔设备限制〕用户 %s 已不再超限，解除对旧设备的阻断。", email)
+	j.kickedLock.Lock()
+	delete(j.kicked, email)
+	j.kickedLock.Unlock()
+}
+
+// banDuration 中文注释: 按策略的 Strikes 和窗口期内已封禁次数计算本次封禁时长，0 表示封禁到设备数恢复为止
+func (j *CheckDeviceLimitJob) banDuration(email string, policy *model.DevicePolicy) time.Duration {
+	if len(policy.Strikes) == 0 {
+		return 0
+	}
+	window := time.Duration(policy.StrikeWindow) * time.Hour
+	if window == 0 {
+		window = 24 * time.Hour
+	}
+	count, err := j.deviceLimitService.CountBans(email, time.Now().Add(-window))
+	if err != nil {
+		logger.Warningf("〔设备限制〕读取用户 %s 的封禁次数失败: %v", email, err)
+	}
+	strike := min(int(count), len(policy.Strikes)-1)
+	return time.Duration(policy.Strikes[strike]) * time.Minute
+}
 
+// banUser 中文注释: IP数量超限，且用户当前未被封禁 -> 提交封禁操作，由操作队列异步执行
+func (j *CheckDeviceLimitJob) banUser(email string, activeIPCount int, info *deviceLimitInfo) {
+	j.worker.submit(deviceAction{kind: deviceActionBan, email: email, activeIPCount: activeIPCount, info: *info})
+}
+
+// unbanUser 中文注释: IP数量已恢复正常，但用户处于封禁状态 -> 提交解封操作，由操作队列异步执行
+func (j *CheckDeviceLimitJob) unbanUser(email string, activeIPCount int, info *deviceLimitInfo, reason string) {
+	j.worker.submit(deviceAction{kind: deviceActionUnban, email: email, activeIPCount: activeIPCount, info: *info, reason: reason})
+}
 
-	// 中文注释: 步骤一：先从 Xray-Core 中删除该用户。
-	j.xrayApi.RemoveUser(info.Tag, email)
-    
+// runAction 中文注释: 操作队列的执行函数，每个操作使用独立的 Xray API 连接，不持有检测过程的锁
+func (j *CheckDeviceLimitJob) runAction(action deviceAction) {
+	apiPort := j.xrayService.GetApiPort()
+	if apiPort == 0 {
+		return
+	}
+	var api xray.XrayAPI
+	if err := api.Init(apiPort); err != nil {
+		logger.Warningf("〔设备限制〕连接 Xray API 失败，用户 %s 的操作将在下次检查时重试: %v", action.email, err)
+		return
+	}
+	defer api.Close()
+
+	switch action.kind {
+	case deviceActionBan:
+		j.applyBan(&api, action)
+	case deviceActionUnban:
+		j.applyUnban(&api, action)
+	case deviceActionKick:
+		j.applyKick(&api, action)
+	case deviceActionReleaseKick:
+		j.applyReleaseKick(&api, action)
+	}
+}
+
+// applyBan 中文注释: 执行封禁 (UUID 替换)；用户已被封禁时不重复执行
+func (j *CheckDeviceLimitJob) applyBan(api *xray.XrayAPI, action deviceAction) {
+	email, activeIPCount, info := action.email, action.activeIPCount, &action.info
+	clientStatusLock.RLock()
+	banned := ClientStatus[email]
+	clientStatusLock.RUnlock()
+	if banned {
+		return
+	}
     // =================================================================
-	// 中文注释: 增加 5000 毫秒延时，解决竞态条件问题
-	time.Sleep(5000 * time.Millisecond)
+    // 这一行代码是整个解封逻辑的灵魂！
+    // GetClientByEmail 函数会去查询您的数据库 (x-ui.db)，
+    // 找到 `inbounds` 表，解析其中的 `settings` 字段，并从中去，
+    // 读取出您最初设置的、最原始、最正确的用户信息（包括最原始的UUID），
+    // 然后把它赋值给 `client` 这个变量；此时，`client` 变量就持有了那个“老链接”的正确原始 UUID。
     // =================================================================
+	traffic, client, err := j.inboundService.GetClientByEmail(email)
+	if err != nil || client == nil {
+		return
+	}
+	duration := j.banDuration(email, info.Policy)
+	logger.Infof("〔设备限制〕超限：用户 %s. 限制: %d, 当前活跃: %d, 封禁时长: %v. 执行封禁掐网。", email, info.Limit, activeIPCount, duration)
+
+	// 中文注释: 步骤一：先从 Xray-Core 中删除该用户。删除是同步完成的，随后的添加失败时由 retryXrayCall 退避重试。
+	api.RemoveUser(info.Tag, email)
 
 	// 中文注释: 创建一个带有随机UUID/Password的临时客户端配置用于“封禁”
 	tempClient := *client
@@ -322,54 +895,94 @@ func (j *CheckDeviceLimitJob) banUser(email string, activeIPCount int, info *str
 
                  // 中文注释: 步骤二：将这个带有错误UUID/Password的临时用户添加回去。
                  // 客户端持有的还是旧的UUID，自然就无法通过验证，从而达到了“封禁”的效果。
-	err = j.xrayApi.AddUser(string(info.Protocol), info.Tag, clientMap)
+	err = retryXrayCall(func() error { return api.AddUser(string(info.Protocol), info.Tag, clientMap) })
 	if err != nil {
 		logger.Warningf("通过API封禁用户 %s 失败: %v", email, err)
+		return
+	}
+
+	// 〔中文注释〕: 封禁成功后发送 Telegram 通知
+	if duration > 0 {
+		j.sendNotice(email, info.Limit, activeIPCount, fmt.Sprintf("该用户已被自动掐网封禁 %d 分钟！", int(duration.Minutes())))
 	} else {
-	                 // 中文注释: 封禁成功后，在内存中标记该用户为“已封禁”状态。
-		ClientStatus[email] = true
+		j.sendNotice(email, info.Limit, activeIPCount, "该用户已被自动掐网封禁！")
+	}
+
+	// 中文注释: 在内存中标记该用户为“已封禁”状态，并写入数据库以便重启后恢复。
+	clientStatusLock.Lock()
+	ClientStatus[email] = true
+	clientStatusLock.Unlock()
+	ban := &model.DeviceBan{
+		Email:       email,
+		InboundId:   traffic.InboundId,
+		DeviceLimit: info.Limit,
+		ActiveIps:   activeIPCount,
+	}
+	if duration > 0 {
+		ban.Until = time.Now().Add(duration).UnixMilli()
+	}
+	if err = j.deviceLimitService.SaveBan(ban); err != nil {
+		logger.Warningf("〔设备限制〕保存用户 %s 的封禁记录失败: %v", email, err)
 	}
 }
 
-// unbanUser 中文注释: 封装的解封用户函数；IP数量已恢复正常，但用户处于封禁状态 -> 执行解封 (恢复原始 UUID)
-func (j *CheckDeviceLimitJob) unbanUser(email string, activeIPCount int, info *struct {
-	Limit    int
-	Tag      string
-	Protocol model.Protocol
-}) {
-	_, client, err := j.inboundService.GetClientByEmail(email)
+// applyUnban 中文注释: 执行解封 (恢复原始 UUID)；用户已不在封禁状态时不重复执行
+func (j *CheckDeviceLimitJob) applyUnban(api *xray.XrayAPI, action deviceAction) {
+	email, activeIPCount, info := action.email, action.activeIPCount, &action.info
+	clientStatusLock.RLock()
+	banned := ClientStatus[email]
+	clientStatusLock.RUnlock()
+	if !banned {
+		return
+	}
+	traffic, client, err := j.inboundService.GetClientByEmail(email)
 	if err != nil || client == nil {
 		return
 	}
-	logger.Infof("〔设备数量〕已恢复：用户 %s. 限制: %d, 当前活跃: %d. 执行解封/恢复用户。", email, info.Limit, activeIPCount)	
+	// 中文注释: 用户已被禁用时不重新加入 Xray，只清除封禁状态
+	if !client.Enable || (traffic != nil && !traffic.Enable) {
+		clientStatusLock.Lock()
+		j.releaseBan(email, service.DeviceUnbanReleased, activeIPCount)
+		clientStatusLock.Unlock()
+		return
+	}
+	logger.Infof("〔设备数量〕已恢复：用户 %s. 限制: %d, 当前活跃: %d. 执行解封/恢复用户。", email, info.Limit, activeIPCount)
 
                  // 中文注释: 步骤一：先从 Xray-Core 中删除用于“封禁”的那个临时用户。
-	j.xrayApi.RemoveUser(info.Tag, email)
-    
-    // =================================================================
-	// 中文注释: 同样增加 5000 毫秒延时，确保解封操作的稳定性
-	time.Sleep(5000 * time.Millisecond)
-    // =================================================================
+	api.RemoveUser(info.Tag, email)
 
 	var clientMap map[string]interface{}
 	clientJson, _ := json.Marshal(client)
 	json.Unmarshal(clientJson, &clientMap)
+	// 中文注释: 按当前限速写入 level，否则恢复后的用户会以 level 0 不限速
+	clientMap["level"] = j.inboundService.ClientSpeedLevel(email)
 
                  // 中文注释: 步骤二：将数据库中原始的、正确的用户信息重新添加回 Xray-Core，从而实现“解封”。
-	err = j.xrayApi.AddUser(string(info.Protocol), info.Tag, clientMap)
+	err = retryXrayCall(func() error { return api.AddUser(string(info.Protocol), info.Tag, clientMap) })
 	if err != nil {
 		logger.Warningf("通过API恢复用户 %s 失败: %v", email, err)
-	} else {
-                                  // 中文注释: 解封成功后，从内存中移除该用户的“已封禁”状态标记。
-		delete(ClientStatus, email)
+		return
 	}
+                                  // 中文注释: 解封成功后，从内存和数据库中移除该用户的“已封禁”状态标记。
+	clientStatusLock.Lock()
+	j.releaseBan(email, action.reason, activeIPCount)
+	clientStatusLock.Unlock()
 }
 
 type CheckClientIpJob struct {
 	lastClear     int64
 	disAllowedIps []string
+	// 中文注释: 不使用 fail2ban 时由内置防火墙封禁；backend 为本次运行的执行方式，strikes 记录 IP 上次超限的时间
+	ipFirewallService service.IpFirewallService
+	settingService    service.SettingService
+	xrayService       service.XrayService
+	backend           string
+	strikes           map[string]time.Time
 }
 
+// ipLimitFindTime 中文注释: 与 fail2ban 的 3x-ipl 规则一致，同一 IP 在此时间内两次超限才封禁
+const ipLimitFindTime = 32 * time.Second
+
 var job *CheckClientIpJob
 
 func NewCheckClientIpJob() *CheckClientIpJob {
@@ -383,22 +996,27 @@ func (j *CheckClientIpJob) Run() {
 	}
 
 	shouldClearAccessLog := false
-	iplimitActive := j.hasLimitIp()
-	f2bInstalled := j.checkFail2BanInstalled()
-	isAccessLogAvailable := j.checkAccessLogAvailable(iplimitActive)
-
-	if isAccessLogAvailable {
-		if iplimitActive {
-			if f2bInstalled {
-				shouldClearAccessLog = j.processLogFile()
-			} else {
-				if !f2bInstalled {
-					logger.Warning("[LimitIP] Fail2Ban is not installed, Please install Fail2Ban from the x-ui bash menu.")
-				}
-			}
+	limitIpEmails := j.getLimitIpEmails()
+	iplimitActive := len(limitIpEmails) > 0
+
+	// 中文注释: 优先查询 Xray 的在线IP统计，旧版本 Xray 不支持时解析 access.log
+	onlineIpsAvailable := false
+	if iplimitActive {
+		j.backend = j.ipFirewallService.ApplyBackend()
+		if j.backend == "" {
+			logger.Warning("[LimitIP] No firewall available, Please install nftables, ipset or Fail2Ban from the x-ui bash menu.")
+		} else if clientIps, ok := j.getOnlineClientIps(limitIpEmails); ok {
+			onlineIpsAvailable = true
+			j.updateClientIps(clientIps)
 		}
 	}
 
+	isAccessLogAvailable := j.checkAccessLogAvailable(iplimitActive && !onlineIpsAvailable)
+
+	if isAccessLogAvailable && iplimitActive && j.backend != "" && !onlineIpsAvailable {
+		shouldClearAccessLog = j.processLogFile()
+	}
+
 	if shouldClearAccessLog || (isAccessLogAvailable && time.Now().Unix()-j.lastClear > 3600) {
 		j.clearAccessLog()
 	}
@@ -425,15 +1043,18 @@ func (j *CheckClientIpJob) clearAccessLog() {
 	j.lastClear = time.Now().Unix()
 }
 
-func (j *CheckClientIpJob) hasLimitIp() bool {
+// getLimitIpEmails 中文注释: 返回设置了 IP 限制的客户端
+func (j *CheckClientIpJob) getLimitIpEmails() []string {
 	db := database.GetDB()
 	var inbounds []*model.Inbound
 
 	err := db.Model(model.Inbound{}).Find(&inbounds).Error
 	if err != nil {
-		return false
+		return nil
 	}
 
+	var emails []string
+
 	for _, inbound := range inbounds {
 		if inbound.Settings == "" {
 			continue
@@ -446,12 +1067,44 @@ func (j *CheckClientIpJob) hasLimitIp() bool {
 		for _, client := range clients {
 			limitIp := client.LimitIP
 			if limitIp > 0 {
-				return true
+				emails = append(emails, client.Email)
 			}
 		}
 	}
 
-	return false
+	return emails
+}
+
+// getOnlineClientIps 中文注释: 通过 Xray 的在线IP统计获取客户端的在线IP，返回 false 表示无法使用统计接口
+func (j *CheckClientIpJob) getOnlineClientIps(emails []string) (map[string]map[string]struct{}, bool) {
+	apiPort := j.xrayService.GetApiPort()
+	if apiPort == 0 {
+		return nil, false
+	}
+	var api xray.XrayAPI
+	if err := api.Init(apiPort); err != nil {
+		return nil, false
+	}
+	defer api.Close()
+
+	clientIps := make(map[string]map[string]struct{}, len(emails))
+	for _, email := range emails {
+		ips, err := api.GetOnlineIps(email)
+		if err == xray.ErrOnlineIpsUnsupported {
+			return nil, false
+		}
+		if err != nil || len(ips) == 0 {
+			continue
+		}
+		clientIps[email] = make(map[string]struct{}, len(ips))
+		for ip := range ips {
+			if ip == "127.0.0.1" || ip == "::1" {
+				continue
+			}
+			clientIps[email][ip] = struct{}{}
+		}
+	}
+	return clientIps, true
 }
 
 func (j *CheckClientIpJob) processLogFile() bool {
@@ -492,6 +1145,11 @@ func (j *CheckClientIpJob) processLogFile() bool {
 		inboundClientIps[email][ip] = struct{}{}
 	}
 
+	return j.updateClientIps(inboundClientIps)
+}
+
+// updateClientIps 中文注释: 保存客户端的IP记录，并处理超出 IP 限制的地址
+func (j *CheckClientIpJob) updateClientIps(inboundClientIps map[string]map[string]struct{}) bool {
 	shouldCleanLog := false
 	for email, uniqueIps := range inboundClientIps {
 
@@ -513,11 +1171,46 @@ func (j *CheckClientIpJob) processLogFile() bool {
 	return shouldCleanLog
 }
 
-func (j *CheckClientIpJob) checkFail2BanInstalled() bool {
-	cmd := "fail2ban-client"
-	args := []string{"-h"}
-	err := exec.Command(cmd, args...).Run()
-	return err == nil
+// banDisallowedIps 中文注释: 使用内置防火墙封禁超出限制的 IP，并按 fail2ban 的格式写入封禁日志
+func (j *CheckClientIpJob) banDisallowedIps(clientEmail string, ips []string) {
+	if j.strikes == nil {
+		j.strikes = make(map[string]time.Time)
+	}
+	now := time.Now()
+	for ip, last := range j.strikes {
+		if now.Sub(last) > ipLimitFindTime {
+			delete(j.strikes, ip)
+		}
+	}
+
+	banTime, err := j.settingService.GetIpLimitBanTime()
+	if err != nil || banTime < 0 {
+		banTime = 30
+	}
+	duration := time.Duration(banTime) * time.Minute
+
+	for _, ip := range ips {
+		if _, ok := j.strikes[ip]; !ok {
+			j.strikes[ip] = now
+			continue
+		}
+		delete(j.strikes, ip)
+		if err := j.ipFirewallService.BanIP(ip, duration); err != nil {
+			logger.Warningf("[LimitIP] failed to ban %s of %s: %v", ip, clientEmail, err)
+			continue
+		}
+		j.writeBannedLog(fmt.Sprintf("BAN   [Email] = %s [IP] = %s banned for %d seconds.", clientEmail, ip, int(duration.Seconds())))
+	}
+}
+
+func (j *CheckClientIpJob) writeBannedLog(msg string) {
+	logFile, err := os.OpenFile(xray.GetIPLimitBannedLogPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		j.checkError(err)
+		return
+	}
+	defer logFile.Close()
+	fmt.Fprintf(logFile, "%s   %s\n", time.Now().Format("2006/01/02 15:04:05"), msg)
 }
 
 func (j *CheckClientIpJob) checkAccessLogAvailable(iplimitActive bool) bool {
@@ -626,6 +1319,9 @@ func (j *CheckClientIpJob) updateInboundClientIps(inboundClientIps *model.Inboun
 					for i := limitIp; i < len(ips); i++ {
 						log.Printf("[LIMIT_IP] Email = %s || SRC = %s", clientEmail, ips[i])
 					}
+					if j.backend != service.IpLimitBackendFail2ban {
+						j.banDisallowedIps(clientEmail, ips[limitIp:])
+					}
 				}
 			}
 		}
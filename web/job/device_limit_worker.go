@@ -0,0 +1,92 @@
+package job
+
+import (
+	"sync"
+	"time"
+
+	"x-ui/logger"
+)
+
+// 设备限制的执行操作
+const (
+	deviceActionBan         = "ban"
+	deviceActionUnban       = "unban"
+	deviceActionKick        = "kick"
+	deviceActionReleaseKick = "releaseKick"
+)
+
+const (
+	// deviceWorkerCount 中文注释: 同时执行的 Xray API 操作数
+	deviceWorkerCount = 4
+	// deviceActionQueueSize 中文注释: 队列已满时丢弃新的操作，下次检查时会重新提交
+	deviceActionQueueSize = 256
+	// deviceActionRetries 中文注释: Xray API 调用失败时的最多尝试次数
+	deviceActionRetries = 3
+)
+
+// deviceAction 中文注释: 排队等待执行的封禁、解封或阻断操作，执行时会按最新状态再次判断，重复执行不会产生副作用
+type deviceAction struct {
+	kind          string
+	email         string
+	activeIPCount int
+	info          deviceLimitInfo
+	reason        string
+	kick          []string
+}
+
+// deviceLimitWorker 中文注释: 异步执行设备限制的 Xray API 操作，检测过程不再因 API 调用和等待而阻塞。
+// 同一用户同时只有一个操作在排队或执行，之后的提交会被忽略。
+type deviceLimitWorker struct {
+	queue chan deviceAction
+	lock  sync.Mutex
+	busy  map[string]bool
+}
+
+func newDeviceLimitWorker(run func(deviceAction)) *deviceLimitWorker {
+	w := &deviceLimitWorker{
+		queue: make(chan deviceAction, deviceActionQueueSize),
+		busy:  make(map[string]bool),
+	}
+	for i := 0; i < deviceWorkerCount; i++ {
+		go func() {
+			for action := range w.queue {
+				run(action)
+				w.lock.Lock()
+				delete(w.busy, action.email)
+				w.lock.Unlock()
+			}
+		}()
+	}
+	return w
+}
+
+// submit 中文注释: 提交操作，用户已有操作在排队或执行、或队列已满时返回 false
+func (w *deviceLimitWorker) submit(action deviceAction) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.busy[action.email] {
+		return false
+	}
+	select {
+	case w.queue <- action:
+		w.busy[action.email] = true
+		return true
+	default:
+		logger.Warningf("〔设备限制〕操作队列已满，用户 %s 的操作将在下次检查时重试", action.email)
+		return false
+	}
+}
+
+// retryXrayCall 中文注释: 调用 Xray API，失败时逐次延长等待后重试
+func retryXrayCall(fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= deviceActionRetries; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt < deviceActionRetries {
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+	}
+	return err
+}
@@ -0,0 +1,26 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+// SpeedScheduleJob 中文注释: 每分钟检查客户端和入站的限速时段，进入或离开时段时通过 Xray API 切换用户的限速等级，无需重启 Xray。
+type SpeedScheduleJob struct {
+	inboundService service.InboundService
+}
+
+func NewSpeedScheduleJob() *SpeedScheduleJob {
+	return new(SpeedScheduleJob)
+}
+
+func (j *SpeedScheduleJob) Run() {
+	changed, err := j.inboundService.SyncClientSpeeds()
+	if err != nil {
+		logger.Warning("SpeedScheduleJob:", err)
+		return
+	}
+	if changed > 0 {
+		logger.Infof("〔限速时段〕已切换 %d 个用户的限速", changed)
+	}
+}
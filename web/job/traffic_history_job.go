@@ -0,0 +1,21 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+// TrafficHistoryJob 中文注释: 定期清理超过保留天数的流量历史。
+type TrafficHistoryJob struct {
+	trafficHistoryService service.TrafficHistoryService
+}
+
+func NewTrafficHistoryJob() *TrafficHistoryJob {
+	return new(TrafficHistoryJob)
+}
+
+func (j *TrafficHistoryJob) Run() {
+	if err := j.trafficHistoryService.Cleanup(); err != nil {
+		logger.Warning("TrafficHistoryJob: Failed to clean up traffic history:", err)
+	}
+}
@@ -0,0 +1,36 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+// UsageAlertJob 中文注释: 定期检查客户端的流量和到期阈值并发送 Telegram 提醒。
+type UsageAlertJob struct {
+	usageAlertService service.UsageAlertService
+}
+
+func NewUsageAlertJob() *UsageAlertJob {
+	return new(UsageAlertJob)
+}
+
+func (j *UsageAlertJob) Run() {
+	if err := j.usageAlertService.CheckAlerts(); err != nil {
+		logger.Warning("UsageAlertJob:", err)
+	}
+}
+
+// UsageAlertCleanupJob 中文注释: 清理已删除客户端的提醒记录。
+type UsageAlertCleanupJob struct {
+	usageAlertService service.UsageAlertService
+}
+
+func NewUsageAlertCleanupJob() *UsageAlertCleanupJob {
+	return new(UsageAlertCleanupJob)
+}
+
+func (j *UsageAlertCleanupJob) Run() {
+	if err := j.usageAlertService.CleanupAlerts(); err != nil {
+		logger.Warning("UsageAlertCleanupJob:", err)
+	}
+}
@@ -0,0 +1,49 @@
+package job
+
+import (
+	"time"
+
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+// UsageReportJob 中文注释: 按设置的周期向 Telegram 管理员发送上一周期的用量报表。
+type UsageReportJob struct {
+	settingService service.SettingService
+	reportService  service.ReportService
+	tgbotService   service.Tgbot
+}
+
+func NewUsageReportJob() *UsageReportJob {
+	return new(UsageReportJob)
+}
+
+func (j *UsageReportJob) Run() {
+	period, err := j.settingService.GetTgReportPeriod()
+	if err != nil || period == "" {
+		return
+	}
+	format, err := j.settingService.GetTgReportFormat()
+	if err != nil || format == "" {
+		format = service.ReportFormatXLSX
+	}
+	from, to, err := j.reportService.GetLastPeriod(period)
+	if err != nil {
+		logger.Warning("UsageReportJob:", err)
+		return
+	}
+	name, data, err := j.reportService.ExportUsageReport(format, from, to)
+	if err != nil {
+		logger.Warning("UsageReportJob: Failed to export usage report:", err)
+		return
+	}
+
+	loc, err := j.settingService.GetTimeLocation()
+	if err != nil {
+		loc = time.Local
+	}
+	caption := j.tgbotService.I18nBot("tgbot.messages.usageReport",
+		"From=="+time.UnixMilli(from).In(loc).Format("2006-01-02"),
+		"To=="+time.UnixMilli(to-1).In(loc).Format("2006-01-02"))
+	j.tgbotService.SendDocumentToAdmins(name, data, caption)
+}
@@ -11,10 +11,11 @@ import (
 )
 
 type XrayTrafficJob struct {
-	settingService  service.SettingService
-	xrayService     service.XrayService
-	inboundService  service.InboundService
-	outboundService service.OutboundService
+	settingService        service.SettingService
+	xrayService           service.XrayService
+	inboundService        service.InboundService
+	outboundService       service.OutboundService
+	trafficHistoryService service.TrafficHistoryService
 }
 
 func NewXrayTrafficJob() *XrayTrafficJob {
@@ -40,7 +41,7 @@ func (j *XrayTrafficJob) Run() {
 	}
 	logger.Debugf("XrayTrafficJob: Collected traffic for %d inbounds and %d clients", len(traffics), len(clientTraffics))
 
-	err, needRestart0 := j.inboundService.AddTraffic(traffics, clientTraffics)
+	err, needRestart0, wireguardTraffics := j.inboundService.AddTraffic(traffics, clientTraffics)
 	if err != nil {
 		logger.Error("XrayTrafficJob: Failed to add inbound traffic:", err)
 	}
@@ -50,6 +51,16 @@ func (j *XrayTrafficJob) Run() {
 		logger.Error("XrayTrafficJob: Failed to add outbound traffic:", err)
 	}
 
+	// 中文注释: 流量用尽后限速或重置后恢复时，立即通过 API 切换用户的限速等级
+	if _, err := j.inboundService.SyncClientSpeeds(); err != nil {
+		logger.Warning("XrayTrafficJob: Failed to sync client speeds:", err)
+	}
+
+	// 中文注释: WireGuard 对端的流量不在 API 的客户端统计中，由入站流量换算后一并记录
+	if err := j.trafficHistoryService.Record(traffics, append(clientTraffics, wireguardTraffics...)); err != nil {
+		logger.Warning("XrayTrafficJob: Failed to record traffic history:", err)
+	}
+
 	ExternalTrafficInformEnable, err := j.settingService.GetExternalTrafficInformEnable()
 	if err != nil {
 		logger.Warning("XrayTrafficJob: Failed to get ExternalTrafficInformEnable setting:", err)
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"time"
+
+	"x-ui/database/model"
+	"x-ui/util/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AccountingDirectionUp   = "up"
+	AccountingDirectionDown = "down"
+)
+
+// parseAccountingRule 中文注释: 解析并检查入站的计费规则，为空时返回 nil。
+func parseAccountingRule(text string) (*model.AccountingRule, error) {
+	if text == "" {
+		return nil, nil
+	}
+	rule := &model.AccountingRule{Multiplier: 1}
+	if err := json.Unmarshal([]byte(text), rule); err != nil {
+		return nil, common.NewError("invalid accounting rule:", err)
+	}
+	if rule.Multiplier < 0 || math.IsNaN(rule.Multiplier) || math.IsInf(rule.Multiplier, 0) {
+		return nil, common.NewError("invalid accounting multiplier:", rule.Multiplier)
+	}
+	switch rule.Direction {
+	case "", AccountingDirectionUp, AccountingDirectionDown:
+	default:
+		return nil, common.NewError("invalid accounting direction:", rule.Direction)
+	}
+	for _, window := range rule.FreeWindows {
+		if _, err := time.Parse("15:04", window.Start); err != nil {
+			return nil, common.NewError("invalid free window start:", window.Start)
+		}
+		if _, err := time.Parse("15:04", window.End); err != nil {
+			return nil, common.NewError("invalid free window end:", window.End)
+		}
+		for _, day := range window.Days {
+			if day < 0 || day > 6 {
+				return nil, common.NewError("invalid free window day:", day)
+			}
+		}
+	}
+	return rule, nil
+}
+
+// isFreeTime 中文注释: 判断 now(已转换到面板时区)是否处于免费时段。
+func isFreeTime(rule *model.AccountingRule, now time.Time) bool {
+	for _, window := range rule.FreeWindows {
+		if inTimeWindow(window, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// inTimeWindow 中文注释: 判断 now(已转换到面板时区)是否处于时段内，免费时段和限速时段共用。
+func inTimeWindow(window model.FreeWindow, now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	weekday := int(now.Weekday())
+	start, _ := time.Parse("15:04", window.Start)
+	end, _ := time.Parse("15:04", window.End)
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+	// 中文注释: 跨越午夜的时段在次日部分按前一天的星期判断
+	day := weekday
+	inWindow := false
+	switch {
+	case startMinute == endMinute:
+		inWindow = true
+	case startMinute < endMinute:
+		inWindow = minute >= startMinute && minute < endMinute
+	case minute >= startMinute:
+		inWindow = true
+	case minute < endMinute:
+		inWindow = true
+		day = (weekday + 6) % 7
+	}
+	return inWindow && (len(window.Days) == 0 || slices.Contains(window.Days, day))
+}
+
+// billTraffic 中文注释: 按计费规则把原始上下行流量折算为计费流量，rule 为 nil 时原样返回。
+func billTraffic(rule *model.AccountingRule, up int64, down int64, now time.Time) (int64, int64) {
+	if rule == nil {
+		return up, down
+	}
+	if isFreeTime(rule, now) {
+		return 0, 0
+	}
+	switch rule.Direction {
+	case AccountingDirectionUp:
+		down = 0
+	case AccountingDirectionDown:
+		up = 0
+	}
+	if rule.Multiplier != 1 {
+		up = int64(math.Round(float64(up) * rule.Multiplier))
+		down = int64(math.Round(float64(down) * rule.Multiplier))
+	}
+	return up, down
+}
+
+// accountingRules 中文注释: 一次流量统计中使用的计费规则，按入站 ID 和 tag 索引。
+type accountingRules struct {
+	byId  map[int]*model.AccountingRule
+	byTag map[string]*model.AccountingRule
+	now   time.Time
+}
+
+// getAccountingRules 中文注释: 读取所有配置了计费规则的入站，无效规则按 1:1 计费。
+func (s *InboundService) getAccountingRules(tx *gorm.DB) (*accountingRules, error) {
+	var inbounds []*model.Inbound
+	err := tx.Model(model.Inbound{}).
+		Select("id, tag, accounting").
+		Where("accounting IS NOT NULL AND accounting <> ''").
+		Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+	loc, err := s.settingService.GetTimeLocation()
+	if err != nil {
+		loc = time.Local
+	}
+	rules := &accountingRules{
+		byId:  make(map[int]*model.AccountingRule, len(inbounds)),
+		byTag: make(map[string]*model.AccountingRule, len(inbounds)),
+		now:   time.Now().In(loc),
+	}
+	for _, inbound := range inbounds {
+		rule, err := parseAccountingRule(inbound.Accounting)
+		if err != nil || rule == nil {
+			continue
+		}
+		rules.byId[inbound.Id] = rule
+		rules.byTag[inbound.Tag] = rule
+	}
+	return rules, nil
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+const (
+	ResetScheduleMonthly = "monthly"
+	ResetScheduleWeekly  = "weekly"
+	ResetScheduleCron    = "cron"
+)
+
+// monthlySchedule 中文注释: 每月指定日期 0 点重置，日期超过当月天数时在当月最后一天重置。
+type monthlySchedule struct {
+	day int
+	loc *time.Location
+}
+
+func (m monthlySchedule) Next(t time.Time) time.Time {
+	t = t.In(m.loc)
+	for i := 0; i < 2; i++ {
+		year, month := t.Year(), t.Month()+time.Month(i)
+		lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, m.loc).Day()
+		next := time.Date(year, month, min(m.day, lastDay), 0, 0, 0, 0, m.loc)
+		if next.After(t) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// parseResetSchedule 中文注释: 解析客户端的重置计划。cron 表达式未指定 CRON_TZ 时使用面板时区。
+func parseResetSchedule(spec string, loc *time.Location) (cron.Schedule, error) {
+	kind, value, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	value = strings.TrimSpace(value)
+	switch kind {
+	case ResetScheduleMonthly:
+		day, err := strconv.Atoi(value)
+		if err != nil || day < 1 || day > 31 {
+			return nil, common.NewError("invalid monthly reset day:", value)
+		}
+		return monthlySchedule{day: day, loc: loc}, nil
+	case ResetScheduleWeekly:
+		weekday, err := strconv.Atoi(value)
+		if err != nil || weekday < 0 || weekday > 6 {
+			return nil, common.NewError("invalid weekly reset day:", value)
+		}
+		schedule, _ := cron.ParseStandard(fmt.Sprintf("0 0 * * %d", weekday))
+		schedule.(*cron.SpecSchedule).Location = loc
+		return schedule, nil
+	case ResetScheduleCron:
+		schedule, err := cron.ParseStandard(value)
+		if err != nil {
+			return nil, common.NewError("invalid reset cron expression:", err)
+		}
+		if spec, ok := schedule.(*cron.SpecSchedule); ok && !strings.HasPrefix(value, "CRON_TZ=") && !strings.HasPrefix(value, "TZ=") {
+			spec.Location = loc
+		}
+		return schedule, nil
+	}
+	return nil, common.NewError("invalid reset schedule:", spec)
+}
+
+// checkResetSchedules 中文注释: 保存客户端前检查重置计划格式。
+func (s *InboundService) checkResetSchedules(clients []model.Client) error {
+	for _, client := range clients {
+		if client.ResetSchedule == "" {
+			continue
+		}
+		if _, err := parseResetSchedule(client.ResetSchedule, time.Local); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getNextReset 中文注释: 返回 after 之后的下一次重置时间(毫秒)，计划为空或无效时返回 0。
+func (s *InboundService) getNextReset(spec string, after time.Time) int64 {
+	if spec == "" {
+		return 0
+	}
+	loc, err := s.settingService.GetTimeLocation()
+	if err != nil {
+		loc = time.Local
+	}
+	schedule, err := parseResetSchedule(spec, loc)
+	if err != nil {
+		logger.Warning("Invalid reset schedule:", spec, err)
+		return 0
+	}
+	next := schedule.Next(after)
+	if next.IsZero() {
+		return 0
+	}
+	return next.UnixMilli()
+}
+
+// updateResetSchedule 中文注释: 计划变化时更新统计记录中的计划和下次重置时间；计划未变时保留已排定的重置。
+func (s *InboundService) updateResetSchedule(tx *gorm.DB, email string, spec string) error {
+	var traffic xray.ClientTraffic
+	err := tx.Model(xray.ClientTraffic{}).Where("email = ?", email).First(&traffic).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+	if traffic.ResetSchedule == spec && (spec == "" || traffic.NextReset > 0) {
+		return nil
+	}
+	return tx.Model(xray.ClientTraffic{}).
+		Where("email = ?", email).
+		Updates(map[string]any{
+			"reset_schedule": spec,
+			"next_reset":     s.getNextReset(spec, time.Now()),
+		}).Error
+}
+
+// resetScheduledClients 中文注释: 对到达重置时间的客户端先归档本周期用量，再清零上下行流量并排定下一次重置。
+// 因流量耗尽被禁用且未到期的客户端会重新启用。
+func (s *InboundService) resetScheduledClients(tx *gorm.DB) (bool, int64, error) {
+	now := time.Now()
+	var traffics []*xray.ClientTraffic
+	err := tx.Model(xray.ClientTraffic{}).
+		Where("next_reset > 0 AND next_reset <= ?", now.UnixMilli()).
+		Find(&traffics).Error
+	if err != nil {
+		return false, 0, err
+	}
+	if len(traffics) == 0 {
+		return false, 0, nil
+	}
+
+	var archives []model.ClientUsageArchive
+	enabledEmails := make(map[string]bool)
+	var inboundIds []int
+	for _, traffic := range traffics {
+		archives = append(archives, model.ClientUsageArchive{
+			Email:       traffic.Email,
+			InboundId:   traffic.InboundId,
+			PeriodStart: traffic.LastReset,
+			PeriodEnd:   traffic.NextReset,
+			Up:          traffic.Up,
+			Down:        traffic.Down,
+			RawUp:       traffic.RawUp,
+			RawDown:     traffic.RawDown,
+		})
+		if !traffic.Enable && (traffic.ExpiryTime <= 0 || traffic.ExpiryTime > now.UnixMilli()) {
+			traffic.Enable = true
+			enabledEmails[traffic.Email] = true
+			if !slices.Contains(inboundIds, traffic.InboundId) {
+				inboundIds = append(inboundIds, traffic.InboundId)
+			}
+		}
+		traffic.LastReset = traffic.NextReset
+		traffic.NextReset = s.getNextReset(traffic.ResetSchedule, now)
+		traffic.Up = 0
+		traffic.Down = 0
+		traffic.RawUp = 0
+		traffic.RawDown = 0
+	}
+	if err = tx.CreateInBatches(&archives, 100).Error; err != nil {
+		return false, 0, err
+	}
+	if err = tx.Save(traffics).Error; err != nil {
+		return false, 0, err
+	}
+	if len(inboundIds) == 0 || p == nil {
+		return false, int64(len(traffics)), nil
+	}
+
+	var inbounds []*model.Inbound
+	if err = tx.Model(model.Inbound{}).Where("id IN ?", inboundIds).Find(&inbounds).Error; err != nil {
+		return false, 0, err
+	}
+	xrayService := XrayService{}
+	apiPort := xrayService.GetApiPort()
+	if apiPort <= 0 {
+		apiPort = xray.GetApiPortFromConfig()
+	}
+	if err1 := s.xrayApi.Init(apiPort); err1 != nil {
+		return true, int64(len(traffics)), nil
+	}
+	defer s.xrayApi.Close()
+	needRestart := false
+	for _, inbound := range inbounds {
+		if !inbound.Enable {
+			continue
+		}
+		if isInboundReloadProtocol(inbound.Protocol) {
+			if err1 := s.reloadInboundByApi(tx, inbound); err1 != nil {
+				logger.Debug("Error in reloading inbound by api:", err1)
+				needRestart = true
+			}
+			continue
+		}
+		settings := map[string]any{}
+		json.Unmarshal([]byte(inbound.Settings), &settings)
+		clients, _ := settings["clients"].([]any)
+		for _, clientRaw := range clients {
+			c, ok := clientRaw.(map[string]any)
+			if !ok {
+				continue
+			}
+			email, _ := c["email"].(string)
+			if enable, _ := c["enable"].(bool); !enable || !enabledEmails[email] {
+				continue
+			}
+			user, limit := s.userWithSpeedLevel(inbound, c)
+			if err1 := s.xrayApi.AddUser(string(inbound.Protocol), inbound.Tag, user); err1 != nil {
+				logger.Debug("Error in enabling client by api:", err1)
+				needRestart = true
+			} else {
+				setAppliedSpeed(email, limit)
+			}
+		}
+	}
+	return needRestart, int64(len(traffics)), nil
+}
+
+// GetUsageArchives 中文注释: 查询计费周期用量归档，email 为空时返回全部客户端，按周期结束时间倒序。
+func (s *InboundService) GetUsageArchives(email string) ([]*model.ClientUsageArchive, error) {
+	db := database.GetDB()
+	query := db.Model(model.ClientUsageArchive{})
+	if email != "" {
+		query = query.Where("email = ?", email)
+	}
+	var archives []*model.ClientUsageArchive
+	err := query.Order("period_end DESC, id DESC").Find(&archives).Error
+	if err != nil {
+		return nil, err
+	}
+	return archives, nil
+}
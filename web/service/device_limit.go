@@ -0,0 +1,488 @@
+package service
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeviceActiveTTL 中文注释: 活跃判断窗口，IP 在此时间内出现过就算在线设备。
+const DeviceActiveTTL = 3 * time.Minute
+
+const (
+	DeviceModeBan        = "ban"
+	DeviceModeKickOldest = "kickOldest"
+	DeviceModeNotify     = "notify"
+)
+
+const (
+	DeviceBanActionBan    = "ban"
+	DeviceBanActionUnban  = "unban"
+	DeviceBanActionExempt = "exempt"
+	DeviceBanActionKick   = "kick"
+	DeviceBanActionNotify = "notify"
+)
+
+const (
+	// DeviceUnbanRecovered 中文注释: 在线设备数已恢复到限制以内
+	DeviceUnbanRecovered = "recovered"
+	// DeviceUnbanOffline 中文注释: 客户端已完全下线
+	DeviceUnbanOffline = "offline"
+	// DeviceUnbanManual 中文注释: 管理员手动解封
+	DeviceUnbanManual = "manual"
+	// DeviceUnbanReleased 中文注释: 入站取消了设备限制，或客户端、入站已被禁用或删除
+	DeviceUnbanReleased = "released"
+	// DeviceUnbanExpired 中文注释: 按封禁次数加重的封禁时长已到
+	DeviceUnbanExpired = "expired"
+)
+
+// ParseDevicePolicy 中文注释: 解析并检查入站的设备超限策略，为空时返回默认的立即封禁策略。
+func ParseDevicePolicy(text string) (*model.DevicePolicy, error) {
+	policy := &model.DevicePolicy{}
+	if text != "" {
+		if err := json.Unmarshal([]byte(text), policy); err != nil {
+			return nil, common.NewError("invalid device policy:", err)
+		}
+	}
+	if policy.Mode == "" {
+		policy.Mode = DeviceModeBan
+	}
+	if err := CheckDeviceMode(policy.Mode); err != nil {
+		return nil, err
+	}
+	if policy.Grace < 0 {
+		return nil, common.NewError("invalid device policy grace:", policy.Grace)
+	}
+	if policy.StrikeWindow < 0 {
+		return nil, common.NewError("invalid device policy strike window:", policy.StrikeWindow)
+	}
+	for _, minutes := range policy.Strikes {
+		if minutes <= 0 {
+			return nil, common.NewError("invalid device policy strike:", minutes)
+		}
+	}
+	return policy, nil
+}
+
+func CheckDeviceMode(mode string) error {
+	switch mode {
+	case DeviceModeBan, DeviceModeKickOldest, DeviceModeNotify:
+		return nil
+	}
+	return common.NewError("invalid device limit mode:", mode)
+}
+
+// checkClientDeviceLimits 中文注释: 保存客户端前检查设备限制、超限处理方式和信任 IP。
+func (s *InboundService) checkClientDeviceLimits(clients []model.Client) error {
+	for _, client := range clients {
+		if client.DeviceLimit < 0 {
+			return common.NewErrorf("client %s: invalid device limit: %d", client.Email, client.DeviceLimit)
+		}
+		if client.DeviceMode != "" {
+			if err := CheckDeviceMode(client.DeviceMode); err != nil {
+				return err
+			}
+		}
+		if _, err := ParseTrustedIPs(client.TrustedIPs); err != nil {
+			return common.NewErrorf("client %s: %v", client.Email, err)
+		}
+	}
+	return nil
+}
+
+// ParseTrustedIPs 中文注释: 解析客户端的信任 IP 列表，单个 IP 按 /32 或 /128 处理。
+func ParseTrustedIPs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, common.NewError("invalid trusted IP:", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, common.NewError("invalid trusted IP:", item)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// DeviceKey 中文注释: 返回 IP 在设备计数中的归属，同一前缀网段内的地址算作一个设备。
+// 前缀等于地址长度时返回 IP 本身，否则返回网段(CIDR)，可直接用作路由规则的 source。
+func DeviceKey(ip net.IP, v4Prefix int, v6Prefix int) string {
+	bits, prefix := 128, v6Prefix
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits, prefix = ip4, 32, v4Prefix
+	}
+	if prefix <= 0 || prefix >= bits {
+		return ip.String()
+	}
+	mask := net.CIDRMask(prefix, bits)
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
+
+// DeviceLimitService 中文注释: 持久化设备限制的封禁状态和 IP 活跃记录，使面板重启后能够恢复。
+type DeviceLimitService struct{}
+
+// DeviceBanDetail 中文注释: 当前封禁及其仍在线的 IP。
+type DeviceBanDetail struct {
+	model.DeviceBan
+	Ips []string `json:"ips"`
+}
+
+// GetSightings 中文注释: 返回 since 之后仍活跃的 IP，结构为 email -> IP -> 最后活跃时间。
+func (s *DeviceLimitService) GetSightings(since time.Time) (map[string]map[string]time.Time, error) {
+	var sightings []*model.DeviceIpSighting
+	db := database.GetDB()
+	err := db.Model(model.DeviceIpSighting{}).Where("last_seen >= ?", since.UnixMilli()).Find(&sightings).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]map[string]time.Time)
+	for _, sighting := range sightings {
+		if result[sighting.Email] == nil {
+			result[sighting.Email] = make(map[string]time.Time)
+		}
+		result[sighting.Email][sighting.Ip] = time.UnixMilli(sighting.LastSeen)
+	}
+	return result, nil
+}
+
+// SaveSightings 中文注释: 写入新的 IP 活跃记录，已存在的记录更新最后活跃时间。
+func (s *DeviceLimitService) SaveSightings(seen map[string]map[string]time.Time) error {
+	var sightings []model.DeviceIpSighting
+	for email, ips := range seen {
+		for ip, lastSeen := range ips {
+			sightings = append(sightings, model.DeviceIpSighting{
+				Email:     email,
+				Ip:        ip,
+				FirstSeen: lastSeen.UnixMilli(),
+				LastSeen:  lastSeen.UnixMilli(),
+			})
+		}
+	}
+	if len(sightings) == 0 {
+		return nil
+	}
+	db := database.GetDB()
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "email"}, {Name: "ip"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_seen"}),
+	}).CreateInBatches(&sightings, 100).Error
+}
+
+// GetFirstSeen 中文注释: 返回 since 之后仍活跃的 IP 首次出现的时间，用于判断设备上线先后。
+func (s *DeviceLimitService) GetFirstSeen(since time.Time) (map[string]map[string]time.Time, error) {
+	var sightings []*model.DeviceIpSighting
+	db := database.GetDB()
+	err := db.Model(model.DeviceIpSighting{}).Where("last_seen >= ?", since.UnixMilli()).Find(&sightings).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]map[string]time.Time)
+	for _, sighting := range sightings {
+		if result[sighting.Email] == nil {
+			result[sighting.Email] = make(map[string]time.Time)
+		}
+		firstSeen := sighting.FirstSeen
+		if firstSeen == 0 {
+			firstSeen = sighting.LastSeen
+		}
+		result[sighting.Email][sighting.Ip] = time.UnixMilli(firstSeen)
+	}
+	return result, nil
+}
+
+// DeleteSightingsBefore 中文注释: 删除 before 之前就不再活跃的 IP 记录。
+func (s *DeviceLimitService) DeleteSightingsBefore(before time.Time) error {
+	db := database.GetDB()
+	return db.Where("last_seen < ?", before.UnixMilli()).Delete(model.DeviceIpSighting{}).Error
+}
+
+func (s *DeviceLimitService) GetBans() ([]*model.DeviceBan, error) {
+	var bans []*model.DeviceBan
+	db := database.GetDB()
+	err := db.Model(model.DeviceBan{}).Order("banned_at DESC").Find(&bans).Error
+	if err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+// GetBanDetails 中文注释: 返回当前封禁列表，附带每个客户端仍在线的 IP。
+func (s *DeviceLimitService) GetBanDetails() ([]*DeviceBanDetail, error) {
+	bans, err := s.GetBans()
+	if err != nil {
+		return nil, err
+	}
+	sightings, err := s.GetSightings(time.Now().Add(-DeviceActiveTTL))
+	if err != nil {
+		return nil, err
+	}
+	details := make([]*DeviceBanDetail, 0, len(bans))
+	for _, ban := range bans {
+		ips := make([]string, 0, len(sightings[ban.Email]))
+		for ip := range sightings[ban.Email] {
+			ips = append(ips, ip)
+		}
+		sort.Strings(ips)
+		details = append(details, &DeviceBanDetail{DeviceBan: *ban, Ips: ips})
+	}
+	return details, nil
+}
+
+// GetBannedEmails 中文注释: 返回当前被设备限制封禁的客户端 email 集合。
+func (s *DeviceLimitService) GetBannedEmails() (map[string]bool, error) {
+	var emails []string
+	db := database.GetDB()
+	if err := db.Model(model.DeviceBan{}).Pluck("email", &emails).Error; err != nil {
+		return nil, err
+	}
+	banned := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		banned[email] = true
+	}
+	return banned, nil
+}
+
+// SaveBan 中文注释: 记录封禁并写入历史，同一客户端已有记录时覆盖。
+func (s *DeviceLimitService) SaveBan(ban *model.DeviceBan) error {
+	if ban.BannedAt == 0 {
+		ban.BannedAt = time.Now().UnixMilli()
+	}
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "email"}},
+			DoUpdates: clause.AssignmentColumns([]string{"inbound_id", "device_limit", "active_ips", "banned_at", "until"}),
+		}).Create(ban).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&model.DeviceBanLog{
+			Email:       ban.Email,
+			InboundId:   ban.InboundId,
+			Action:      DeviceBanActionBan,
+			DeviceLimit: ban.DeviceLimit,
+			ActiveIps:   ban.ActiveIps,
+			CreatedAt:   ban.BannedAt,
+		}).Error
+	})
+}
+
+// CountBans 中文注释: 返回客户端在 since 之后被封禁的次数，用于逐次加重封禁时长。
+func (s *DeviceLimitService) CountBans(email string, since time.Time) (int64, error) {
+	var count int64
+	db := database.GetDB()
+	err := db.Model(model.DeviceBanLog{}).
+		Where("email = ? AND action = ? AND created_at >= ?", email, DeviceBanActionBan, since.UnixMilli()).
+		Count(&count).Error
+	return count, err
+}
+
+// AddLog 中文注释: 写入不改变封禁状态的历史记录，如阻断旧设备和仅通知。
+func (s *DeviceLimitService) AddLog(log *model.DeviceBanLog) error {
+	if log.CreatedAt == 0 {
+		log.CreatedAt = time.Now().UnixMilli()
+	}
+	db := database.GetDB()
+	return db.Create(log).Error
+}
+
+// ReleaseBan 中文注释: 删除封禁记录并写入解封历史，客户端未被封禁时不做任何事。
+func (s *DeviceLimitService) ReleaseBan(email string, reason string, activeIps int) error {
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		return s.releaseBan(tx, email, reason, activeIps)
+	})
+}
+
+func (s *DeviceLimitService) releaseBan(tx *gorm.DB, email string, reason string, activeIps int) error {
+	ban := &model.DeviceBan{}
+	err := tx.Model(model.DeviceBan{}).Where("email = ?", email).First(ban).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+	if err = tx.Delete(ban).Error; err != nil {
+		return err
+	}
+	return tx.Create(&model.DeviceBanLog{
+		Email:       email,
+		InboundId:   ban.InboundId,
+		Action:      DeviceBanActionUnban,
+		Reason:      reason,
+		DeviceLimit: ban.DeviceLimit,
+		ActiveIps:   activeIps,
+		CreatedAt:   time.Now().UnixMilli(),
+	}).Error
+}
+
+// UnbanClient 中文注释: 手动解封客户端；minutes 大于 0 时同时豁免该客户端 minutes 分钟，期间不再因设备数超限被封禁。
+// Xray 中的客户端由设备限制任务在下一次检查时恢复。
+func (s *DeviceLimitService) UnbanClient(email string, minutes int) error {
+	if email == "" {
+		return common.NewError("client email is empty")
+	}
+	if minutes < 0 {
+		return common.NewError("invalid exemption minutes:", minutes)
+	}
+	db := database.GetDB()
+	var count int64
+	if err := db.Model(model.DeviceBan{}).Where("email = ?", email).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 && minutes == 0 {
+		return common.NewError("client is not banned:", email)
+	}
+	activeIps := 0
+	if sightings, err := s.GetSightings(time.Now().Add(-DeviceActiveTTL)); err == nil {
+		activeIps = len(sightings[email])
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := s.releaseBan(tx, email, DeviceUnbanManual, activeIps); err != nil {
+			return err
+		}
+		if minutes == 0 {
+			return nil
+		}
+		return s.exemptClient(tx, email, minutes, activeIps)
+	})
+}
+
+// ExemptClient 中文注释: 豁免客户端 minutes 分钟，已被封禁的客户端会被解封。
+func (s *DeviceLimitService) ExemptClient(email string, minutes int) error {
+	if minutes <= 0 {
+		return common.NewError("invalid exemption minutes:", minutes)
+	}
+	return s.UnbanClient(email, minutes)
+}
+
+func (s *DeviceLimitService) exemptClient(tx *gorm.DB, email string, minutes int, activeIps int) error {
+	now := time.Now()
+	exemption := &model.DeviceExemption{Email: email, Until: now.Add(time.Duration(minutes) * time.Minute).UnixMilli()}
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "email"}},
+		DoUpdates: clause.AssignmentColumns([]string{"until"}),
+	}).Create(exemption).Error
+	if err != nil {
+		return err
+	}
+	return tx.Create(&model.DeviceBanLog{
+		Email:     email,
+		Action:    DeviceBanActionExempt,
+		ActiveIps: activeIps,
+		CreatedAt: now.UnixMilli(),
+	}).Error
+}
+
+// GetExemptions 中文注释: 返回仍在有效期内的豁免。
+func (s *DeviceLimitService) GetExemptions() ([]*model.DeviceExemption, error) {
+	var exemptions []*model.DeviceExemption
+	db := database.GetDB()
+	err := db.Model(model.DeviceExemption{}).
+		Where("until > ?", time.Now().UnixMilli()).
+		Order("until").
+		Find(&exemptions).Error
+	if err != nil {
+		return nil, err
+	}
+	return exemptions, nil
+}
+
+// GetExemptEmails 中文注释: 返回当前豁免中的客户端 email 集合。
+func (s *DeviceLimitService) GetExemptEmails() (map[string]bool, error) {
+	exemptions, err := s.GetExemptions()
+	if err != nil {
+		return nil, err
+	}
+	exempt := make(map[string]bool, len(exemptions))
+	for _, exemption := range exemptions {
+		exempt[exemption.Email] = true
+	}
+	return exempt, nil
+}
+
+// GetTrustedNets 中文注释: 返回设置了信任 IP 的客户端，结构为 email -> 信任网段。
+func (s *DeviceLimitService) GetTrustedNets() (map[string][]*net.IPNet, error) {
+	var inbounds []*model.Inbound
+	db := database.GetDB()
+	err := db.Model(model.Inbound{}).Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+	inboundService := InboundService{}
+	trusted := make(map[string][]*net.IPNet)
+	for _, inbound := range inbounds {
+		clients, err := inboundService.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		for _, client := range clients {
+			if len(client.TrustedIPs) == 0 {
+				continue
+			}
+			nets, err := ParseTrustedIPs(client.TrustedIPs)
+			if err != nil {
+				logger.Warningf("〔设备限制〕客户端 %s 的信任IP无效: %v", client.Email, err)
+				continue
+			}
+			trusted[client.Email] = nets
+		}
+	}
+	return trusted, nil
+}
+
+func (s *DeviceLimitService) DelExemption(email string) error {
+	db := database.GetDB()
+	return db.Where("email = ?", email).Delete(model.DeviceExemption{}).Error
+}
+
+// DeleteExpiredExemptions 中文注释: 删除已过期的豁免。
+func (s *DeviceLimitService) DeleteExpiredExemptions() error {
+	db := database.GetDB()
+	return db.Where("until <= ?", time.Now().UnixMilli()).Delete(model.DeviceExemption{}).Error
+}
+
+// GetBanLogs 中文注释: 按时间倒序查询封禁历史，email 为空时返回全部客户端，limit 不大于 0 时最多返回 500 条。
+func (s *DeviceLimitService) GetBanLogs(email string, limit int) ([]*model.DeviceBanLog, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 500
+	}
+	db := database.GetDB()
+	query := db.Model(model.DeviceBanLog{})
+	if email != "" {
+		query = query.Where("email = ?", email)
+	}
+	var logs []*model.DeviceBanLog
+	err := query.Order("created_at DESC, id DESC").Limit(limit).Find(&logs).Error
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
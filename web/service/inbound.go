@@ -3,6 +3,7 @@ package service
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -18,7 +19,8 @@ import (
 )
 
 type InboundService struct {
-	xrayApi xray.XrayAPI
+	xrayApi        xray.XrayAPI
+	settingService SettingService
 }
 
 func (s *InboundService) GetInbounds(userId int) ([]*model.Inbound, error) {
@@ -129,6 +131,39 @@ func (s *InboundService) checkEmailsExistForClients(clients []model.Client) (str
 	return "", nil
 }
 
+// validateClients 中文注释: 校验客户端的重置计划、设备限制、限速、限速时段和超额处理，
+// 新增/修改入站和客户端都通过这里校验，保证各入口的规则一致
+func (s *InboundService) validateClients(clients []model.Client) error {
+	if err := s.checkResetSchedules(clients); err != nil {
+		return err
+	}
+	if err := s.checkClientDeviceLimits(clients); err != nil {
+		return err
+	}
+	if err := s.checkClientSpeedLimits(clients); err != nil {
+		return err
+	}
+	if err := s.checkClientSpeedSchedules(clients); err != nil {
+		return err
+	}
+	return s.checkClientQuotaActions(clients)
+}
+
+// validateInboundRules 中文注释: 校验入站的限速、限速时段、计费规则和设备策略
+func (s *InboundService) validateInboundRules(inbound *model.Inbound) error {
+	if err := checkSpeedLimit("inbound", inbound.UpLimit, inbound.DownLimit); err != nil {
+		return err
+	}
+	if _, err := parseSpeedSchedule(inbound.SpeedSchedule); err != nil {
+		return err
+	}
+	if _, err := parseAccountingRule(inbound.Accounting); err != nil {
+		return err
+	}
+	_, err := ParseDevicePolicy(inbound.DevicePolicy)
+	return err
+}
+
 func (s *InboundService) checkEmailExistForInbound(inbound *model.Inbound) (string, error) {
 	clients, err := s.GetClients(inbound)
 	if err != nil {
@@ -203,6 +238,21 @@ func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, boo
 		}
 	}
 
+	// 中文注释：为 WireGuard 客户端生成密钥并分配地址
+	if inbound.Protocol == model.WireGuard {
+		err = s.fillWireguardClients(inbound)
+		if err != nil {
+			return inbound, false, err
+		}
+		clients, err = s.GetClients(inbound)
+		if err != nil {
+			return inbound, false, err
+		}
+		if err = s.checkWireguardQuotas(inbound); err != nil {
+			return inbound, false, err
+		}
+	}
+
 	// 中文注释：根据不同协议，验证客户端ID/密码是否为空
 	for _, client := range clients {
 		switch inbound.Protocol {
@@ -210,7 +260,7 @@ func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, boo
 			if client.Password == "" {
 				return inbound, false, common.NewError("empty client ID")
 			}
-		case "shadowsocks":
+		case "shadowsocks", "wireguard", "socks", "http":
 			if client.Email == "" {
 				return inbound, false, common.NewError("empty client ID")
 			}
@@ -220,6 +270,12 @@ func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, boo
 			}
 		}
 	}
+	if err = s.validateClients(clients); err != nil {
+		return inbound, false, err
+	}
+	if err = s.validateInboundRules(inbound); err != nil {
+		return inbound, false, err
+	}
 
 	// =================================================================
 	// 中文注释：【新增逻辑】开始：手动计算和分配 ID
@@ -382,6 +438,24 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 
 	tag := oldInbound.Tag
 
+	err = s.fillWireguardClients(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	clients, err := s.GetClients(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	if err = s.checkWireguardQuotas(inbound); err != nil {
+		return inbound, false, err
+	}
+	if err = s.validateClients(clients); err != nil {
+		return inbound, false, err
+	}
+	if err = s.validateInboundRules(inbound); err != nil {
+		return inbound, false, err
+	}
+
 	db := database.GetDB()
 	tx := db.Begin()
 
@@ -457,6 +531,11 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 		}
 	}
 
+	// 中文注释: 计费流量被清零(重置流量)时一并清零原始流量
+	if inbound.Up == 0 && inbound.Down == 0 {
+		oldInbound.RawUp = 0
+		oldInbound.RawDown = 0
+	}
 	oldInbound.Up = inbound.Up
 	oldInbound.Down = inbound.Down
 	oldInbound.Total = inbound.Total
@@ -465,6 +544,12 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 	oldInbound.ExpiryTime = inbound.ExpiryTime
                  // 中文注释：确保在更新数据时，将前端传来的 deviceLimit 值赋给从数据库中读出的旧对象。
 	oldInbound.DeviceLimit = inbound.DeviceLimit
+	// 中文注释: 入站默认限速或限速时段的变化随下面重新添加入站时写入的 level 生效，不需要重启 Xray
+	oldInbound.UpLimit = inbound.UpLimit
+	oldInbound.DownLimit = inbound.DownLimit
+	oldInbound.SpeedSchedule = inbound.SpeedSchedule
+	oldInbound.Accounting = inbound.Accounting
+	oldInbound.DevicePolicy = inbound.DevicePolicy
 	oldInbound.Listen = inbound.Listen
 	oldInbound.Port = inbound.Port
 	oldInbound.Protocol = inbound.Protocol
@@ -488,7 +573,12 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 		logger.Debug("Old inbound deleted by api:", tag)
 	}
 	if inbound.Enable {
-		inboundJson, err2 := json.MarshalIndent(oldInbound.GenXrayInboundConfig(), "", "  ")
+		inboundConfig := oldInbound.GenXrayInboundConfig()
+		speeds, ok := s.withSpeedLevels(tx, oldInbound, inboundConfig)
+		if !ok {
+			needRestart = true
+		}
+		inboundJson, err2 := json.MarshalIndent(inboundConfig, "", "  ")
 		if err2 != nil {
 			logger.Debug("Unable to marshal updated inbound config:", err2)
 			needRestart = true
@@ -496,6 +586,9 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 			err2 = s.xrayApi.AddInbound(inboundJson)
 			if err2 == nil {
 				logger.Debug("Updated inbound added by api:", oldInbound.Tag)
+				for email, limit := range speeds {
+					setAppliedSpeed(email, limit)
+				}
 			} else {
 				logger.Debug("Unable to update inbound by api:", err2)
 				needRestart = true
@@ -547,6 +640,11 @@ func (s *InboundService) updateClientTraffics(tx *gorm.DB, oldInbound *model.Inb
 			if err != nil {
 				return err
 			}
+		} else {
+			err = s.updateResetSchedule(tx, newClient.Email, newClient.ResetSchedule)
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -602,7 +700,7 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 			if client.Password == "" {
 				return false, common.NewError("empty client ID")
 			}
-		case "shadowsocks":
+		case "shadowsocks", "wireguard", "socks", "http":
 			if client.Email == "" {
 				return false, common.NewError("empty client ID")
 			}
@@ -612,6 +710,9 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 			}
 		}
 	}
+	if err = s.validateClients(clients); err != nil {
+		return false, err
+	}
 
 	var oldSettings map[string]any
 	err = json.Unmarshal([]byte(oldInbound.Settings), &oldSettings)
@@ -631,6 +732,14 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 
 	oldInbound.Settings = string(newSettings)
 
+	err = s.fillWireguardClients(oldInbound)
+	if err != nil {
+		return false, err
+	}
+	if err = s.checkWireguardQuotas(oldInbound); err != nil {
+		return false, err
+	}
+
 	db := database.GetDB()
 	tx := db.Begin()
 
@@ -652,13 +761,18 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 	for _, client := range clients {
 		if len(client.Email) > 0 {
 			s.AddClientStat(tx, data.Id, &client)
-			if client.Enable {
+			if client.Enable && !isInboundReloadProtocol(oldInbound.Protocol) {
 				cipher := ""
 				if oldInbound.Protocol == "shadowsocks" {
 					cipher = oldSettings["method"].(string)
 				}
 
-				// 中文注释: 在这里为 API 调用添加 speedLimit 参数。
+				// 中文注释: 在这里为 API 调用添加限速对应的 level，当前配置中没有该限速组合时使用近似档位。
+				limit := s.CurrentSpeedLimit(oldInbound, &client)
+				level, ok := apiSpeedLevel(client.Email, limit)
+				if !ok {
+					needRestart = true
+				}
 					clientMap := map[string]any{
 					"email":    client.Email,
 					"id":       client.ID,
@@ -668,12 +782,13 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 					"cipher":   cipher,
 					
 					// Xray-core 会将这个值作为 level，然后去 policy 中寻找对应的限速策略。
-					"level":    client.SpeedLimit,
+					"level":    level,
 				}
 				err1 := s.xrayApi.AddUser(string(oldInbound.Protocol), oldInbound.Tag, clientMap)
 				
 				if err1 == nil {
 					logger.Debug("Client added by api:", client.Email)
+					setAppliedSpeed(client.Email, limit)
 				} else {
 					logger.Debug("Error in adding client by api:", err1)
 					needRestart = true
@@ -683,6 +798,13 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 			needRestart = true
 		}
 	}
+	if isInboundReloadProtocol(oldInbound.Protocol) && oldInbound.Enable {
+		err1 := s.reloadInboundByApi(tx, oldInbound)
+		if err1 != nil {
+			logger.Debug("Error in reloading inbound by api:", err1)
+			needRestart = true
+		}
+	}
 	s.xrayApi.Close()
 
 	return needRestart, tx.Save(oldInbound).Error
@@ -705,7 +827,7 @@ func (s *InboundService) DelInboundClient(inboundId int, clientId string) (bool,
 	if oldInbound.Protocol == "trojan" {
 		client_key = "password"
 	}
-	if oldInbound.Protocol == "shadowsocks" {
+	if oldInbound.Protocol == "shadowsocks" || oldInbound.Protocol == "wireguard" || oldInbound.Protocol == "socks" || oldInbound.Protocol == "http" {
 		client_key = "email"
 	}
 
@@ -763,7 +885,14 @@ func (s *InboundService) DelInboundClient(inboundId int, clientId string) (bool,
 				apiPort = xray.GetApiPortFromConfig()
 			}
 			s.xrayApi.Init(apiPort)
-			err1 := s.xrayApi.RemoveUser(oldInbound.Tag, email)
+			var err1 error
+			if isInboundReloadProtocol(oldInbound.Protocol) {
+				if oldInbound.Enable {
+					err1 = s.reloadInboundByApi(db, oldInbound)
+				}
+			} else {
+				err1 = s.xrayApi.RemoveUser(oldInbound.Tag, email)
+			}
 			if err1 == nil {
 				logger.Debug("Client deleted by api:", email)
 				needRestart = false
@@ -814,7 +943,7 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 		case "trojan":
 			oldClientId = oldClient.Password
 			newClientId = clients[0].Password
-		case "shadowsocks":
+		case "shadowsocks", "wireguard", "socks", "http":
 			oldClientId = oldClient.Email
 			newClientId = clients[0].Email
 		default:
@@ -832,6 +961,9 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 	if newClientId == "" || clientIndex == -1 {
 		return false, common.NewError("empty client ID")
 	}
+	if err = s.validateClients(clients); err != nil {
+		return false, err
+	}
 
 	if len(clients[0].Email) > 0 && clients[0].Email != oldEmail {
 		existEmail, err := s.checkEmailsExistForClients(clients)
@@ -883,6 +1015,14 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 	}
 
 	oldInbound.Settings = string(newSettings)
+
+	err = s.fillWireguardClients(oldInbound)
+	if err != nil {
+		return false, err
+	}
+	if err = s.checkWireguardQuotas(oldInbound); err != nil {
+		return false, err
+	}
 	db := database.GetDB()
 	tx := db.Begin()
 
@@ -925,7 +1065,17 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 			apiPort = xray.GetApiPortFromConfig()
 		}
 		s.xrayApi.Init(apiPort)
-		if oldClients[clientIndex].Enable {
+		if isInboundReloadProtocol(oldInbound.Protocol) {
+			if oldInbound.Enable {
+				err1 := s.reloadInboundByApi(tx, oldInbound)
+				if err1 == nil {
+					logger.Debug("Client edited by api:", clients[0].Email)
+				} else {
+					logger.Debug("Error in reloading inbound by api:", err1)
+					needRestart = true
+				}
+			}
+		} else if oldClients[clientIndex].Enable {
 			err1 := s.xrayApi.RemoveUser(oldInbound.Tag, oldEmail)
 			if err1 == nil {
 				logger.Debug("Old client deleted by api:", oldEmail)
@@ -938,13 +1088,18 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 				}
 			}
 		}
-		if clients[0].Enable {
+		if clients[0].Enable && !isInboundReloadProtocol(oldInbound.Protocol) {
 			cipher := ""
 			if oldInbound.Protocol == "shadowsocks" {
 				cipher = oldSettings["method"].(string)
 			}
 
-			// 中文注释: 同样，在更新用户时，也必须把新的 speedLimit 值通过 API 传给 Xray-core。
+			// 中文注释: 同样，在更新用户时，也必须把新的限速 level 通过 API 传给 Xray-core。
+			limit := s.CurrentSpeedLimit(oldInbound, &clients[0])
+			level, ok := apiSpeedLevel(clients[0].Email, limit)
+			if !ok {
+				needRestart = true
+			}
 			clientMap := map[string]any{
 				"email":    clients[0].Email,
 				"id":       clients[0].ID,
@@ -953,12 +1108,13 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 				"password": clients[0].Password,
 				"cipher":   cipher,
 				
-				"level":    clients[0].SpeedLimit,
+				"level":    level,
 			}
 			err1 := s.xrayApi.AddUser(string(oldInbound.Protocol), oldInbound.Tag, clientMap)
 			
 			if err1 == nil {
 				logger.Debug("Client edited by api:", clients[0].Email)
+				setAppliedSpeed(clients[0].Email, limit)
 			} else {
 				logger.Debug("Error in adding client by api:", err1)
 				needRestart = true
@@ -972,7 +1128,9 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 	return needRestart, tx.Save(oldInbound).Error
 }
 
-func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraffics []*xray.ClientTraffic) (error, bool) {
+// AddTraffic 中文注释: 累加入站和客户端流量，并处理续期、重置和超额禁用。
+// 第三个返回值为按入站流量换算出的 WireGuard 对端流量，供流量历史等与 API 客户端流量一并记录。
+func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraffics []*xray.ClientTraffic) (error, bool, []*xray.ClientTraffic) {
 	var err error
 	db := database.GetDB()
 	tx := db.Begin()
@@ -984,13 +1142,22 @@ func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraff
 			tx.Commit()
 		}
 	}()
-	err = s.addInboundTraffic(tx, inboundTraffics)
+	rules, err := s.getAccountingRules(tx)
 	if err != nil {
-		return err, false
+		return err, false, nil
 	}
-	err = s.addClientTraffic(tx, clientTraffics)
+	err = s.addInboundTraffic(tx, inboundTraffics, rules)
 	if err != nil {
-		return err, false
+		return err, false, nil
+	}
+	wireguardTraffics, err := s.getWireguardClientTraffics(tx, inboundTraffics)
+	if err != nil {
+		return err, false, nil
+	}
+	clientTraffics = append(clientTraffics, wireguardTraffics...)
+	err = s.addClientTraffic(tx, clientTraffics, rules)
+	if err != nil {
+		return err, false, nil
 	}
 
 	needRestart0, count, err := s.autoRenewClients(tx)
@@ -1000,6 +1167,13 @@ func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraff
 		logger.Debugf("%v clients renewed", count)
 	}
 
+	needRestart3, count, err := s.resetScheduledClients(tx)
+	if err != nil {
+		logger.Warning("Error in resetting scheduled clients:", err)
+	} else if count > 0 {
+		logger.Debugf("%v clients reset by schedule", count)
+	}
+
 	needRestart1, count, err := s.disableInvalidClients(tx)
 	if err != nil {
 		logger.Warning("Error in disabling invalid clients:", err)
@@ -1013,10 +1187,10 @@ func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraff
 	} else if count > 0 {
 		logger.Debugf("%v inbounds disabled", count)
 	}
-	return nil, (needRestart0 || needRestart1 || needRestart2)
+	return nil, (needRestart0 || needRestart1 || needRestart2 || needRestart3), wireguardTraffics
 }
 
-func (s *InboundService) addInboundTraffic(tx *gorm.DB, traffics []*xray.Traffic) error {
+func (s *InboundService) addInboundTraffic(tx *gorm.DB, traffics []*xray.Traffic, rules *accountingRules) error {
 	if len(traffics) == 0 {
 		return nil
 	}
@@ -1025,10 +1199,13 @@ func (s *InboundService) addInboundTraffic(tx *gorm.DB, traffics []*xray.Traffic
 
 	for _, traffic := range traffics {
 		if traffic.IsInbound {
+			up, down := billTraffic(rules.byTag[traffic.Tag], traffic.Up, traffic.Down, rules.now)
 			err = tx.Model(&model.Inbound{}).Where("tag = ?", traffic.Tag).
 				Updates(map[string]any{
-					"up":       gorm.Expr("up + ?", traffic.Up),
-					"down":     gorm.Expr("down + ?", traffic.Down),
+					"up":       gorm.Expr("up + ?", up),
+					"down":     gorm.Expr("down + ?", down),
+					"raw_up":   gorm.Expr("COALESCE(raw_up, 0) + ?", traffic.Up),
+					"raw_down": gorm.Expr("COALESCE(raw_down, 0) + ?", traffic.Down),
 					"all_time": gorm.Expr("COALESCE(all_time, 0) + ?", traffic.Up+traffic.Down),
 				}).Error
 			if err != nil {
@@ -1039,7 +1216,7 @@ func (s *InboundService) addInboundTraffic(tx *gorm.DB, traffics []*xray.Traffic
 	return nil
 }
 
-func (s *InboundService) addClientTraffic(tx *gorm.DB, traffics []*xray.ClientTraffic) (err error) {
+func (s *InboundService) addClientTraffic(tx *gorm.DB, traffics []*xray.ClientTraffic, rules *accountingRules) (err error) {
 	if len(traffics) == 0 {
 		// Empty onlineUsers
 		if p != nil {
@@ -1073,8 +1250,11 @@ func (s *InboundService) addClientTraffic(tx *gorm.DB, traffics []*xray.ClientTr
 	for dbTraffic_index := range dbClientTraffics {
 		for traffic_index := range traffics {
 			if dbClientTraffics[dbTraffic_index].Email == traffics[traffic_index].Email {
-				dbClientTraffics[dbTraffic_index].Up += traffics[traffic_index].Up
-				dbClientTraffics[dbTraffic_index].Down += traffics[traffic_index].Down
+				up, down := billTraffic(rules.byId[dbClientTraffics[dbTraffic_index].InboundId], traffics[traffic_index].Up, traffics[traffic_index].Down, rules.now)
+				dbClientTraffics[dbTraffic_index].Up += up
+				dbClientTraffics[dbTraffic_index].Down += down
+				dbClientTraffics[dbTraffic_index].RawUp += traffics[traffic_index].Up
+				dbClientTraffics[dbTraffic_index].RawDown += traffics[traffic_index].Down
 				dbClientTraffics[dbTraffic_index].AllTime += (traffics[traffic_index].Up + traffics[traffic_index].Down)
 
 				// Add user in onlineUsers array on traffic
@@ -1180,6 +1360,7 @@ func (s *InboundService) autoRenewClients(tx *gorm.DB) (bool, int64, error) {
 		protocol string
 		tag      string
 		client   map[string]any
+		limit    SpeedLimit
 	}
 
 	for _, traffic := range traffics {
@@ -1205,17 +1386,23 @@ func (s *InboundService) autoRenewClients(tx *gorm.DB) (bool, int64, error) {
 					traffics[traffic_index].ExpiryTime = newExpiryTime
 					traffics[traffic_index].Down = 0
 					traffics[traffic_index].Up = 0
+					traffics[traffic_index].RawDown = 0
+					traffics[traffic_index].RawUp = 0
+					traffics[traffic_index].LastReset = now
 					if !traffic.Enable {
 						traffics[traffic_index].Enable = true
+						user, limit := s.userWithSpeedLevel(inbounds[inbound_index], c)
 						clientsToAdd = append(clientsToAdd,
 							struct {
 								protocol string
 								tag      string
 								client   map[string]any
+								limit    SpeedLimit
 							}{
 								protocol: string(inbounds[inbound_index].Protocol),
 								tag:      inbounds[inbound_index].Tag,
-								client:   c,
+								client:   user,
+								limit:    limit,
 							})
 					}
 					clients[client_index] = any(c)
@@ -1252,6 +1439,8 @@ func (s *InboundService) autoRenewClients(tx *gorm.DB) (bool, int64, error) {
 			err1 = s.xrayApi.AddUser(clientToAdd.protocol, clientToAdd.tag, clientToAdd.client)
 			if err1 != nil {
 				needRestart = true
+			} else if email, _ := clientToAdd.client["email"].(string); email != "" {
+				setAppliedSpeed(email, clientToAdd.limit)
 			}
 		}
 		s.xrayApi.Close()
@@ -1301,17 +1490,35 @@ func (s *InboundService) disableInvalidInbounds(tx *gorm.DB) (bool, int64, error
 func (s *InboundService) disableInvalidClients(tx *gorm.DB) (bool, int64, error) {
 	now := time.Now().Unix() * 1000
 	needRestart := false
+	// 中文注释: 不支持按用户删除的协议，在统计记录被禁用后重新加载整个入站
+	var reloadInboundIds []int
+
+	// 中文注释: 流量用尽后处于限速阶段的客户端不按流量禁用，到期仍然禁用
+	throttledEmails, err := s.getQuotaThrottledEmails(tx)
+	if err != nil {
+		return false, 0, err
+	}
+	quotaCond := "(client_traffics.total > 0 AND client_traffics.up + client_traffics.down >= client_traffics.total)"
+	var quotaArgs []any
+	if len(throttledEmails) > 0 {
+		quotaCond = "(client_traffics.total > 0 AND client_traffics.up + client_traffics.down >= client_traffics.total AND client_traffics.email NOT IN ?)"
+		quotaArgs = append(quotaArgs, throttledEmails)
+	}
+	invalidCond := "(" + quotaCond + " OR (client_traffics.expiry_time > 0 AND client_traffics.expiry_time <= ?)) AND client_traffics.enable = ?"
+	invalidArgs := append(quotaArgs, now, true)
 
 	if p != nil {
 		var results []struct {
-			Tag   string
-			Email string
+			Id       int
+			Tag      string
+			Protocol model.Protocol
+			Email    string
 		}
 
 		err := tx.Table("inbounds").
-			Select("inbounds.tag, client_traffics.email").
+			Select("inbounds.id, inbounds.tag, inbounds.protocol, client_traffics.email").
 			Joins("JOIN client_traffics ON inbounds.id = client_traffics.inbound_id").
-			Where("((client_traffics.total > 0 AND client_traffics.up + client_traffics.down >= client_traffics.total) OR (client_traffics.expiry_time > 0 AND client_traffics.expiry_time <= ?)) AND client_traffics.enable = ?", now, true).
+			Where(invalidCond, invalidArgs...).
 			Scan(&results).Error
 		if err != nil {
 			return false, 0, err
@@ -1323,6 +1530,12 @@ func (s *InboundService) disableInvalidClients(tx *gorm.DB) (bool, int64, error)
 		}
 		s.xrayApi.Init(apiPort)
 		for _, result := range results {
+			if isInboundReloadProtocol(result.Protocol) {
+				if !slices.Contains(reloadInboundIds, result.Id) {
+					reloadInboundIds = append(reloadInboundIds, result.Id)
+				}
+				continue
+			}
 			err1 := s.xrayApi.RemoveUser(result.Tag, result.Email)
 			if err1 == nil {
 				logger.Debug("Client disabled by api:", result.Email)
@@ -1342,10 +1555,29 @@ func (s *InboundService) disableInvalidClients(tx *gorm.DB) (bool, int64, error)
 		s.xrayApi.Close()
 	}
 	result := tx.Model(xray.ClientTraffic{}).
-		Where("((total > 0 and up + down >= total) or (expiry_time > 0 and expiry_time <= ?)) and enable = ?", now, true).
+		Where(invalidCond, invalidArgs...).
 		Update("enable", false)
-	err := result.Error
+	err = result.Error
 	count := result.RowsAffected
+	if err == nil && len(reloadInboundIds) > 0 {
+		xrayService := XrayService{}
+		apiPort := xrayService.GetApiPort()
+		if apiPort <= 0 {
+			apiPort = xray.GetApiPortFromConfig()
+		}
+		s.xrayApi.Init(apiPort)
+		for _, inboundId := range reloadInboundIds {
+			inbound := &model.Inbound{}
+			if err1 := tx.Model(model.Inbound{}).First(inbound, inboundId).Error; err1 != nil || !inbound.Enable {
+				continue
+			}
+			if err1 := s.reloadInboundByApi(tx, inbound); err1 != nil {
+				logger.Debug("Error in reloading inbound by api:", err1)
+				needRestart = true
+			}
+		}
+		s.xrayApi.Close()
+	}
 	return needRestart, count, err
 }
 
@@ -1382,6 +1614,8 @@ func (s *InboundService) AddClientStat(tx *gorm.DB, inboundId int, client *model
 	clientTraffic.Up = 0
 	clientTraffic.Down = 0
 	clientTraffic.Reset = client.Reset
+	clientTraffic.ResetSchedule = client.ResetSchedule
+	clientTraffic.NextReset = s.getNextReset(client.ResetSchedule, time.Now())
 	result := tx.Create(&clientTraffic)
 	err := result.Error
 	return err
@@ -1398,7 +1632,10 @@ func (s *InboundService) UpdateClientStat(tx *gorm.DB, email string, client *mod
 			"reset":       client.Reset,
 		})
 	err := result.Error
-	return err
+	if err != nil {
+		return err
+	}
+	return s.updateResetSchedule(tx, client.Email, client.ResetSchedule)
 }
 
 func (s *InboundService) UpdateClientIPs(tx *gorm.DB, oldEmail string, newEmail string) error {
@@ -1489,7 +1726,7 @@ func (s *InboundService) SetClientTelegramUserID(trafficId int, tgId int64) (boo
 			switch inbound.Protocol {
 			case "trojan":
 				clientId = oldClient.Password
-			case "shadowsocks":
+			case "shadowsocks", "wireguard", "socks", "http":
 				clientId = oldClient.Email
 			default:
 				clientId = oldClient.ID
@@ -1575,7 +1812,7 @@ func (s *InboundService) ToggleClientEnableByEmail(clientEmail string) (bool, bo
 			switch inbound.Protocol {
 			case "trojan":
 				clientId = oldClient.Password
-			case "shadowsocks":
+			case "shadowsocks", "wireguard", "socks", "http":
 				clientId = oldClient.Email
 			default:
 				clientId = oldClient.ID
@@ -1640,7 +1877,7 @@ func (s *InboundService) ResetClientIpLimitByEmail(clientEmail string, count int
 			switch inbound.Protocol {
 			case "trojan":
 				clientId = oldClient.Password
-			case "shadowsocks":
+			case "shadowsocks", "wireguard", "socks", "http":
 				clientId = oldClient.Email
 			default:
 				clientId = oldClient.ID
@@ -1678,6 +1915,69 @@ func (s *InboundService) ResetClientIpLimitByEmail(clientEmail string, count int
 	return needRestart, err
 }
 
+// ResetClientDeviceLimitByEmail 中文注释: 设置客户端的设备限制，0 表示沿用入站设置。
+func (s *InboundService) ResetClientDeviceLimitByEmail(clientEmail string, count int) (bool, error) {
+	if count < 0 {
+		return false, common.NewError("invalid device limit:", count)
+	}
+	_, inbound, err := s.GetClientInboundByEmail(clientEmail)
+	if err != nil {
+		return false, err
+	}
+	if inbound == nil {
+		return false, common.NewError("Inbound Not Found For Email:", clientEmail)
+	}
+
+	oldClients, err := s.GetClients(inbound)
+	if err != nil {
+		return false, err
+	}
+
+	clientId := ""
+
+	for _, oldClient := range oldClients {
+		if oldClient.Email == clientEmail {
+			switch inbound.Protocol {
+			case "trojan":
+				clientId = oldClient.Password
+			case "shadowsocks", "wireguard", "socks", "http":
+				clientId = oldClient.Email
+			default:
+				clientId = oldClient.ID
+			}
+			break
+		}
+	}
+
+	if len(clientId) == 0 {
+		return false, common.NewError("Client Not Found For Email:", clientEmail)
+	}
+
+	var settings map[string]any
+	err = json.Unmarshal([]byte(inbound.Settings), &settings)
+	if err != nil {
+		return false, err
+	}
+	clients := settings["clients"].([]any)
+	var newClients []any
+	for client_index := range clients {
+		c := clients[client_index].(map[string]any)
+		if c["email"] == clientEmail {
+			c["deviceLimit"] = count
+			c["updated_at"] = time.Now().Unix() * 1000
+			newClients = append(newClients, any(c))
+		}
+	}
+	settings["clients"] = newClients
+	modifiedSettings, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	inbound.Settings = string(modifiedSettings)
+	needRestart, err := s.UpdateInboundClient(inbound, clientId)
+	return needRestart, err
+}
+
 func (s *InboundService) ResetClientExpiryTimeByEmail(clientEmail string, expiry_time int64) (bool, error) {
 	_, inbound, err := s.GetClientInboundByEmail(clientEmail)
 	if err != nil {
@@ -1699,7 +1999,7 @@ func (s *InboundService) ResetClientExpiryTimeByEmail(clientEmail string, expiry
 			switch inbound.Protocol {
 			case "trojan":
 				clientId = oldClient.Password
-			case "shadowsocks":
+			case "shadowsocks", "wireguard", "socks", "http":
 				clientId = oldClient.Email
 			default:
 				clientId = oldClient.ID
@@ -1761,7 +2061,7 @@ func (s *InboundService) ResetClientTrafficLimitByEmail(clientEmail string, tota
 			switch inbound.Protocol {
 			case "trojan":
 				clientId = oldClient.Password
-			case "shadowsocks":
+			case "shadowsocks", "wireguard", "socks", "http":
 				clientId = oldClient.Email
 			default:
 				clientId = oldClient.ID
@@ -1804,7 +2104,7 @@ func (s *InboundService) ResetClientTrafficByEmail(clientEmail string) error {
 
 	result := db.Model(xray.ClientTraffic{}).
 		Where("email = ?", clientEmail).
-		Updates(map[string]any{"enable": true, "up": 0, "down": 0})
+		Updates(map[string]any{"enable": true, "up": 0, "down": 0, "raw_up": 0, "raw_down": 0, "last_reset": time.Now().UnixMilli()})
 
 	err := result.Error
 	if err != nil {
@@ -1847,6 +2147,12 @@ func (s *InboundService) ResetClientTraffic(id int, clientEmail string) (bool, e
 					}
 					cipher = oldSettings["method"].(string)
 				}
+				// 中文注释: 流量已重置，不再叠加流量用尽后的限速
+				limit := ResolveScheduledSpeedLimit(inbound, &client, s.speedNow())
+				level, ok := apiSpeedLevel(client.Email, limit)
+				if !ok {
+					needRestart = true
+				}
 				err1 := s.xrayApi.AddUser(string(inbound.Protocol), inbound.Tag, map[string]any{
 					"email":    client.Email,
 					"id":       client.ID,
@@ -1854,9 +2160,11 @@ func (s *InboundService) ResetClientTraffic(id int, clientEmail string) (bool, e
 					"flow":     client.Flow,
 					"password": client.Password,
 					"cipher":   cipher,
+					"level":    level,
 				})
 				if err1 == nil {
 					logger.Debug("Client enabled due to reset traffic:", clientEmail)
+					setAppliedSpeed(client.Email, limit)
 				} else {
 					logger.Debug("Error in enabling client by api:", err1)
 					needRestart = true
@@ -1869,6 +2177,9 @@ func (s *InboundService) ResetClientTraffic(id int, clientEmail string) (bool, e
 
 	traffic.Up = 0
 	traffic.Down = 0
+	traffic.RawUp = 0
+	traffic.RawDown = 0
+	traffic.LastReset = time.Now().UnixMilli()
 	traffic.Enable = true
 
 	db := database.GetDB()
@@ -1892,7 +2203,7 @@ func (s *InboundService) ResetAllClientTraffics(id int) error {
 
 	result := db.Model(xray.ClientTraffic{}).
 		Where(whereText, id).
-		Updates(map[string]any{"enable": true, "up": 0, "down": 0})
+		Updates(map[string]any{"enable": true, "up": 0, "down": 0, "raw_up": 0, "raw_down": 0, "last_reset": time.Now().UnixMilli()})
 
 	err := result.Error
 	return err
@@ -1903,7 +2214,7 @@ func (s *InboundService) ResetAllTraffics() error {
 
 	result := db.Model(model.Inbound{}).
 		Where("user_id > ?", 0).
-		Updates(map[string]any{"up": 0, "down": 0})
+		Updates(map[string]any{"up": 0, "down": 0, "raw_up": 0, "raw_down": 0})
 
 	err := result.Error
 	return err
@@ -2192,6 +2503,18 @@ func (s *InboundService) MigrationRequirements() {
 		return
 	}
 
+	// Convert legacy wireguard peers to managed clients
+	err = s.migrateWireguardPeers(tx)
+	if err != nil {
+		return
+	}
+
+	// Convert legacy socks/http accounts to managed clients
+	err = s.migrateProxyAccounts(tx)
+	if err != nil {
+		return
+	}
+
 	// Fix inbounds based problems
 	var inbounds []*model.Inbound
 	err = tx.Model(model.Inbound{}).Where("protocol IN (?)", []string{"vmess", "vless", "trojan"}).Find(&inbounds).Error
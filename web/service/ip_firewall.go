@@ -0,0 +1,477 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"x-ui/logger"
+	"x-ui/util/common"
+)
+
+// IP 限制的执行方式
+const (
+	IpLimitBackendAuto     = "auto"
+	IpLimitBackendFail2ban = "fail2ban"
+	IpLimitBackendNftables = "nftables"
+	IpLimitBackendIpset    = "ipset"
+)
+
+const (
+	ipFirewallTable = "x-ui"
+	ipFirewallSet4  = "x-ui-ipl4"
+	ipFirewallSet6  = "x-ui-ipl6"
+)
+
+// IpFirewallEntry 中文注释: 防火墙中被封禁的 IP，Expires 为到期时间(毫秒时间戳)，0 表示永久。
+type IpFirewallEntry struct {
+	Ip      string `json:"ip"`
+	Expires int64  `json:"expires"`
+}
+
+// ipFirewallBackend 中文注释: 内置的防火墙封禁实现，由 nftables 集合或 ipset 提供。
+type ipFirewallBackend interface {
+	name() string
+	setup() error
+	add(ip string, ipv6 bool, timeout int) error
+	del(ip string, ipv6 bool) error
+	list() ([]IpFirewallEntry, error)
+	// exists 中文注释: 系统中是否存在该执行方式创建的表或集合
+	exists() bool
+	cleanup() error
+}
+
+var (
+	ipFirewallLock    sync.Mutex
+	ipFirewallCurrent ipFirewallBackend
+)
+
+// ipFirewallTools 中文注释: 系统中可用的防火墙工具，只在首次使用时检测一次，避免每次封禁都执行 fail2ban-client
+var ipFirewallTools struct {
+	once     sync.Once
+	fail2ban bool
+	nft      bool
+	ipset    bool
+}
+
+func detectFirewallTools() {
+	ipFirewallTools.once.Do(func() {
+		ipFirewallTools.fail2ban = fail2banInstalled()
+		ipFirewallTools.nft = commandAvailable("nft")
+		ipFirewallTools.ipset = commandAvailable("ipset") && commandAvailable("iptables")
+	})
+}
+
+// IpFirewallService 中文注释: 不依赖 fail2ban 的 IP 限制执行方式，直接管理 nftables 集合，
+// 系统没有 nftables 时改用 iptables + ipset。封禁带超时，到期后由内核自动移除。
+type IpFirewallService struct {
+	settingService SettingService
+}
+
+// GetBackend 中文注释: 返回当前设置实际使用的执行方式，auto 时优先 fail2ban，其次 nftables、ipset，都不可用时返回空。
+// 可用的工具在面板启动时检测并缓存，安装新工具后需重启面板。
+func (s *IpFirewallService) GetBackend() string {
+	detectFirewallTools()
+	backend, err := s.settingService.GetIpLimitBackend()
+	if err != nil || backend == "" {
+		backend = IpLimitBackendAuto
+	}
+	switch backend {
+	case IpLimitBackendFail2ban:
+		if ipFirewallTools.fail2ban {
+			return backend
+		}
+	case IpLimitBackendNftables:
+		if ipFirewallTools.nft {
+			return backend
+		}
+	case IpLimitBackendIpset:
+		if ipFirewallTools.ipset {
+			return backend
+		}
+	default:
+		if ipFirewallTools.fail2ban {
+			return IpLimitBackendFail2ban
+		}
+		if ipFirewallTools.nft {
+			return IpLimitBackendNftables
+		}
+		if ipFirewallTools.ipset {
+			return IpLimitBackendIpset
+		}
+	}
+	return ""
+}
+
+// InitBackend 中文注释: 面板启动时检测可用的防火墙工具，并删除设置切换前的内置执行方式留下的表和规则。
+// 开启退出时保留封禁后，当前执行方式中上次运行留下的封禁继续生效。
+func (s *IpFirewallService) InitBackend() {
+	name := s.GetBackend()
+	logger.Info("[LimitIP] firewall backend:", name)
+	ipFirewallLock.Lock()
+	defer ipFirewallLock.Unlock()
+	for _, backend := range builtinFirewallBackends() {
+		if backend.name() != name && backend.exists() {
+			if err := backend.cleanup(); err != nil {
+				logger.Warning("[LimitIP] clean up firewall failed:", err)
+			}
+		}
+	}
+}
+
+// ApplyBackend 中文注释: 返回当前使用的执行方式；设置切换到其他执行方式时删除旧的内置表和规则，解除其中的封禁。
+func (s *IpFirewallService) ApplyBackend() string {
+	name := s.GetBackend()
+	ipFirewallLock.Lock()
+	defer ipFirewallLock.Unlock()
+	if ipFirewallCurrent != nil && ipFirewallCurrent.name() != name {
+		if err := ipFirewallCurrent.cleanup(); err != nil {
+			logger.Warning("[LimitIP] clean up firewall failed:", err)
+		}
+		ipFirewallCurrent = nil
+	}
+	return name
+}
+
+// backend 中文注释: 返回已初始化的内置执行方式，设置切换后会先清理旧的表和规则。
+func (s *IpFirewallService) backend() (ipFirewallBackend, error) {
+	name := s.GetBackend()
+	ipFirewallLock.Lock()
+	defer ipFirewallLock.Unlock()
+	if ipFirewallCurrent != nil && ipFirewallCurrent.name() == name {
+		return ipFirewallCurrent, nil
+	}
+	if ipFirewallCurrent != nil {
+		if err := ipFirewallCurrent.cleanup(); err != nil {
+			logger.Warning("[LimitIP] clean up firewall failed:", err)
+		}
+		ipFirewallCurrent = nil
+	}
+	var backend ipFirewallBackend
+	switch name {
+	case IpLimitBackendNftables:
+		backend = &nftablesBackend{}
+	case IpLimitBackendIpset:
+		backend = &ipsetBackend{}
+	case IpLimitBackendFail2ban:
+		return nil, common.NewError("IP limit is enforced by fail2ban")
+	default:
+		return nil, common.NewError("no IP limit firewall available, install nftables or ipset")
+	}
+	if err := backend.setup(); err != nil {
+		return nil, err
+	}
+	ipFirewallCurrent = backend
+	return backend, nil
+}
+
+// BanIP 中文注释: 封禁 IP，duration 为 0 时永久封禁直到手动解封、面板退出、切换执行方式或卸载面板。
+func (s *IpFirewallService) BanIP(ip string, duration time.Duration) error {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return common.NewError("invalid IP:", ip)
+	}
+	backend, err := s.backend()
+	if err != nil {
+		return err
+	}
+	return backend.add(addr.String(), addr.To4() == nil, int(duration.Seconds()))
+}
+
+func (s *IpFirewallService) UnbanIP(ip string) error {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return common.NewError("invalid IP:", ip)
+	}
+	backend, err := s.backend()
+	if err != nil {
+		return err
+	}
+	return backend.del(addr.String(), addr.To4() == nil)
+}
+
+// GetBannedIPs 中文注释: 返回防火墙中仍在封禁的 IP，按 IP 排序。
+func (s *IpFirewallService) GetBannedIPs() ([]IpFirewallEntry, error) {
+	backend, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := backend.list()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Ip < entries[j].Ip
+	})
+	return entries, nil
+}
+
+// Cleanup 中文注释: 删除内置执行方式创建的 nftables 表或 ipset 集合及 iptables 规则并解除所有封禁，
+// 在面板退出(未开启保留封禁时)和卸载面板(x-ui firewall-cleanup)时调用。
+func (s *IpFirewallService) Cleanup() error {
+	detectFirewallTools()
+	ipFirewallLock.Lock()
+	defer ipFirewallLock.Unlock()
+	ipFirewallCurrent = nil
+	var errs []error
+	for _, backend := range builtinFirewallBackends() {
+		if backend.exists() {
+			errs = append(errs, backend.cleanup())
+		}
+	}
+	return common.Combine(errs...)
+}
+
+// builtinFirewallBackends 中文注释: 系统中可用的内置执行方式
+func builtinFirewallBackends() []ipFirewallBackend {
+	var backends []ipFirewallBackend
+	if ipFirewallTools.nft {
+		backends = append(backends, &nftablesBackend{})
+	}
+	if ipFirewallTools.ipset {
+		backends = append(backends, &ipsetBackend{})
+	}
+	return backends
+}
+
+func fail2banInstalled() bool {
+	return exec.Command("fail2ban-client", "-h").Run() == nil
+}
+
+func commandAvailable(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+func runFirewallCommand(name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, common.NewErrorf("%s %s: %v %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func expiresAt(timeout int) int64 {
+	if timeout <= 0 {
+		return 0
+	}
+	return time.Now().Add(time.Duration(timeout) * time.Second).UnixMilli()
+}
+
+// nftablesBackend 中文注释: 在独立的 inet x-ui 表中维护带超时的 IPv4/IPv6 集合，并丢弃集合中地址的所有入站连接。
+type nftablesBackend struct{}
+
+func (b *nftablesBackend) name() string {
+	return IpLimitBackendNftables
+}
+
+func (b *nftablesBackend) setup() error {
+	script := fmt.Sprintf(`add table inet %[1]s
+add set inet %[1]s %[2]s { type ipv4_addr; flags timeout; }
+add set inet %[1]s %[3]s { type ipv6_addr; flags timeout; }
+add chain inet %[1]s input { type filter hook input priority -10; policy accept; }
+flush chain inet %[1]s input
+add rule inet %[1]s input ip saddr @%[2]s drop
+add rule inet %[1]s input ip6 saddr @%[3]s drop
+`, ipFirewallTable, ipFirewallSet4, ipFirewallSet6)
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return common.NewErrorf("nft setup: %v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (b *nftablesBackend) set(ipv6 bool) string {
+	if ipv6 {
+		return ipFirewallSet6
+	}
+	return ipFirewallSet4
+}
+
+func (b *nftablesBackend) add(ip string, ipv6 bool, timeout int) error {
+	element := ip
+	if timeout > 0 {
+		element += " timeout " + strconv.Itoa(timeout) + "s"
+	}
+	// 中文注释: 已封禁的地址先删除再添加，以便刷新超时
+	b.del(ip, ipv6)
+	_, err := runFirewallCommand("nft", "add", "element", "inet", ipFirewallTable, b.set(ipv6), "{ "+element+" }")
+	return err
+}
+
+func (b *nftablesBackend) del(ip string, ipv6 bool) error {
+	_, err := runFirewallCommand("nft", "delete", "element", "inet", ipFirewallTable, b.set(ipv6), "{ "+ip+" }")
+	return err
+}
+
+func (b *nftablesBackend) list() ([]IpFirewallEntry, error) {
+	entries := make([]IpFirewallEntry, 0)
+	for _, set := range []string{ipFirewallSet4, ipFirewallSet6} {
+		out, err := runFirewallCommand("nft", "-j", "list", "set", "inet", ipFirewallTable, set)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Nftables []struct {
+				Set *struct {
+					Elem []json.RawMessage `json:"elem"`
+				} `json:"set"`
+			} `json:"nftables"`
+		}
+		if err := json.Unmarshal(out, &result); err != nil {
+			return nil, err
+		}
+		for _, item := range result.Nftables {
+			if item.Set == nil {
+				continue
+			}
+			for _, raw := range item.Set.Elem {
+				// 中文注释: 带超时的元素为 {"elem": {"val": ..., "expires": ...}}，否则直接是地址字符串
+				var ip string
+				if json.Unmarshal(raw, &ip) == nil {
+					entries = append(entries, IpFirewallEntry{Ip: ip})
+					continue
+				}
+				var elem struct {
+					Elem struct {
+						Val     string `json:"val"`
+						Expires int    `json:"expires"`
+					} `json:"elem"`
+				}
+				if err := json.Unmarshal(raw, &elem); err == nil && elem.Elem.Val != "" {
+					entries = append(entries, IpFirewallEntry{Ip: elem.Elem.Val, Expires: expiresAt(elem.Elem.Expires)})
+				}
+			}
+		}
+	}
+	return entries, nil
+}
+
+func (b *nftablesBackend) exists() bool {
+	_, err := runFirewallCommand("nft", "list", "table", "inet", ipFirewallTable)
+	return err == nil
+}
+
+func (b *nftablesBackend) cleanup() error {
+	_, err := runFirewallCommand("nft", "delete", "table", "inet", ipFirewallTable)
+	return err
+}
+
+// ipsetBackend 中文注释: 使用带超时的 ipset 集合，并在 iptables/ip6tables 的 INPUT 链首部插入丢弃规则。
+type ipsetBackend struct{}
+
+func (b *ipsetBackend) name() string {
+	return IpLimitBackendIpset
+}
+
+func (b *ipsetBackend) rule(set string) []string {
+	return []string{"INPUT", "-m", "set", "--match-set", set, "src", "-j", "DROP"}
+}
+
+func (b *ipsetBackend) tables(ipv6 bool) (string, string) {
+	if ipv6 {
+		return "ip6tables", ipFirewallSet6
+	}
+	return "iptables", ipFirewallSet4
+}
+
+func (b *ipsetBackend) setup() error {
+	if _, err := runFirewallCommand("ipset", "create", ipFirewallSet4, "hash:ip", "family", "inet", "timeout", "0", "-exist"); err != nil {
+		return err
+	}
+	if _, err := runFirewallCommand("ipset", "create", ipFirewallSet6, "hash:ip", "family", "inet6", "timeout", "0", "-exist"); err != nil {
+		return err
+	}
+	for _, ipv6 := range []bool{false, true} {
+		iptables, set := b.tables(ipv6)
+		if !commandAvailable(iptables) {
+			continue
+		}
+		if _, err := runFirewallCommand(iptables, append([]string{"-C"}, b.rule(set)...)...); err == nil {
+			continue
+		}
+		if _, err := runFirewallCommand(iptables, append([]string{"-I"}, b.rule(set)...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *ipsetBackend) add(ip string, ipv6 bool, timeout int) error {
+	_, set := b.tables(ipv6)
+	_, err := runFirewallCommand("ipset", "add", set, ip, "timeout", strconv.Itoa(max(timeout, 0)), "-exist")
+	return err
+}
+
+func (b *ipsetBackend) del(ip string, ipv6 bool) error {
+	_, set := b.tables(ipv6)
+	_, err := runFirewallCommand("ipset", "del", set, ip, "-exist")
+	return err
+}
+
+func (b *ipsetBackend) list() ([]IpFirewallEntry, error) {
+	entries := make([]IpFirewallEntry, 0)
+	for _, set := range []string{ipFirewallSet4, ipFirewallSet6} {
+		out, err := runFirewallCommand("ipset", "save", set)
+		if err != nil {
+			return nil, err
+		}
+		// 中文注释: 每个元素一行，格式为 add <set> <ip> timeout <剩余秒数>
+		scanner := bufio.NewScanner(bytes.NewReader(out))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 3 || fields[0] != "add" {
+				continue
+			}
+			entry := IpFirewallEntry{Ip: fields[2]}
+			for i := 3; i+1 < len(fields); i++ {
+				if fields[i] == "timeout" {
+					timeout, _ := strconv.Atoi(fields[i+1])
+					entry.Expires = expiresAt(timeout)
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (b *ipsetBackend) exists() bool {
+	for _, set := range []string{ipFirewallSet4, ipFirewallSet6} {
+		if _, err := runFirewallCommand("ipset", "list", "-n", set); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *ipsetBackend) cleanup() error {
+	var errs []error
+	for _, ipv6 := range []bool{false, true} {
+		iptables, set := b.tables(ipv6)
+		if commandAvailable(iptables) {
+			// 中文注释: 规则可能被重复插入，删除直到不存在
+			for {
+				if _, err := runFirewallCommand(iptables, append([]string{"-D"}, b.rule(set)...)...); err != nil {
+					break
+				}
+			}
+		}
+		if _, err := runFirewallCommand("ipset", "destroy", set); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return common.Combine(errs...)
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/random"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+// 中文注释: SOCKS/HTTP 入站的账号在面板中同样以 clients 保存，email 即 Xray 中的用户名，
+// 从而复用流量统计、到期和启用开关等客户端逻辑；生成 Xray 配置时再转换为 accounts。
+
+// isInboundReloadProtocol 中文注释: 这些协议的客户端在 Xray 中不是普通用户(WireGuard 为 peers，SOCKS/HTTP 为 accounts)，
+// 账号变化由 reloadInboundByApi 按入站统一应用，而不是逐个调用 AddUser/RemoveUser。
+func isInboundReloadProtocol(protocol model.Protocol) bool {
+	switch protocol {
+	case model.WireGuard, model.Socks, model.HTTP:
+		return true
+	}
+	return false
+}
+
+// reloadInboundByApi 中文注释: 通过 handler API 删除并重新添加整个入站来应用账号变化，无需重启 Xray，
+// 但会断开该入站上所有账号的现有连接。Xray 的 WireGuard、SOCKS 和 HTTP 入站都不支持按用户增删账号。
+// 流量耗尽或到期(统计记录被禁用)以及因设备数超限被封禁的客户端不会写入配置。调用方需已初始化 s.xrayApi。
+func (s *InboundService) reloadInboundByApi(tx *gorm.DB, inbound *model.Inbound) error {
+	var disabledEmails []string
+	err := tx.Model(xray.ClientTraffic{}).
+		Where("inbound_id = ? AND enable = ?", inbound.Id, false).
+		Pluck("email", &disabledEmails).Error
+	if err != nil {
+		return err
+	}
+	var bannedEmails []string
+	err = tx.Model(model.DeviceBan{}).Where("inbound_id = ?", inbound.Id).Pluck("email", &bannedEmails).Error
+	if err != nil {
+		return err
+	}
+	disabledEmails = append(disabledEmails, bannedEmails...)
+
+	reloaded := *inbound
+	if len(disabledEmails) > 0 {
+		disabled := make(map[string]bool, len(disabledEmails))
+		for _, email := range disabledEmails {
+			disabled[email] = true
+		}
+		var settings map[string]any
+		if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+			return err
+		}
+		if clients, ok := settings["clients"].([]any); ok {
+			for _, clientRaw := range clients {
+				if c, ok := clientRaw.(map[string]any); ok {
+					if email, _ := c["email"].(string); disabled[email] {
+						c["enable"] = false
+					}
+				}
+			}
+		}
+		newSettings, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		reloaded.Settings = string(newSettings)
+	}
+
+	inboundJson, err := json.MarshalIndent(reloaded.GenXrayInboundConfig(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err1 := s.xrayApi.DelInbound(inbound.Tag); err1 != nil {
+		logger.Debug("Unable to delete inbound by api before reload:", err1)
+	}
+	err = s.xrayApi.AddInbound(inboundJson)
+	if err == nil {
+		logger.Debug("Inbound reloaded by api:", inbound.Tag)
+	}
+	return err
+}
+
+// migrateProxyAccounts 中文注释: 将旧版 SOCKS/HTTP 入站的 settings.accounts 转换为面板管理的 clients，并补齐流量统计记录。
+// 用户名直接作为 email，以保持现有账号可用；与其他客户端或同一入站中的其他账号重名时 email 必须唯一，
+// 因此重命名为 "用户名-入站tag"(仍重名时追加序号)，该账号之后需使用新的用户名登录，并记录警告。
+func (s *InboundService) migrateProxyAccounts(tx *gorm.DB) error {
+	var inbounds []*model.Inbound
+	err := tx.Model(model.Inbound{}).Where("protocol IN (?)", []model.Protocol{model.Socks, model.HTTP}).Find(&inbounds).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+	used, err := s.migrationUsedEmails(tx)
+	if err != nil {
+		return err
+	}
+	for _, inbound := range inbounds {
+		settings := map[string]any{}
+		if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+			continue
+		}
+		if _, ok := settings["clients"]; ok {
+			continue
+		}
+		if auth, _ := settings["auth"].(string); inbound.Protocol == model.Socks && auth != "password" {
+			continue
+		}
+		accounts, _ := settings["accounts"].([]any)
+		now := time.Now().UnixMilli()
+		clients := make([]any, 0, len(accounts))
+		for _, accountRaw := range accounts {
+			account, ok := accountRaw.(map[string]any)
+			if !ok {
+				continue
+			}
+			user, _ := account["user"].(string)
+			if user == "" {
+				continue
+			}
+			pass, _ := account["pass"].(string)
+			email := uniqueMigrationEmail(used, user, fmt.Sprintf("%s-%s", user, inbound.Tag))
+			if email != user {
+				logger.Warningf("Proxy account %s of inbound %s renamed to %s: name already used by another client", user, inbound.Tag, email)
+			}
+			clients = append(clients, map[string]any{
+				"email":      email,
+				"password":   pass,
+				"enable":     true,
+				"subId":      random.Seq(16),
+				"created_at": now,
+				"updated_at": now,
+			})
+		}
+		delete(settings, "accounts")
+		settings["clients"] = clients
+		newSettings, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return err
+		}
+		inbound.Settings = string(newSettings)
+		if err := tx.Model(model.Inbound{}).Where("id = ?", inbound.Id).Update("settings", inbound.Settings).Error; err != nil {
+			return err
+		}
+
+		modelClients, err := s.GetClients(inbound)
+		if err != nil {
+			return err
+		}
+		for _, modelClient := range modelClients {
+			var count int64
+			tx.Model(xray.ClientTraffic{}).Where("email = ?", modelClient.Email).Count(&count)
+			if count == 0 {
+				s.AddClientStat(tx, inbound.Id, &modelClient)
+			}
+		}
+	}
+	return nil
+}
+
+// migrationUsedEmails 中文注释: 迁移旧版入站时已被占用的 email，包括流量统计记录和各入站 clients 中的 email
+func (s *InboundService) migrationUsedEmails(tx *gorm.DB) (map[string]bool, error) {
+	var emails []string
+	if err := tx.Model(xray.ClientTraffic{}).Pluck("email", &emails).Error; err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		used[email] = true
+	}
+	var inbounds []*model.Inbound
+	if err := tx.Model(model.Inbound{}).Find(&inbounds).Error; err != nil {
+		return nil, err
+	}
+	for _, inbound := range inbounds {
+		clients, _ := s.GetClients(inbound)
+		for _, client := range clients {
+			if client.Email != "" {
+				used[client.Email] = true
+			}
+		}
+	}
+	return used, nil
+}
+
+// uniqueMigrationEmail 中文注释: email 未被占用时直接使用，否则改用 fallback，仍重名时在 fallback 后追加序号，
+// 返回的 email 会记为已占用。
+func uniqueMigrationEmail(used map[string]bool, email string, fallback string) string {
+	for i := 1; used[email]; i++ {
+		email = fallback
+		if i > 1 {
+			email = fmt.Sprintf("%s-%d", fallback, i)
+		}
+	}
+	used[email] = true
+	return email
+}
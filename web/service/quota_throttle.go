@@ -0,0 +1,111 @@
+package service
+
+import (
+	"time"
+
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+// 流量用尽后的处理方式
+const (
+	QuotaActionDisable             = "disable"
+	QuotaActionThrottle            = "throttle"
+	QuotaActionThrottleThenDisable = "throttleThenDisable"
+)
+
+// checkClientQuotaActions 中文注释: 保存客户端前检查流量用尽后的处理方式，限速方式必须设置限速值。
+func (s *InboundService) checkClientQuotaActions(clients []model.Client) error {
+	for _, client := range clients {
+		switch client.QuotaAction {
+		case "", QuotaActionDisable:
+			continue
+		case QuotaActionThrottle, QuotaActionThrottleThenDisable:
+		default:
+			return common.NewErrorf("client %s: invalid quota action: %s", client.Email, client.QuotaAction)
+		}
+		if client.ThrottleSpeed <= 0 {
+			return common.NewErrorf("client %s: throttle speed is required for quota action %s", client.Email, client.QuotaAction)
+		}
+		if client.ThrottleAllowance < 0 {
+			return common.NewErrorf("client %s: invalid throttle allowance: %d", client.Email, client.ThrottleAllowance)
+		}
+	}
+	return nil
+}
+
+// throttlesAfterQuota 中文注释: 客户端流量用尽后是否先限速而不是立即禁用
+func throttlesAfterQuota(client *model.Client) bool {
+	return client.QuotaAction == QuotaActionThrottle || client.QuotaAction == QuotaActionThrottleThenDisable
+}
+
+// QuotaThrottled 中文注释: 客户端已用尽流量但处于限速阶段(仍保持启用)。
+// throttleThenDisable 在额外流量用完后不再算作限速，由 disableInvalidClients 禁用。
+func QuotaThrottled(client *model.Client, traffic *xray.ClientTraffic) bool {
+	if traffic == nil || !throttlesAfterQuota(client) || traffic.Total <= 0 || traffic.Up+traffic.Down < traffic.Total {
+		return false
+	}
+	if client.QuotaAction == QuotaActionThrottleThenDisable {
+		return traffic.Up+traffic.Down < traffic.Total+client.ThrottleAllowance
+	}
+	return true
+}
+
+// throttleSpeed 中文注释: 在原有限速基础上叠加流量用尽后的限速，每个方向取较小的限速(0 为不限速)。
+func throttleSpeed(limit SpeedLimit, speed int) SpeedLimit {
+	lower := func(current int) int {
+		if current > 0 && current < speed {
+			return current
+		}
+		return speed
+	}
+	return SpeedLimit{Up: lower(limit.Up), Down: lower(limit.Down)}
+}
+
+// ResolveClientSpeedLimit 中文注释: 计算 now 时客户端实际生效的限速，在限速时段的基础上叠加流量用尽后的限速。
+// 流量统计取自 inbound.ClientStats，未加载时不考虑流量用尽限速。
+func ResolveClientSpeedLimit(inbound *model.Inbound, client *model.Client, now time.Time) SpeedLimit {
+	limit := ResolveScheduledSpeedLimit(inbound, client, now)
+	if inbound != nil && throttlesAfterQuota(client) {
+		for i := range inbound.ClientStats {
+			if inbound.ClientStats[i].Email == client.Email {
+				if QuotaThrottled(client, &inbound.ClientStats[i]) {
+					limit = throttleSpeed(limit, client.ThrottleSpeed)
+				}
+				break
+			}
+		}
+	}
+	return limit
+}
+
+// getQuotaThrottledEmails 中文注释: 返回流量已用尽但处于限速阶段的客户端，disableInvalidClients 不禁用这些客户端。
+func (s *InboundService) getQuotaThrottledEmails(tx *gorm.DB) ([]string, error) {
+	var inbounds []*model.Inbound
+	err := tx.Model(model.Inbound{}).Preload("ClientStats").Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+	var emails []string
+	for _, inbound := range inbounds {
+		clients, err := s.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		for i := range clients {
+			if !throttlesAfterQuota(&clients[i]) {
+				continue
+			}
+			for j := range inbound.ClientStats {
+				if inbound.ClientStats[j].Email == clients[i].Email && QuotaThrottled(&clients[i], &inbound.ClientStats[j]) {
+					emails = append(emails, clients[i].Email)
+					break
+				}
+			}
+		}
+	}
+	return emails, nil
+}
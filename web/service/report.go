@@ -0,0 +1,210 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"x-ui/util/common"
+	"x-ui/util/xlsx"
+)
+
+const (
+	ReportFormatCSV  = "csv"
+	ReportFormatXLSX = "xlsx"
+
+	ReportPeriodDaily   = "daily"
+	ReportPeriodWeekly  = "weekly"
+	ReportPeriodMonthly = "monthly"
+)
+
+// UsageReportRow 中文注释: 用量报表中的一行。Up/Down/Total 为统计周期内的用量，
+// Quota 为客户端流量限额(0 表示不限)，流量单位均为字节。
+type UsageReportRow struct {
+	Email      string `json:"email"`
+	Inbound    string `json:"inbound"`
+	Comment    string `json:"comment"`
+	TgId       int64  `json:"tgId"`
+	Up         int64  `json:"up"`
+	Down       int64  `json:"down"`
+	Total      int64  `json:"total"`
+	Quota      int64  `json:"quota"`
+	ExpiryTime int64  `json:"expiryTime"`
+	LastOnline int64  `json:"lastOnline"`
+}
+
+// ReportService 中文注释: 基于按天流量历史生成客户端用量报表，并导出为 CSV 或 XLSX。
+type ReportService struct {
+	inboundService        InboundService
+	settingService        SettingService
+	trafficHistoryService TrafficHistoryService
+}
+
+// GetUsageReport 中文注释: 返回 [from, to) 时间段内每个客户端的用量，没有用量的客户端也会列出。
+// 周期用量来自流量历史(按天数据及尚未汇总的按小时数据)，精度为天(面板时区)。
+func (s *ReportService) GetUsageReport(from int64, to int64) ([]*UsageReportRow, error) {
+	if to <= 0 {
+		to = time.Now().UnixMilli()
+	}
+	if from >= to {
+		return nil, common.NewError("invalid report range")
+	}
+
+	usageByEmail, err := s.trafficHistoryService.GetUsage(TrafficKindClient, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	var rows []*UsageReportRow
+	for _, inbound := range inbounds {
+		clients, err := s.inboundService.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		stats := make(map[string]int, len(inbound.ClientStats))
+		for i, stat := range inbound.ClientStats {
+			stats[stat.Email] = i
+		}
+		for _, client := range clients {
+			u := usageByEmail[client.Email]
+			if u == nil {
+				u = &TrafficPoint{}
+			}
+			row := &UsageReportRow{
+				Email:      client.Email,
+				Inbound:    inbound.Remark,
+				Comment:    client.Comment,
+				TgId:       client.TgID,
+				Up:         u.Up,
+				Down:       u.Down,
+				Total:      u.Up + u.Down,
+				Quota:      client.TotalGB,
+				ExpiryTime: client.ExpiryTime,
+			}
+			if row.Inbound == "" {
+				row.Inbound = inbound.Tag
+			}
+			if i, ok := stats[client.Email]; ok {
+				stat := inbound.ClientStats[i]
+				row.Quota = stat.Total
+				row.ExpiryTime = stat.ExpiryTime
+				row.LastOnline = stat.LastOnline
+			}
+			rows = append(rows, row)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Total > rows[j].Total
+	})
+	return rows, nil
+}
+
+// ExportUsageReport 中文注释: 生成指定格式的用量报表文件，返回文件名和内容。
+func (s *ReportService) ExportUsageReport(format string, from int64, to int64) (string, []byte, error) {
+	if format != ReportFormatCSV && format != ReportFormatXLSX {
+		return "", nil, common.NewError("invalid report format:", format)
+	}
+	if to <= 0 {
+		to = time.Now().UnixMilli()
+	}
+	rows, err := s.GetUsageReport(from, to)
+	if err != nil {
+		return "", nil, err
+	}
+	loc, err := s.settingService.GetTimeLocation()
+	if err != nil {
+		loc = time.Local
+	}
+	formatTime := func(ms int64) string {
+		if ms <= 0 {
+			return ""
+		}
+		return time.UnixMilli(ms).In(loc).Format("2006-01-02 15:04:05")
+	}
+
+	table := [][]any{{"Email", "Inbound", "Comment", "Telegram ID", "Up (bytes)", "Down (bytes)", "Total (bytes)", "Quota (bytes)", "Expiry", "Last Online"}}
+	for _, row := range rows {
+		tgId := ""
+		if row.TgId != 0 {
+			tgId = strconv.FormatInt(row.TgId, 10)
+		}
+		table = append(table, []any{
+			row.Email, row.Inbound, row.Comment, tgId,
+			row.Up, row.Down, row.Total, row.Quota,
+			formatTime(row.ExpiryTime), formatTime(row.LastOnline),
+		})
+	}
+
+	// 中文注释: 结束时间为开区间，文件名中使用最后一天的日期
+	name := fmt.Sprintf("usage-%s-%s.%s",
+		time.UnixMilli(from).In(loc).Format("20060102"),
+		time.UnixMilli(to-1).In(loc).Format("20060102"),
+		format)
+	var buf bytes.Buffer
+	if format == ReportFormatXLSX {
+		err = xlsx.Write(&buf, "Usage", table)
+	} else {
+		w := csv.NewWriter(&buf)
+		for _, line := range table {
+			record := make([]string, len(line))
+			for i, value := range line {
+				record[i] = fmt.Sprint(value)
+				// 中文注释: 避免表格软件把以这些字符开头的文本当作公式执行
+				if _, ok := value.(string); ok && record[i] != "" && strings.ContainsRune("=+-@", rune(record[i][0])) {
+					record[i] = "'" + record[i]
+				}
+			}
+			w.Write(record)
+		}
+		w.Flush()
+		err = w.Error()
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return name, buf.Bytes(), nil
+}
+
+// GetCurrentMonth 中文注释: 返回本月(面板时区)开始到当前的时间范围，作为报表的默认周期。
+func (s *ReportService) GetCurrentMonth() (int64, int64) {
+	loc, err := s.settingService.GetTimeLocation()
+	if err != nil {
+		loc = time.Local
+	}
+	now := time.Now().In(loc)
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	return start.UnixMilli(), now.UnixMilli()
+}
+
+// GetLastPeriod 中文注释: 返回上一个完整的日、周(周一开始)或月的时间范围，用于定时报表。
+func (s *ReportService) GetLastPeriod(period string) (int64, int64, error) {
+	loc, err := s.settingService.GetTimeLocation()
+	if err != nil {
+		loc = time.Local
+	}
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	var from, to time.Time
+	switch period {
+	case ReportPeriodDaily:
+		to = today
+		from = to.AddDate(0, 0, -1)
+	case ReportPeriodWeekly:
+		to = today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+		from = to.AddDate(0, 0, -7)
+	case ReportPeriodMonthly:
+		to = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+		from = to.AddDate(0, -1, 0)
+	default:
+		return 0, 0, common.NewError("invalid report period:", period)
+	}
+	return from.UnixMilli(), to.UnixMilli(), nil
+}
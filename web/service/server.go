@@ -61,9 +61,10 @@ type Status struct {
 		Total   uint64 `json:"total"`
 	} `json:"disk"`
 	Xray struct {
-		State    ProcessState `json:"state"`
-		ErrorMsg string       `json:"errorMsg"`
-		Version  string       `json:"version"`
+		State     ProcessState    `json:"state"`
+		ErrorMsg  string          `json:"errorMsg"`
+		Version   string          `json:"version"`
+		LastApply XrayApplyResult `json:"lastApply"`
 	} `json:"xray"`
 	Uptime   uint64    `json:"uptime"`
 	Loads    []float64 `json:"loads"`
@@ -292,6 +293,7 @@ func (s *ServerService) GetStatus(lastStatus *Status) *Status {
 		status.Xray.ErrorMsg = s.xrayService.GetXrayResult()
 	}
 	status.Xray.Version = s.xrayService.GetXrayVersion()
+	status.Xray.LastApply = s.xrayService.GetLastApplyResult()
 
 	// Application stats
 	var rtm runtime.MemStats
@@ -564,7 +566,8 @@ func hasSuffix(line string, suffixes []string) bool {
 }
 
 func (s *ServerService) GetConfigJson() (any, error) {
-	config, err := s.xrayService.GetXrayConfig()
+	// 中文注释: 只查看配置，不记录其中的限速 level
+	config, _, err := s.xrayService.GetXrayConfig()
 	if err != nil {
 		return nil, err
 	}
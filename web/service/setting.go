@@ -36,6 +36,15 @@ var defaultValueMap = map[string]string{
 	"pageSize":                    "50",
 	"expireDiff":                  "0",
 	"trafficDiff":                 "0",
+	"trafficHourlyDays":           "7",
+	"trafficDailyDays":            "365",
+	"deviceIpv4Prefix":            "32",
+	"deviceIpv6Prefix":            "64",
+	"deviceMinSightings":          "1",
+	"ipLimitBackend":              "auto",
+	"ipLimitBanTime":              "30",
+	"ipLimitKeepBans":             "false",
+	"speedLevelPresets":           "256,512,1024,2048,5120,10240,20480,51200,102400",
 	"remarkModel":                 "-ieo",
 	"timeLocation":                "Local",
 	"tgBotEnable":                 "false",
@@ -48,6 +57,11 @@ var defaultValueMap = map[string]string{
 	"tgBotLoginNotify":            "true",
 	"tgCpu":                       "80",
 	"tgLang":                      "zh-CN",
+	"tgReportPeriod":              "",
+	"tgReportFormat":              "xlsx",
+	"usageAlertTraffic":           "",
+	"usageAlertExpiry":            "",
+	"usageAlertAdmins":            "false",
 	"twoFactorEnable":             "false",
 	"twoFactorToken":              "",
 	"subEnable":                   "false",
@@ -57,6 +71,7 @@ var defaultValueMap = map[string]string{
 	"subUpdates":                  "12",
 	"subEncrypt":                  "true",
 	"subShowInfo":                 "true",
+	"subPlaceholder":              "false",
 	"subURI":                      "",
 	"subJsonPath":                 "/json/",
 	"subJsonURI":                  "",
@@ -64,7 +79,6 @@ var defaultValueMap = map[string]string{
 	"subJsonNoises":               "",
 	"subJsonMux":                  "",
 	"subJsonRules":                "",
-	"subTotalId":                  "",
 	"datepicker":                  "gregorian",
 	"warp":                        "",
 	"externalTrafficInformEnable": "false",
@@ -315,6 +329,26 @@ func (s *SettingService) GetTgLang() (string, error) {
 	return s.getString("tgLang")
 }
 
+func (s *SettingService) GetTgReportPeriod() (string, error) {
+	return s.getString("tgReportPeriod")
+}
+
+func (s *SettingService) GetTgReportFormat() (string, error) {
+	return s.getString("tgReportFormat")
+}
+
+func (s *SettingService) GetUsageAlertTraffic() (string, error) {
+	return s.getString("usageAlertTraffic")
+}
+
+func (s *SettingService) GetUsageAlertExpiry() (string, error) {
+	return s.getString("usageAlertExpiry")
+}
+
+func (s *SettingService) GetUsageAlertAdmins() (bool, error) {
+	return s.getBool("usageAlertAdmins")
+}
+
 func (s *SettingService) GetTwoFactorEnable() (bool, error) {
 	return s.getBool("twoFactorEnable")
 }
@@ -455,6 +489,53 @@ func (s *SettingService) GetSubShowInfo() (bool, error) {
 	return s.getBool("subShowInfo")
 }
 
+func (s *SettingService) GetSubPlaceholder() (bool, error) {
+	return s.getBool("subPlaceholder")
+}
+
+func (s *SettingService) GetTrafficHourlyDays() (int, error) {
+	return s.getInt("trafficHourlyDays")
+}
+
+func (s *SettingService) GetTrafficDailyDays() (int, error) {
+	return s.getInt("trafficDailyDays")
+}
+
+func (s *SettingService) GetDeviceIpv4Prefix() (int, error) {
+	return s.getInt("deviceIpv4Prefix")
+}
+
+func (s *SettingService) GetDeviceIpv6Prefix() (int, error) {
+	return s.getInt("deviceIpv6Prefix")
+}
+
+func (s *SettingService) GetDeviceMinSightings() (int, error) {
+	return s.getInt("deviceMinSightings")
+}
+
+func (s *SettingService) GetIpLimitBackend() (string, error) {
+	return s.getString("ipLimitBackend")
+}
+
+// GetIpLimitBanTime 中文注释: 内置防火墙封禁超出 IP 限制的地址的时长(分钟)
+func (s *SettingService) GetIpLimitBanTime() (int, error) {
+	return s.getInt("ipLimitBanTime")
+}
+
+// GetIpLimitKeepBans 中文注释: 面板退出时是否保留内置防火墙中的封禁，默认退出时解除
+func (s *SettingService) GetIpLimitKeepBans() (bool, error) {
+	return s.getBool("ipLimitKeepBans")
+}
+
+// GetSpeedLevelPresets 中文注释: 预先建立 policy level 的限速档位(KB/s)，升序返回
+func (s *SettingService) GetSpeedLevelPresets() ([]int, error) {
+	text, err := s.getString("speedLevelPresets")
+	if err != nil {
+		return nil, err
+	}
+	return common.ParseIntList(text)
+}
+
 func (s *SettingService) GetPageSize() (int, error) {
 	return s.getInt("pageSize")
 }
@@ -483,14 +564,6 @@ func (s *SettingService) GetSubJsonRules() (string, error) {
 	return s.getString("subJsonRules")
 }
 
-func (s *SettingService) GetSubTotalId() (string, error) {
-	return s.getString("subTotalId")
-}
-
-func (s *SettingService) SetSubTotalId(subTotalId string) error {
-	return s.saveSetting("subTotalId", subTotalId)
-}
-
 func (s *SettingService) GetDatepicker() (string, error) {
 	return s.getString("datepicker")
 }
@@ -524,7 +597,12 @@ func (s *SettingService) GetIpLimitEnable() (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	return (accessLogPath != "none" && accessLogPath != ""), nil
+	if accessLogPath != "none" && accessLogPath != "" {
+		return true, nil
+	}
+	// 中文注释: 未开启访问日志时，Xray 支持在线IP统计也可以使用 IP 限制
+	xrayService := XrayService{}
+	return xrayService.IsOnlineIpsSupported(), nil
 }
 
 func (s *SettingService) UpdateAllSetting(allSetting *entity.AllSetting) error {
@@ -570,7 +648,6 @@ func (s *SettingService) GetDefaultSettings(host string) (any, error) {
 		"subTitle":      func() (any, error) { return s.GetSubTitle() },
 		"subURI":        func() (any, error) { return s.GetSubURI() },
 		"subJsonURI":    func() (any, error) { return s.GetSubJsonURI() },
-		"subTotalId":    func() (any, error) { return s.GetSubTotalId() },
 		"remarkModel":   func() (any, error) { return s.GetRemarkModel() },
 		"datepicker":    func() (any, error) { return s.GetDatepicker() },
 		"ipLimitEnable": func() (any, error) { return s.GetIpLimitEnable() },
@@ -0,0 +1,484 @@
+package service
+
+import (
+	"encoding/json"
+	"maps"
+	"sort"
+	"strconv"
+	"sync"
+
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+// SpeedLimit 中文注释: 上行和下行限速，单位 KB/s，0 表示该方向不限速。
+type SpeedLimit struct {
+	Up   int `json:"up"`
+	Down int `json:"down"`
+}
+
+// IsZero 中文注释: 两个方向都不限速
+func (l SpeedLimit) IsZero() bool {
+	return l.Up == 0 && l.Down == 0
+}
+
+var (
+	// speedLevels 中文注释: 最近一次生成 Xray 配置时的限速到 policy level 的映射，
+	// 通过 API 添加用户时用它查找 level，找不到说明需要重新生成配置。
+	speedLevels = map[SpeedLimit]int{}
+	// appliedSpeeds 中文注释: Xray 中各用户当前使用的限速，生成配置和通过 API 切换 level 时更新
+	appliedSpeeds = map[string]SpeedLimit{}
+	// speedPresets 中文注释: 生成配置时预先建立 level 的限速档位，没有精确 level 的限速按档位取近似值。
+	// 非档位的限速会在 policy 中新增 level，policy 无法热更新，因此首次生效需要完整重启 Xray。
+	speedPresets    []int
+	speedLevelsLock sync.RWMutex
+)
+
+// ResolveSpeedLimit 中文注释: 计算客户端实际生效的限速。每个方向依次取客户端的单向限速、
+// 客户端旧的 SpeedLimit(上下行相同)、入站的默认限速，取第一个大于 0 的值。
+func ResolveSpeedLimit(inbound *model.Inbound, client *model.Client) SpeedLimit {
+	pick := func(own int, inboundDefault int) int {
+		if own > 0 {
+			return own
+		}
+		if client.SpeedLimit > 0 {
+			return client.SpeedLimit
+		}
+		if inboundDefault > 0 {
+			return inboundDefault
+		}
+		return 0
+	}
+	upDefault, downDefault := 0, 0
+	if inbound != nil {
+		upDefault, downDefault = inbound.UpLimit, inbound.DownLimit
+	}
+	return SpeedLimit{
+		Up:   pick(client.UpLimit, upDefault),
+		Down: pick(client.DownLimit, downDefault),
+	}
+}
+
+// buildSpeedLevels 中文注释: 为所有出现过的限速组合分配 policy level。上下行相同的组合沿用
+// 以速率作为 level 的旧规则；上下行不同的组合按排序后依次分配在所有已占用 level 之后，
+// 保证与模板中的 level 和对称限速的 level 都不冲突，且同一组输入的分配结果固定。
+func buildSpeedLevels(limits map[SpeedLimit]bool, reserved map[string]any) map[SpeedLimit]int {
+	levels := make(map[SpeedLimit]int, len(limits))
+	maxLevel := 0
+	for key := range reserved {
+		if n, err := strconv.Atoi(key); err == nil && n > maxLevel {
+			maxLevel = n
+		}
+	}
+	var asymmetric []SpeedLimit
+	for limit := range limits {
+		if limit.IsZero() {
+			continue
+		}
+		if limit.Up == limit.Down {
+			levels[limit] = limit.Up
+			if limit.Up > maxLevel {
+				maxLevel = limit.Up
+			}
+			continue
+		}
+		asymmetric = append(asymmetric, limit)
+	}
+	sort.Slice(asymmetric, func(i, j int) bool {
+		if asymmetric[i].Up != asymmetric[j].Up {
+			return asymmetric[i].Up < asymmetric[j].Up
+		}
+		return asymmetric[i].Down < asymmetric[j].Down
+	})
+	for i, limit := range asymmetric {
+		levels[limit] = maxLevel + 1 + i
+	}
+	return levels
+}
+
+// presetSpeedLimits 中文注释: 返回档位(含不限速)在上下行上的全部组合，生成配置时为它们预先建立 level，
+// 之后任意限速变化都能找到一个现成的 level，通过 API 重新添加用户即可生效。
+func presetSpeedLimits(presets []int) []SpeedLimit {
+	values := append([]int{0}, presets...)
+	limits := make([]SpeedLimit, 0, len(values)*len(values))
+	for _, up := range values {
+		for _, down := range values {
+			if up != 0 || down != 0 {
+				limits = append(limits, SpeedLimit{Up: up, Down: down})
+			}
+		}
+	}
+	return limits
+}
+
+// snapSpeed 中文注释: 取不超过 speed 的最大档位，0(不限速)保持不变。低于最小档位或没有档位时返回 false，
+// 不能向上取整，否则流量用尽后的低速限速会按更高的档位生效。
+func snapSpeed(speed int, presets []int) (int, bool) {
+	if speed == 0 {
+		return 0, true
+	}
+	snapped, ok := 0, false
+	for _, preset := range presets {
+		if preset <= speed {
+			snapped, ok = preset, true
+		}
+	}
+	return snapped, ok
+}
+
+// SpeedLevels 中文注释: 一份 Xray 配置中限速到 policy level 的映射，以及生成配置时使用的限速档位
+type SpeedLevels struct {
+	Levels  map[SpeedLimit]int
+	Presets []int
+}
+
+// setSpeedLevels 中文注释: 记录运行中的 Xray 使用的限速 level 和限速档位。只能在配置已启动或已热更新后调用，
+// 上下行不同的限速按顺序分配 level，仅生成配置(如查看配置)就记录会让 API 添加的用户使用运行中进程里含义不同的 level。
+func setSpeedLevels(levels SpeedLevels) {
+	speedLevelsLock.Lock()
+	defer speedLevelsLock.Unlock()
+	speedLevels = levels.Levels
+	speedPresets = levels.Presets
+}
+
+// setAppliedSpeeds 中文注释: 生成配置后记录配置中各用户的限速
+func setAppliedSpeeds(speeds map[string]SpeedLimit) {
+	speedLevelsLock.Lock()
+	defer speedLevelsLock.Unlock()
+	appliedSpeeds = speeds
+}
+
+// setAppliedSpeed 中文注释: 通过 API 添加用户后记录其限速
+func setAppliedSpeed(email string, limit SpeedLimit) {
+	speedLevelsLock.Lock()
+	defer speedLevelsLock.Unlock()
+	appliedSpeeds[email] = limit
+}
+
+// getAppliedSpeed 中文注释: 返回 Xray 中该用户当前的限速，不在配置中的用户返回 false
+func getAppliedSpeed(email string) (SpeedLimit, bool) {
+	speedLevelsLock.RLock()
+	defer speedLevelsLock.RUnlock()
+	limit, ok := appliedSpeeds[email]
+	return limit, ok
+}
+
+// appliedSpeedsFromConfig 中文注释: 按配置中各用户的 level 反查其限速
+func appliedSpeedsFromConfig(config *xray.Config, levels map[SpeedLimit]int) map[string]SpeedLimit {
+	limitByLevel := make(map[int]SpeedLimit, len(levels))
+	for limit, level := range levels {
+		limitByLevel[level] = limit
+	}
+
+	speeds := make(map[string]SpeedLimit)
+	for _, inbound := range config.InboundConfigs {
+		var settings struct {
+			Clients []struct {
+				Email string `json:"email"`
+				Level int    `json:"level"`
+			} `json:"clients"`
+		}
+		if json.Unmarshal(inbound.Settings, &settings) != nil {
+			continue
+		}
+		for _, client := range settings.Clients {
+			if client.Email != "" {
+				speeds[client.Email] = limitByLevel[client.Level]
+			}
+		}
+	}
+	return speeds
+}
+
+// GetSpeedLevel 中文注释: 返回限速对应的 policy level，不限速时为 level 0。
+// 当前配置中还没有该限速组合时返回 false，可用 ResolveSpeedLevel 取近似的档位。
+func GetSpeedLevel(limit SpeedLimit) (int, bool) {
+	if limit.IsZero() {
+		return 0, true
+	}
+	speedLevelsLock.RLock()
+	defer speedLevelsLock.RUnlock()
+	level, ok := speedLevels[limit]
+	return level, ok
+}
+
+// ResolveSpeedLevel 中文注释: 返回限速对应的 level 以及该 level 实际的限速。配置中没有精确的 level 时，
+// 按限速档位取近似的 level(每个方向取不超过它的最大档位)，直到下次重启生成精确的 level。
+// 某个方向低于最小档位或没有设置档位时返回 false，调用方需重启 Xray 使用精确的 level。
+func ResolveSpeedLevel(limit SpeedLimit) (int, SpeedLimit, bool) {
+	if level, ok := GetSpeedLevel(limit); ok {
+		return level, limit, true
+	}
+	speedLevelsLock.RLock()
+	defer speedLevelsLock.RUnlock()
+	up, upOk := snapSpeed(limit.Up, speedPresets)
+	down, downOk := snapSpeed(limit.Down, speedPresets)
+	if !upOk || !downOk {
+		return 0, limit, false
+	}
+	snapped := SpeedLimit{Up: up, Down: down}
+	level, ok := speedLevels[snapped]
+	return level, snapped, ok
+}
+
+// apiSpeedLevel 中文注释: 返回通过 API 添加用户时使用的 level，使用近似档位时记录日志
+func apiSpeedLevel(email string, limit SpeedLimit) (int, bool) {
+	level, effective, ok := ResolveSpeedLevel(limit)
+	if ok && effective != limit {
+		logger.Infof("用户 %s 的限速 ↑%d ↓%d KB/s 暂无对应 level，重启 Xray 前按档位 ↑%d ↓%d KB/s 生效",
+			email, limit.Up, limit.Down, effective.Up, effective.Down)
+	}
+	return level, ok
+}
+
+// checkSpeedLimit 中文注释: 限速不能为负数
+func checkSpeedLimit(name string, up int, down int) error {
+	if up < 0 || down < 0 {
+		return common.NewErrorf("%s: invalid speed limit: up %d, down %d", name, up, down)
+	}
+	return nil
+}
+
+// checkClientSpeedLimits 中文注释: 保存客户端前检查限速设置
+func (s *InboundService) checkClientSpeedLimits(clients []model.Client) error {
+	for _, client := range clients {
+		if err := checkSpeedLimit("client "+client.Email, client.UpLimit, client.DownLimit); err != nil {
+			return err
+		}
+		if client.SpeedLimit < 0 {
+			return common.NewErrorf("client %s: invalid speed limit: %d", client.Email, client.SpeedLimit)
+		}
+	}
+	return nil
+}
+
+// GetClientSpeedLimit 中文注释: 返回客户端当前实际生效的上下行限速(已合并入站的默认限速和限速时段)
+func (s *InboundService) GetClientSpeedLimit(email string) (SpeedLimit, error) {
+	_, inbound, err := s.GetClientInboundByEmail(email)
+	if err != nil {
+		return SpeedLimit{}, err
+	}
+	if inbound == nil {
+		return SpeedLimit{}, common.NewError("Inbound Not Found For Email:", email)
+	}
+	clients, err := s.GetClients(inbound)
+	if err != nil {
+		return SpeedLimit{}, err
+	}
+	for i := range clients {
+		if clients[i].Email == email {
+			return s.CurrentSpeedLimit(inbound, &clients[i]), nil
+		}
+	}
+	return SpeedLimit{}, common.NewError("Client Not Found In Inbound For Email:", email)
+}
+
+// SyncClientSpeeds 中文注释: 把限速变化(如进入或离开限速时段、流量用尽后限速或重置后恢复)通过 API 应用到 Xray：先删除用户再以新的 level 添加，
+// 不需要重启。只处理已在 Xray 中的启用用户；新的限速没有精确 level 时使用近似档位，没有设置档位时才标记重启。返回切换的用户数。
+func (s *InboundService) SyncClientSpeeds() (int, error) {
+	xrayService := XrayService{}
+	if !xrayService.IsXrayRunning() {
+		return 0, nil
+	}
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		return 0, err
+	}
+	bannedEmails, err := (&DeviceLimitService{}).GetBannedEmails()
+	if err != nil {
+		return 0, err
+	}
+	now := s.speedNow()
+
+	// 中文注释: 只在有用户需要切换时才连接 Xray API
+	var api *xray.XrayAPI
+	defer func() {
+		if api != nil {
+			api.Close()
+		}
+	}()
+
+	changed := 0
+	needRestart := false
+	for _, inbound := range inbounds {
+		if !inbound.Enable || isInboundReloadProtocol(inbound.Protocol) {
+			continue
+		}
+		clients, err := s.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		disabled := make(map[string]bool)
+		for _, stat := range inbound.ClientStats {
+			if !stat.Enable {
+				disabled[stat.Email] = true
+			}
+		}
+		for i := range clients {
+			client := &clients[i]
+			if client.Email == "" || !client.Enable || disabled[client.Email] || bannedEmails[client.Email] {
+				continue
+			}
+			applied, ok := getAppliedSpeed(client.Email)
+			if !ok {
+				continue
+			}
+			limit := ResolveClientSpeedLimit(inbound, client, now)
+			if limit == applied {
+				continue
+			}
+			level, ok := apiSpeedLevel(client.Email, limit)
+			if !ok {
+				needRestart = true
+				continue
+			}
+			if api == nil {
+				apiPort := xrayService.GetApiPort()
+				if apiPort <= 0 {
+					apiPort = xray.GetApiPortFromConfig()
+				}
+				api = &xray.XrayAPI{}
+				if err = api.Init(apiPort); err != nil {
+					api = nil
+					return changed, err
+				}
+			}
+			// 中文注释: 删除失败说明用户已不在 Xray 中(例如刚被禁用)，此时不能重新添加
+			if err := api.RemoveUser(inbound.Tag, client.Email); err != nil {
+				logger.Debug("Unable to remove user for speed change:", client.Email, err)
+				continue
+			}
+			if err := api.AddUser(string(inbound.Protocol), inbound.Tag, speedClientMap(inbound, client, level)); err != nil {
+				logger.Warning("Unable to re-add user with new speed level:", client.Email, err)
+				needRestart = true
+				continue
+			}
+			setAppliedSpeed(client.Email, limit)
+			changed++
+			logger.Infof("为用户 %s 切换限速: 上行 %d KB/s, 下行 %d KB/s (level %d)", client.Email, limit.Up, limit.Down, level)
+		}
+	}
+	if needRestart {
+		xrayService.SetToNeedRestart()
+	}
+	return changed, nil
+}
+
+// userWithSpeedLevel 中文注释: 复制入站设置中的客户端并写入当前限速对应的 level，用于流量重置后通过 API 重新添加用户，
+// 原设置不受影响。流量已重置，不再叠加流量用尽后的限速。
+func (s *InboundService) userWithSpeedLevel(inbound *model.Inbound, c map[string]any) (map[string]any, SpeedLimit) {
+	user := maps.Clone(c)
+	var client model.Client
+	if raw, err := json.Marshal(c); err == nil {
+		json.Unmarshal(raw, &client)
+	}
+	limit := ResolveScheduledSpeedLimit(inbound, &client, s.speedNow())
+	level, ok := apiSpeedLevel(client.Email, limit)
+	if !ok {
+		// 中文注释: 没有可用的 level(如低于最小档位)，重启后按精确的 level 生效
+		xrayService := XrayService{}
+		xrayService.SetToNeedRestart()
+	}
+	user["level"] = level
+	return user, limit
+}
+
+// withSpeedLevels 中文注释: 为通过 API 添加的入站配置中的客户端写入当前限速对应的 level，修改入站的默认限速或限速时段后
+// 重新添加该入站即可生效，不必重启 Xray。返回各用户的限速，有用户找不到 level 时返回 false。
+func (s *InboundService) withSpeedLevels(tx *gorm.DB, inbound *model.Inbound, config *xray.InboundConfig) (map[string]SpeedLimit, bool) {
+	speeds := make(map[string]SpeedLimit)
+	if isInboundReloadProtocol(inbound.Protocol) {
+		return speeds, true
+	}
+	var settings map[string]any
+	if err := json.Unmarshal(config.Settings, &settings); err != nil {
+		return speeds, true
+	}
+	rawClients, _ := settings["clients"].([]any)
+	if len(rawClients) == 0 {
+		return speeds, true
+	}
+	// 中文注释: 使用副本加载流量统计，避免保存入站时连带写入 ClientStats
+	withStats := *inbound
+	tx.Model(xray.ClientTraffic{}).Where("inbound_id = ?", inbound.Id).Find(&withStats.ClientStats)
+	clients, err := s.GetClients(inbound)
+	if err != nil {
+		return speeds, false
+	}
+	byEmail := make(map[string]*model.Client, len(clients))
+	for i := range clients {
+		byEmail[clients[i].Email] = &clients[i]
+	}
+	ok := true
+	for _, rawClient := range rawClients {
+		c, isMap := rawClient.(map[string]any)
+		if !isMap {
+			continue
+		}
+		email, _ := c["email"].(string)
+		client := byEmail[email]
+		if client == nil {
+			continue
+		}
+		limit := s.CurrentSpeedLimit(&withStats, client)
+		level, found := apiSpeedLevel(email, limit)
+		if !found {
+			ok = false
+		}
+		c["level"] = level
+		speeds[email] = limit
+	}
+	newSettings, err := json.Marshal(settings)
+	if err != nil {
+		return speeds, false
+	}
+	config.Settings = newSettings
+	return speeds, ok
+}
+
+// ClientSpeedLevel 中文注释: 返回客户端当前限速对应的 level，供设备限制解封等在服务外重新添加用户的场景使用
+func (s *InboundService) ClientSpeedLevel(email string) int {
+	_, inbound, err := s.GetClientInboundByEmail(email)
+	if err != nil || inbound == nil {
+		return 0
+	}
+	clients, err := s.GetClients(inbound)
+	if err != nil {
+		return 0
+	}
+	for i := range clients {
+		if clients[i].Email == email {
+			level, ok := apiSpeedLevel(email, s.CurrentSpeedLimit(inbound, &clients[i]))
+			if !ok {
+				xrayService := XrayService{}
+				xrayService.SetToNeedRestart()
+			}
+			return level
+		}
+	}
+	return 0
+}
+
+// speedClientMap 中文注释: 构建通过 API 添加用户所需的字段
+func speedClientMap(inbound *model.Inbound, client *model.Client, level int) map[string]any {
+	cipher := ""
+	if inbound.Protocol == model.Shadowsocks {
+		var settings map[string]any
+		if json.Unmarshal([]byte(inbound.Settings), &settings) == nil {
+			cipher, _ = settings["method"].(string)
+		}
+	}
+	return map[string]any{
+		"email":    client.Email,
+		"id":       client.ID,
+		"security": client.Security,
+		"flow":     client.Flow,
+		"password": client.Password,
+		"cipher":   cipher,
+		"level":    level,
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestSnapSpeed(t *testing.T) {
+	presets := []int{256, 512, 1024}
+	tests := []struct {
+		name    string
+		speed   int
+		presets []int
+		want    int
+		wantOk  bool
+	}{
+		{"unlimited", 0, presets, 0, true},
+		{"exact preset", 512, presets, 512, true},
+		{"rounds down between presets", 1000, presets, 512, true},
+		{"rounds down above highest preset", 5000, presets, 1024, true},
+		{"just above lowest preset", 257, presets, 256, true},
+		{"below lowest preset", 100, presets, 0, false},
+		{"no presets", 512, nil, 0, false},
+		{"unlimited without presets", 0, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := snapSpeed(tt.speed, tt.presets)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("snapSpeed(%d, %v) = %d, %v; want %d, %v", tt.speed, tt.presets, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestBuildSpeedLevels(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   []SpeedLimit
+		reserved map[string]any
+		want     map[SpeedLimit]int
+	}{
+		{
+			name:   "symmetric limits use the speed as level",
+			limits: []SpeedLimit{{Up: 512, Down: 512}, {Up: 1024, Down: 1024}},
+			want:   map[SpeedLimit]int{{Up: 512, Down: 512}: 512, {Up: 1024, Down: 1024}: 1024},
+		},
+		{
+			name:   "unlimited gets no level",
+			limits: []SpeedLimit{{}, {Up: 256, Down: 256}},
+			want:   map[SpeedLimit]int{{Up: 256, Down: 256}: 256},
+		},
+		{
+			name:   "asymmetric limits follow the highest symmetric level in sorted order",
+			limits: []SpeedLimit{{Up: 512, Down: 256}, {Up: 1024, Down: 1024}, {Up: 256, Down: 512}, {Up: 0, Down: 100}},
+			want: map[SpeedLimit]int{
+				{Up: 1024, Down: 1024}: 1024,
+				{Up: 0, Down: 100}:     1025,
+				{Up: 256, Down: 512}:   1026,
+				{Up: 512, Down: 256}:   1027,
+			},
+		},
+		{
+			name:     "asymmetric limits skip reserved template levels",
+			limits:   []SpeedLimit{{Up: 100, Down: 200}, {Up: 50, Down: 50}},
+			reserved: map[string]any{"0": nil, "2000": nil, "custom": nil},
+			want:     map[SpeedLimit]int{{Up: 50, Down: 50}: 50, {Up: 100, Down: 200}: 2001},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := make(map[SpeedLimit]bool, len(tt.limits))
+			for _, limit := range tt.limits {
+				limits[limit] = true
+			}
+			got := buildSpeedLevels(limits, tt.reserved)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("buildSpeedLevels() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSpeedLevel(t *testing.T) {
+	presets := []int{256, 512}
+	limits := map[SpeedLimit]bool{}
+	for _, limit := range presetSpeedLimits(presets) {
+		limits[limit] = true
+	}
+	limits[SpeedLimit{Up: 300, Down: 300}] = true
+	levels := buildSpeedLevels(limits, nil)
+
+	speedLevelsLock.RLock()
+	oldLevels, oldPresets := speedLevels, speedPresets
+	speedLevelsLock.RUnlock()
+	setSpeedLevels(SpeedLevels{Levels: levels, Presets: presets})
+	defer setSpeedLevels(SpeedLevels{Levels: oldLevels, Presets: oldPresets})
+
+	tests := []struct {
+		name          string
+		limit         SpeedLimit
+		wantEffective SpeedLimit
+		wantOk        bool
+	}{
+		{"unlimited", SpeedLimit{}, SpeedLimit{}, true},
+		{"exact level", SpeedLimit{Up: 300, Down: 300}, SpeedLimit{Up: 300, Down: 300}, true},
+		{"exact preset", SpeedLimit{Up: 512, Down: 256}, SpeedLimit{Up: 512, Down: 256}, true},
+		{"rounds each direction down", SpeedLimit{Up: 600, Down: 400}, SpeedLimit{Up: 512, Down: 256}, true},
+		{"keeps an unlimited direction", SpeedLimit{Up: 0, Down: 700}, SpeedLimit{Up: 0, Down: 512}, true},
+		{"upload below lowest preset", SpeedLimit{Up: 100, Down: 512}, SpeedLimit{Up: 100, Down: 512}, false},
+		{"download below lowest preset", SpeedLimit{Up: 0, Down: 64}, SpeedLimit{Up: 0, Down: 64}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, effective, ok := ResolveSpeedLevel(tt.limit)
+			if effective != tt.wantEffective || ok != tt.wantOk {
+				t.Fatalf("ResolveSpeedLevel(%v) = %d, %v, %v; want %v, %v", tt.limit, level, effective, ok, tt.wantEffective, tt.wantOk)
+			}
+			if ok && !effective.IsZero() && level != levels[effective] {
+				t.Errorf("ResolveSpeedLevel(%v) level = %d; want %d", tt.limit, level, levels[effective])
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+// parseSpeedSchedule 中文注释: 解析并检查入站的限速时段，为空时返回 nil。
+func parseSpeedSchedule(text string) ([]model.SpeedWindow, error) {
+	if text == "" {
+		return nil, nil
+	}
+	var windows []model.SpeedWindow
+	if err := json.Unmarshal([]byte(text), &windows); err != nil {
+		return nil, common.NewError("invalid speed schedule:", err)
+	}
+	if err := checkSpeedWindows(windows); err != nil {
+		return nil, err
+	}
+	return windows, nil
+}
+
+// checkSpeedWindows 中文注释: 检查限速时段的时间、星期和限速值。
+func checkSpeedWindows(windows []model.SpeedWindow) error {
+	for _, window := range windows {
+		if _, err := time.Parse("15:04", window.Start); err != nil {
+			return common.NewError("invalid speed window start:", window.Start)
+		}
+		if _, err := time.Parse("15:04", window.End); err != nil {
+			return common.NewError("invalid speed window end:", window.End)
+		}
+		for _, day := range window.Days {
+			if day < 0 || day > 6 {
+				return common.NewError("invalid speed window day:", day)
+			}
+		}
+		if err := checkSpeedLimit("speed window "+window.Start+"-"+window.End, window.Up, window.Down); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkClientSpeedSchedules 中文注释: 保存客户端前检查限速时段
+func (s *InboundService) checkClientSpeedSchedules(clients []model.Client) error {
+	for _, client := range clients {
+		if err := checkSpeedWindows(client.SpeedSchedule); err != nil {
+			return common.NewErrorf("client %s: %v", client.Email, err)
+		}
+	}
+	return nil
+}
+
+// activeSpeedWindow 中文注释: 返回 now 所处的第一个限速时段，不在任何时段内时返回 nil。
+func activeSpeedWindow(windows []model.SpeedWindow, now time.Time) *model.SpeedWindow {
+	for i := range windows {
+		if inTimeWindow(windows[i].FreeWindow, now) {
+			return &windows[i]
+		}
+	}
+	return nil
+}
+
+// ResolveScheduledSpeedLimit 中文注释: 计算 now(已转换到面板时区)时客户端实际生效的限速。
+// 客户端处于自己的限速时段时直接使用该时段的限速；入站处于限速时段时，该时段的限速替代入站的默认限速，
+// 客户端自己的限速仍然优先；都不在时段内时按 ResolveSpeedLimit 计算。
+func ResolveScheduledSpeedLimit(inbound *model.Inbound, client *model.Client, now time.Time) SpeedLimit {
+	if window := activeSpeedWindow(client.SpeedSchedule, now); window != nil {
+		return SpeedLimit{Up: window.Up, Down: window.Down}
+	}
+	if inbound != nil {
+		windows, _ := parseSpeedSchedule(inbound.SpeedSchedule)
+		if window := activeSpeedWindow(windows, now); window != nil {
+			scheduled := *inbound
+			scheduled.UpLimit, scheduled.DownLimit = window.Up, window.Down
+			return ResolveSpeedLimit(&scheduled, client)
+		}
+	}
+	return ResolveSpeedLimit(inbound, client)
+}
+
+// possibleSpeedLimits 中文注释: 返回客户端在任意时段可能使用的全部限速(包括流量用尽后的限速)，生成配置时为它们预先建立 policy level，
+// 时段切换时只需通过 API 重新添加用户。
+func possibleSpeedLimits(inbound *model.Inbound, client *model.Client) []SpeedLimit {
+	limits := []SpeedLimit{ResolveSpeedLimit(inbound, client)}
+	for _, window := range client.SpeedSchedule {
+		limits = append(limits, SpeedLimit{Up: window.Up, Down: window.Down})
+	}
+	if inbound != nil {
+		windows, _ := parseSpeedSchedule(inbound.SpeedSchedule)
+		for _, window := range windows {
+			scheduled := *inbound
+			scheduled.UpLimit, scheduled.DownLimit = window.Up, window.Down
+			limits = append(limits, ResolveSpeedLimit(&scheduled, client))
+		}
+	}
+	if throttlesAfterQuota(client) {
+		for _, limit := range limits {
+			limits = append(limits, throttleSpeed(limit, client.ThrottleSpeed))
+		}
+	}
+	return limits
+}
+
+// speedNow 中文注释: 返回面板时区的当前时间，用于判断限速时段。
+func (s *InboundService) speedNow() time.Time {
+	loc, err := s.settingService.GetTimeLocation()
+	if err != nil {
+		loc = time.Local
+	}
+	return time.Now().In(loc)
+}
+
+// CurrentSpeedLimit 中文注释: 客户端当前实际生效的限速(已考虑限速时段和流量用尽后的限速)
+func (s *InboundService) CurrentSpeedLimit(inbound *model.Inbound, client *model.Client) SpeedLimit {
+	return ResolveClientSpeedLimit(inbound, client, s.speedNow())
+}
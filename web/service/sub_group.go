@@ -0,0 +1,229 @@
+package service
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/random"
+
+	"gorm.io/gorm"
+)
+
+// SubGroupService 中文注释: 管理订阅分组。每个分组由显式选择的入站 tag 和客户端 email 组成，
+// 拥有独立的订阅ID、标题、更新间隔、备注模板和访问限制。
+type SubGroupService struct{}
+
+func (s *SubGroupService) GetSubGroups() ([]*model.SubGroup, error) {
+	db := database.GetDB()
+	var groups []*model.SubGroup
+	err := db.Model(model.SubGroup{}).Find(&groups).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (s *SubGroupService) GetSubGroup(id int) (*model.SubGroup, error) {
+	db := database.GetDB()
+	group := &model.SubGroup{}
+	err := db.Model(model.SubGroup{}).First(group, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// GetSubGroupBySubId 中文注释: 根据订阅ID查找分组，不存在时返回 nil, nil。
+func (s *SubGroupService) GetSubGroupBySubId(subId string) (*model.SubGroup, error) {
+	db := database.GetDB()
+	var groups []*model.SubGroup
+	err := db.Model(model.SubGroup{}).Where("sub_id = ?", subId).Limit(1).Find(&groups).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	return groups[0], nil
+}
+
+func (s *SubGroupService) AddSubGroup(group *model.SubGroup) (*model.SubGroup, error) {
+	group.Id = 0
+	if group.SubId == "" {
+		group.SubId = random.Seq(16)
+	}
+	if err := s.checkValid(group); err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	return group, db.Create(group).Error
+}
+
+func (s *SubGroupService) UpdateSubGroup(group *model.SubGroup) (*model.SubGroup, error) {
+	oldGroup, err := s.GetSubGroup(group.Id)
+	if err != nil {
+		return nil, err
+	}
+	if group.SubId == "" {
+		group.SubId = oldGroup.SubId
+	}
+	if err := s.checkValid(group); err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	return group, db.Save(group).Error
+}
+
+func (s *SubGroupService) DelSubGroup(id int) error {
+	db := database.GetDB()
+	return db.Delete(model.SubGroup{}, id).Error
+}
+
+func (s *SubGroupService) checkValid(group *model.SubGroup) error {
+	if strings.TrimSpace(group.Title) == "" {
+		return common.NewError("subscription group title is empty")
+	}
+	if group.UpdateInterval < 0 {
+		return common.NewError("invalid update interval:", group.UpdateInterval)
+	}
+	if group.RemarkModel != "" && len(group.RemarkModel) < 2 {
+		return common.NewError("invalid remark model:", group.RemarkModel)
+	}
+
+	tags, err := s.GetInboundTags(group)
+	if err != nil {
+		return common.NewError("invalid inbound selector:", err)
+	}
+	emails, err := s.GetClientEmails(group)
+	if err != nil {
+		return common.NewError("invalid client selector:", err)
+	}
+	if len(tags) == 0 && len(emails) == 0 {
+		return common.NewError("subscription group selects no inbound or client")
+	}
+	for _, entry := range s.GetAllowedIPs(group) {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return common.NewError("invalid allowed ip:", entry)
+		}
+	}
+
+	db := database.GetDB()
+	var count int64
+	if group.ProfileId > 0 {
+		err = db.Model(model.SubJsonProfile{}).Where("id = ?", group.ProfileId).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return common.NewError("subscription profile not found:", group.ProfileId)
+		}
+	}
+	err = db.Model(model.SubGroup{}).Where("sub_id = ? AND id != ?", group.SubId, group.Id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		// 中文注释: 分组的订阅ID不能与任何客户端自身的 subId 冲突，否则客户端的个人订阅会被分组覆盖
+		err = db.Raw(`
+			SELECT COUNT(*)
+			FROM inbounds,
+				JSON_EACH(JSON_EXTRACT(inbounds.settings, '$.clients')) AS client
+			WHERE JSON_EXTRACT(client.value, '$.subId') = ?`, group.SubId).Scan(&count).Error
+		if err != nil {
+			return err
+		}
+	}
+	if count > 0 {
+		return common.NewError("Duplicate subscription ID:", group.SubId)
+	}
+	return nil
+}
+
+// GetInboundTags 中文注释: 解析分组中选择的入站 tag 列表。
+func (s *SubGroupService) GetInboundTags(group *model.SubGroup) ([]string, error) {
+	return parseSelector(group.Inbounds)
+}
+
+// GetClientEmails 中文注释: 解析分组中显式选择的客户端 email 列表。
+func (s *SubGroupService) GetClientEmails(group *model.SubGroup) ([]string, error) {
+	return parseSelector(group.Clients)
+}
+
+func (s *SubGroupService) GetAllowedIPs(group *model.SubGroup) []string {
+	var result []string
+	for _, entry := range strings.Split(group.AllowedIPs, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// IsAccessible 中文注释: 检查分组是否启用、是否过期，以及请求来源 IP 是否在允许列表中。
+func (s *SubGroupService) IsAccessible(group *model.SubGroup, remoteIp string) bool {
+	if !group.Enable {
+		return false
+	}
+	if group.ExpiryTime > 0 && group.ExpiryTime <= time.Now().UnixMilli() {
+		return false
+	}
+	allowed := s.GetAllowedIPs(group)
+	if len(allowed) == 0 {
+		return true
+	}
+	ip := net.ParseIP(remoteIp)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		} else if allowedIp := net.ParseIP(entry); allowedIp != nil && allowedIp.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches 中文注释: 判断某个入站下的客户端是否被分组选中。
+func (s *SubGroupService) Matches(group *model.SubGroup, inboundTag string, email string) bool {
+	tags, _ := s.GetInboundTags(group)
+	for _, tag := range tags {
+		if tag == inboundTag {
+			return true
+		}
+	}
+	emails, _ := s.GetClientEmails(group)
+	for _, e := range emails {
+		if email != "" && strings.EqualFold(e, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSelector(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var items []string
+	if err := json.Unmarshal([]byte(value), &items); err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+
+	"gorm.io/gorm"
+)
+
+// SubJsonProfileService 中文注释: 管理 JSON 订阅的客户端路由方案。
+type SubJsonProfileService struct{}
+
+func (s *SubJsonProfileService) GetProfiles() ([]*model.SubJsonProfile, error) {
+	db := database.GetDB()
+	var profiles []*model.SubJsonProfile
+	err := db.Model(model.SubJsonProfile{}).Find(&profiles).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+func (s *SubJsonProfileService) GetProfile(id int) (*model.SubJsonProfile, error) {
+	db := database.GetDB()
+	profile := &model.SubJsonProfile{}
+	err := db.Model(model.SubJsonProfile{}).First(profile, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// GetProfileMap 中文注释: 按ID索引全部方案，供生成订阅时一次性加载。
+func (s *SubJsonProfileService) GetProfileMap() (map[int]*model.SubJsonProfile, error) {
+	profiles, err := s.GetProfiles()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int]*model.SubJsonProfile, len(profiles))
+	for _, profile := range profiles {
+		result[profile.Id] = profile
+	}
+	return result, nil
+}
+
+func (s *SubJsonProfileService) AddProfile(profile *model.SubJsonProfile) (*model.SubJsonProfile, error) {
+	profile.Id = 0
+	if err := s.checkValid(profile); err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	return profile, db.Create(profile).Error
+}
+
+func (s *SubJsonProfileService) UpdateProfile(profile *model.SubJsonProfile) (*model.SubJsonProfile, error) {
+	if _, err := s.GetProfile(profile.Id); err != nil {
+		return nil, err
+	}
+	if err := s.checkValid(profile); err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	return profile, db.Save(profile).Error
+}
+
+// DelProfile 中文注释: 删除方案并清除订阅分组上的引用；客户端上残留的ID在生成订阅时会被忽略。
+func (s *SubJsonProfileService) DelProfile(id int) error {
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(model.SubGroup{}).Where("profile_id = ?", id).Update("profile_id", 0).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(model.SubJsonProfile{}, id).Error
+	})
+}
+
+func (s *SubJsonProfileService) checkValid(profile *model.SubJsonProfile) error {
+	profile.Name = strings.TrimSpace(profile.Name)
+	if profile.Name == "" {
+		return common.NewError("profile name is empty")
+	}
+	if profile.Rules != "" {
+		var rules []any
+		if err := json.Unmarshal([]byte(profile.Rules), &rules); err != nil {
+			return common.NewError("invalid routing rules:", err)
+		}
+	}
+	objects := map[string]string{
+		"dns":      profile.Dns,
+		"fragment": profile.Fragment,
+		"noises":   profile.Noises,
+		"mux":      profile.Mux,
+	}
+	for name, value := range objects {
+		if value == "" {
+			continue
+		}
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(value), &obj); err != nil {
+			return common.NewError("invalid", name, "settings:", err)
+		}
+	}
+
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.SubJsonProfile{}).Where("name = ? AND id != ?", profile.Name, profile.Id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewError("Duplicate profile name:", profile.Name)
+	}
+	return nil
+}
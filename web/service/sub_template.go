@@ -0,0 +1,146 @@
+package service
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+
+	"gorm.io/gorm"
+)
+
+const defaultSubTemplateContentType = "text/plain; charset=utf-8"
+
+var subTemplatePathRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// subTemplateFuncs 中文注释: 模板中可用的辅助函数，除 text/template 内置函数外补充常用的字符串处理。
+var subTemplateFuncs = template.FuncMap{
+	"join":      strings.Join,
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"replace":   strings.ReplaceAll,
+	"contains":  strings.Contains,
+	"hasPrefix": strings.HasPrefix,
+	"base64": func(value string) string {
+		return base64.StdEncoding.EncodeToString([]byte(value))
+	},
+	"default": func(fallback any, value any) any {
+		if value == nil || value == "" || value == 0 || value == false {
+			return fallback
+		}
+		return value
+	},
+}
+
+// SubTemplateService 中文注释: 管理自定义订阅模板，新增客户端格式时无需修改代码。
+type SubTemplateService struct{}
+
+func (s *SubTemplateService) GetSubTemplates() ([]*model.SubTemplate, error) {
+	db := database.GetDB()
+	var templates []*model.SubTemplate
+	err := db.Model(model.SubTemplate{}).Find(&templates).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (s *SubTemplateService) GetSubTemplate(id int) (*model.SubTemplate, error) {
+	db := database.GetDB()
+	tpl := &model.SubTemplate{}
+	err := db.Model(model.SubTemplate{}).First(tpl, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// GetSubTemplateByPath 中文注释: 根据订阅地址后缀查找已启用的模板，不存在时返回 nil, nil。
+func (s *SubTemplateService) GetSubTemplateByPath(path string) (*model.SubTemplate, error) {
+	db := database.GetDB()
+	var templates []*model.SubTemplate
+	err := db.Model(model.SubTemplate{}).Where("path = ? AND enable = ?", path, true).Limit(1).Find(&templates).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, nil
+	}
+	return templates[0], nil
+}
+
+func (s *SubTemplateService) AddSubTemplate(tpl *model.SubTemplate) (*model.SubTemplate, error) {
+	tpl.Id = 0
+	if err := s.checkValid(tpl); err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	return tpl, db.Create(tpl).Error
+}
+
+func (s *SubTemplateService) UpdateSubTemplate(tpl *model.SubTemplate) (*model.SubTemplate, error) {
+	if _, err := s.GetSubTemplate(tpl.Id); err != nil {
+		return nil, err
+	}
+	if err := s.checkValid(tpl); err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	return tpl, db.Save(tpl).Error
+}
+
+func (s *SubTemplateService) DelSubTemplate(id int) error {
+	db := database.GetDB()
+	return db.Delete(model.SubTemplate{}, id).Error
+}
+
+// Parse 中文注释: 解析模板内容，保存时和渲染订阅时使用同一组辅助函数。
+func (s *SubTemplateService) Parse(tpl *model.SubTemplate) (*template.Template, error) {
+	return template.New(tpl.Path).Funcs(subTemplateFuncs).Parse(tpl.Content)
+}
+
+// GetContentType 中文注释: 返回模板的响应类型，未设置时使用纯文本。
+func (s *SubTemplateService) GetContentType(tpl *model.SubTemplate) string {
+	if tpl.ContentType == "" {
+		return defaultSubTemplateContentType
+	}
+	return tpl.ContentType
+}
+
+func (s *SubTemplateService) checkValid(tpl *model.SubTemplate) error {
+	tpl.Name = strings.TrimSpace(tpl.Name)
+	tpl.Path = strings.TrimSpace(tpl.Path)
+	tpl.ContentType = strings.TrimSpace(tpl.ContentType)
+	if tpl.Name == "" {
+		return common.NewError("template name is empty")
+	}
+	if !subTemplatePathRegex.MatchString(tpl.Path) {
+		return common.NewError("invalid template path:", tpl.Path)
+	}
+	if strings.ContainsAny(tpl.ContentType, "\r\n") {
+		return common.NewError("invalid content type:", tpl.ContentType)
+	}
+	if strings.TrimSpace(tpl.Content) == "" {
+		return common.NewError("template content is empty")
+	}
+	if _, err := s.Parse(tpl); err != nil {
+		return common.NewError("invalid template:", err)
+	}
+
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.SubTemplate{}).
+		Where("(name = ? OR path = ?) AND id != ?", tpl.Name, tpl.Path, tpl.Id).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewError("Duplicate template name or path:", tpl.Name, tpl.Path)
+	}
+	return nil
+}
@@ -82,6 +82,8 @@ type Tgbot struct {
 	serverService  ServerService
 	xrayService    XrayService
 	lastStatus     *Status
+
+	deviceLimitService DeviceLimitService
 }
 
 func (t *Tgbot) NewTgbot() *Tgbot {
@@ -499,6 +501,44 @@ func (t *Tgbot) answerCommand(message *telego.Message, chatId int64, isAdmin boo
 		} else {
 			handleUnknownCommand()
 		}
+	case "bans":
+		onlyMessage = true
+		if isAdmin {
+			msg += t.getDeviceBans()
+		} else {
+			handleUnknownCommand()
+		}
+	case "unban":
+		onlyMessage = true
+		if isAdmin && len(commandArgs) > 0 {
+			minutes := 0
+			if len(commandArgs) > 1 {
+				minutes, _ = strconv.Atoi(commandArgs[1])
+			}
+			err := t.deviceLimitService.UnbanClient(commandArgs[0], minutes)
+			if err != nil {
+				msg += t.I18nBot("tgbot.commands.unbanFailed", "Email=="+commandArgs[0], "Error=="+err.Error())
+			} else if minutes > 0 {
+				msg += t.I18nBot("tgbot.messages.deviceExempted", "Email=="+commandArgs[0], "Minutes=="+strconv.Itoa(minutes))
+			} else {
+				msg += t.I18nBot("tgbot.messages.deviceUnbanned", "Email=="+commandArgs[0])
+			}
+		} else if isAdmin {
+			msg += t.I18nBot("tgbot.commands.unbanUsage")
+		} else {
+			handleUnknownCommand()
+		}
+	case "banlog":
+		onlyMessage = true
+		if isAdmin {
+			email := ""
+			if len(commandArgs) > 0 {
+				email = commandArgs[0]
+			}
+			msg += t.getDeviceBanLogs(email)
+		} else {
+			handleUnknownCommand()
+		}
 	default:
 		handleUnknownCommand()
 	}
@@ -508,6 +548,57 @@ func (t *Tgbot) answerCommand(message *telego.Message, chatId int64, isAdmin boo
 	}
 }
 
+// getDeviceBans 中文注释: 当前因设备数超限被封禁的客户端列表。
+func (t *Tgbot) getDeviceBans() string {
+	bans, err := t.deviceLimitService.GetBanDetails()
+	if err != nil {
+		logger.Warning(err)
+		return t.I18nBot("tgbot.answers.errorOperation")
+	}
+	if len(bans) == 0 {
+		return t.I18nBot("tgbot.messages.noDeviceBans")
+	}
+	msg := ""
+	for _, ban := range bans {
+		ips := strings.Join(ban.Ips, ", ")
+		if ips == "" {
+			ips = "-"
+		}
+		msg += t.I18nBot("tgbot.messages.deviceBan",
+			"Email=="+ban.Email,
+			"Limit=="+strconv.Itoa(ban.DeviceLimit),
+			"Count=="+strconv.Itoa(len(ban.Ips)),
+			"IPs=="+ips,
+			"Time=="+time.UnixMilli(ban.BannedAt).Format("2006-01-02 15:04:05"))
+	}
+	return msg
+}
+
+// getDeviceBanLogs 中文注释: 最近 20 条封禁历史，email 为空时包含全部客户端。
+func (t *Tgbot) getDeviceBanLogs(email string) string {
+	logs, err := t.deviceLimitService.GetBanLogs(email, 20)
+	if err != nil {
+		logger.Warning(err)
+		return t.I18nBot("tgbot.answers.errorOperation")
+	}
+	if len(logs) == 0 {
+		return t.I18nBot("tgbot.messages.noDeviceBanLogs")
+	}
+	msg := ""
+	for _, entry := range logs {
+		action := t.I18nBot("tgbot.messages.deviceBanAction." + entry.Action)
+		if entry.Reason != "" {
+			action += " (" + t.I18nBot("tgbot.messages.deviceUnbanReason."+entry.Reason) + ")"
+		}
+		msg += t.I18nBot("tgbot.messages.deviceBanLog",
+			"Time=="+time.UnixMilli(entry.CreatedAt).Format("2006-01-02 15:04:05"),
+			"Email=="+entry.Email,
+			"Action=="+action,
+			"Count=="+strconv.Itoa(entry.ActiveIps))
+	}
+	return msg
+}
+
 // Helper function to send the message based on onlyMessage flag.
 func (t *Tgbot) sendResponse(chatId int64, msg string, onlyMessage, isAdmin bool) {
 	if onlyMessage {
@@ -1106,6 +1197,114 @@ func (t *Tgbot) answerCallback(callbackQuery *telego.CallbackQuery, isAdmin bool
 				}
 				t.sendCallbackAnswerTgBot(callbackQuery.ID, t.I18nBot("tgbot.answers.errorOperation"))
 				t.searchClient(chatId, email, callbackQuery.Message.GetMessageID())
+			case "device_limit":
+				inlineKeyboard := tu.InlineKeyboard(
+					tu.InlineKeyboardRow(
+						tu.InlineKeyboardButton(t.I18nBot("tgbot.buttons.cancel")).WithCallbackData(t.encodeQuery("client_cancel "+email)),
+					),
+					tu.InlineKeyboardRow(
+						tu.InlineKeyboardButton(t.I18nBot("tgbot.buttons.deviceLimitInherit")).WithCallbackData(t.encodeQuery("device_limit_c "+email+" 0")),
+						tu.InlineKeyboardButton(t.I18nBot("tgbot.buttons.custom")).WithCallbackData(t.encodeQuery("device_limit_in "+email+" 0")),
+					),
+					tu.InlineKeyboardRow(
+						tu.InlineKeyboardButton("1").WithCallbackData(t.encodeQuery("device_limit_c "+email+" 1")),
+						tu.InlineKeyboardButton("2").WithCallbackData(t.encodeQuery("device_limit_c "+email+" 2")),
+					),
+					tu.InlineKeyboardRow(
+						tu.InlineKeyboardButton("3").WithCallbackData(t.encodeQuery("device_limit_c "+email+" 3")),
+						tu.InlineKeyboardButton("4").WithCallbackData(t.encodeQuery("device_limit_c "+email+" 4")),
+					),
+					tu.InlineKeyboardRow(
+						tu.InlineKeyboardButton("5").WithCallbackData(t.encodeQuery("device_limit_c "+email+" 5")),
+						tu.InlineKeyboardButton("6").WithCallbackData(t.encodeQuery("device_limit_c "+email+" 6")),
+						tu.InlineKeyboardButton("7").WithCallbackData(t.encodeQuery("device_limit_c "+email+" 7")),
+					),
+					tu.InlineKeyboardRow(
+						tu.InlineKeyboardButton("8").WithCallbackData(t.encodeQuery("device_limit_c "+email+" 8")),
+						tu.InlineKeyboardButton("9").WithCallbackData(t.encodeQuery("device_limit_c "+email+" 9")),
+						tu.InlineKeyboardButton("10").WithCallbackData(t.encodeQuery("device_limit_c "+email+" 10")),
+					),
+				)
+				t.editMessageCallbackTgBot(chatId, callbackQuery.Message.GetMessageID(), inlineKeyboard)
+			case "device_limit_c":
+				if len(dataArray) == 3 {
+					count, err := strconv.Atoi(dataArray[2])
+					if err == nil {
+						needRestart, err := t.inboundService.ResetClientDeviceLimitByEmail(email, count)
+						if needRestart {
+							t.xrayService.SetToNeedRestart()
+						}
+						if err == nil {
+							t.sendCallbackAnswerTgBot(callbackQuery.ID, t.I18nBot("tgbot.answers.resetDeviceLimitSuccess", "Email=="+email, "Count=="+strconv.Itoa(count)))
+							t.searchClient(chatId, email, callbackQuery.Message.GetMessageID())
+							return
+						}
+					}
+				}
+				t.sendCallbackAnswerTgBot(callbackQuery.ID, t.I18nBot("tgbot.answers.errorOperation"))
+				t.searchClient(chatId, email, callbackQuery.Message.GetMessageID())
+			case "device_limit_in":
+				if len(dataArray) >= 3 {
+					oldInputNumber, err := strconv.Atoi(dataArray[2])
+					inputNumber := oldInputNumber
+					if err == nil {
+						if len(dataArray) == 4 {
+							num, err := strconv.Atoi(dataArray[3])
+							if err == nil {
+								switch num {
+								case -2:
+									inputNumber = 0
+								case -1:
+									if inputNumber > 0 {
+										inputNumber = (inputNumber / 10)
+									}
+								default:
+									inputNumber = (inputNumber * 10) + num
+								}
+							}
+							if inputNumber == oldInputNumber {
+								t.sendCallbackAnswerTgBot(callbackQuery.ID, t.I18nBot("tgbot.answers.successfulOperation"))
+								return
+							}
+							if inputNumber >= 999999 {
+								t.sendCallbackAnswerTgBot(callbackQuery.ID, t.I18nBot("tgbot.answers.errorOperation"))
+								return
+							}
+						}
+						inlineKeyboard := tu.InlineKeyboard(
+							tu.InlineKeyboardRow(
+								tu.InlineKeyboardButton(t.I18nBot("tgbot.buttons.cancel")).WithCallbackData(t.encodeQuery("client_cancel "+email)),
+							),
+							tu.InlineKeyboardRow(
+								tu.InlineKeyboardButton(t.I18nBot("tgbot.buttons.confirmNumber", "Num=="+strconv.Itoa(inputNumber))).WithCallbackData(t.encodeQuery("device_limit_c "+email+" "+strconv.Itoa(inputNumber))),
+							),
+							tu.InlineKeyboardRow(
+								tu.InlineKeyboardButton("1").WithCallbackData(t.encodeQuery("device_limit_in "+email+" "+strconv.Itoa(inputNumber)+" 1")),
+								tu.InlineKeyboardButton("2").WithCallbackData(t.encodeQuery("device_limit_in "+email+" "+strconv.Itoa(inputNumber)+" 2")),
+								tu.InlineKeyboardButton("3").WithCallbackData(t.encodeQuery("device_limit_in "+email+" "+strconv.Itoa(inputNumber)+" 3")),
+							),
+							tu.InlineKeyboardRow(
+								tu.InlineKeyboardButton("4").WithCallbackData(t.encodeQuery("device_limit_in "+email+" "+strconv.Itoa(inputNumber)+" 4")),
+								tu.InlineKeyboardButton("5").WithCallbackData(t.encodeQuery("device_limit_in "+email+" "+strconv.Itoa(inputNumber)+" 5")),
+								tu.InlineKeyboardButton("6").WithCallbackData(t.encodeQuery("device_limit_in "+email+" "+strconv.Itoa(inputNumber)+" 6")),
+							),
+							tu.InlineKeyboardRow(
+								tu.InlineKeyboardButton("7").WithCallbackData(t.encodeQuery("device_limit_in "+email+" "+strconv.Itoa(inputNumber)+" 7")),
+								tu.InlineKeyboardButton("8").WithCallbackData(t.encodeQuery("device_limit_in "+email+" "+strconv.Itoa(inputNumber)+" 8")),
+								tu.InlineKeyboardButton("9").WithCallbackData(t.encodeQuery("device_limit_in "+email+" "+strconv.Itoa(inputNumber)+" 9")),
+							),
+							tu.InlineKeyboardRow(
+								tu.InlineKeyboardButton("🔄").WithCallbackData(t.encodeQuery("device_limit_in "+email+" "+strconv.Itoa(inputNumber)+" -2")),
+								tu.InlineKeyboardButton("0").WithCallbackData(t.encodeQuery("device_limit_in "+email+" "+strconv.Itoa(inputNumber)+" 0")),
+								tu.InlineKeyboardButton("⬅️").WithCallbackData(t.encodeQuery("device_limit_in "+email+" "+strconv.Itoa(inputNumber)+" -1")),
+							),
+						)
+						t.editMessageCallbackTgBot(chatId, callbackQuery.Message.GetMessageID(), inlineKeyboard)
+						return
+					}
+				}
+				t.sendCallbackAnswerTgBot(callbackQuery.ID, t.I18nBot("tgbot.answers.errorOperation"))
+				t.searchClient(chatId, email, callbackQuery.Message.GetMessageID())
 			case "add_client_ip_limit_c":
 				if len(dataArray) == 2 {
 					count, _ := strconv.Atoi(dataArray[1])
@@ -1956,6 +2155,23 @@ func (t *Tgbot) SendBackupToAdmins() {
 	}
 }
 
+// SendDocumentToAdmins 中文注释: 将生成的文件作为附件发送给所有管理员。
+func (t *Tgbot) SendDocumentToAdmins(name string, data []byte, caption string) {
+	if !t.IsRunning() {
+		return
+	}
+	for _, adminId := range adminIds {
+		document := tu.Document(
+			tu.ID(adminId),
+			tu.FileFromBytes(data, name),
+		).WithCaption(caption)
+		_, err := bot.SendDocument(context.Background(), document)
+		if err != nil {
+			logger.Error("Error in sending document to admin: ", err)
+		}
+	}
+}
+
 func (t *Tgbot) sendExhaustedToAdmins() {
 	if !t.IsRunning() {
 		return
@@ -2298,6 +2514,12 @@ func (t *Tgbot) clientInfoMsg(
 		output += t.I18nBot("tgbot.messages.upload", "Upload=="+common.FormatTraffic(traffic.Up))
 		output += t.I18nBot("tgbot.messages.download", "Download=="+common.FormatTraffic(traffic.Down))
 		output += t.I18nBot("tgbot.messages.total", "UpDown=="+common.FormatTraffic((traffic.Up+traffic.Down)), "Total=="+total)
+		if limit, err := t.inboundService.GetClientSpeedLimit(traffic.Email); err == nil && !limit.IsZero() {
+			output += t.I18nBot("tgbot.messages.speedLimit", "Up=="+t.formatSpeed(limit.Up), "Down=="+t.formatSpeed(limit.Down))
+		}
+		if _, client, err := t.inboundService.GetClientByEmail(traffic.Email); err == nil && QuotaThrottled(client, traffic) {
+			output += t.I18nBot("tgbot.messages.quotaThrottled")
+		}
 	}
 	if printRefreshed {
 		output += t.I18nBot("tgbot.messages.refreshedOn", "Time=="+time.Now().Format("2006-01-02 15:04:05"))
@@ -2306,6 +2528,14 @@ func (t *Tgbot) clientInfoMsg(
 	return output
 }
 
+// formatSpeed 中文注释: 格式化单个方向的限速，0 显示为不限
+func (t *Tgbot) formatSpeed(speed int) string {
+	if speed <= 0 {
+		return t.I18nBot("tgbot.unlimited")
+	}
+	return fmt.Sprintf("%d KB/s", speed)
+}
+
 func (t *Tgbot) getClientUsage(chatId int64, tgUserID int64, email ...string) {
 	traffics, err := t.inboundService.GetClientTrafficTgBot(tgUserID)
 	if err != nil {
@@ -2459,6 +2689,7 @@ func (t *Tgbot) searchClient(chatId int64, email string, messageID ...int) {
 			tu.InlineKeyboardButton(t.I18nBot("tgbot.buttons.ipLimit")).WithCallbackData(t.encodeQuery("ip_limit "+email)),
 		),
 		tu.InlineKeyboardRow(
+			tu.InlineKeyboardButton(t.I18nBot("tgbot.buttons.deviceLimit")).WithCallbackData(t.encodeQuery("device_limit "+email)),
 			tu.InlineKeyboardButton(t.I18nBot("tgbot.buttons.setTGUser")).WithCallbackData(t.encodeQuery("tg_user "+email)),
 		),
 		tu.InlineKeyboardRow(
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	TrafficKindClient   = "client"
+	TrafficKindInbound  = "inbound"
+	TrafficKindOutbound = "outbound"
+	// TrafficKindServer 中文注释: 全服务器流量不单独存储，查询时由全部入站流量汇总
+	TrafficKindServer = "server"
+
+	TrafficIntervalHour = "hour"
+	TrafficIntervalDay  = "day"
+)
+
+// TrafficPoint 中文注释: 流量曲线上的一个时间段，Time 为时间段起点的毫秒时间戳。
+type TrafficPoint struct {
+	Time int64 `json:"time"`
+	Up   int64 `json:"up"`
+	Down int64 `json:"down"`
+}
+
+// TrafficHistoryService 中文注释: 将每次流量统计的增量累加到按小时的历史表中。按小时数据超过保留天数后
+// 汇总为按天数据(降采样)，按天数据超过保留天数后删除，保留天数为 0 表示永久保留。
+// 某一时刻的数据只存在于其中一张表，按天查询时合并两张表；长时间范围的查询自动使用按天数据。
+type TrafficHistoryService struct {
+	settingService SettingService
+}
+
+// Record 中文注释: 将一次 Xray 流量统计的增量记入当前小时。
+func (s *TrafficHistoryService) Record(traffics []*xray.Traffic, clientTraffics []*xray.ClientTraffic) error {
+	type key struct{ kind, name string }
+	deltas := make(map[key]*TrafficPoint)
+	add := func(kind string, name string, up int64, down int64) {
+		if name == "" || up+down <= 0 {
+			return
+		}
+		k := key{kind, name}
+		if deltas[k] == nil {
+			deltas[k] = &TrafficPoint{}
+		}
+		deltas[k].Up += up
+		deltas[k].Down += down
+	}
+	for _, traffic := range traffics {
+		if traffic.IsInbound {
+			add(TrafficKindInbound, traffic.Tag, traffic.Up, traffic.Down)
+		} else if traffic.IsOutbound {
+			add(TrafficKindOutbound, traffic.Tag, traffic.Up, traffic.Down)
+		}
+	}
+	for _, traffic := range clientTraffics {
+		add(TrafficKindClient, traffic.Email, traffic.Up, traffic.Down)
+	}
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	hourStart, _ := s.getBuckets(time.Now())
+	hourly := make([]model.TrafficHourly, 0, len(deltas))
+	for k, delta := range deltas {
+		hourly = append(hourly, model.TrafficHourly{Kind: k.kind, Name: k.name, Bucket: hourStart, Up: delta.Up, Down: delta.Down})
+	}
+	db := database.GetDB()
+	return db.Clauses(trafficUpsert()).CreateInBatches(&hourly, 100).Error
+}
+
+func trafficUpsert() clause.OnConflict {
+	return clause.OnConflict{
+		Columns: []clause.Column{{Name: "kind"}, {Name: "name"}, {Name: "bucket"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"up":   gorm.Expr("up + excluded.up"),
+			"down": gorm.Expr("down + excluded.down"),
+		}),
+	}
+}
+
+// Cleanup 中文注释: 将超过保留天数的按小时数据按天汇总后删除，并删除超过保留天数的按天数据。
+// 截止时间对齐到天的起点，使每天的按小时数据一次性汇总。
+func (s *TrafficHistoryService) Cleanup() error {
+	hourlyDays, dailyDays := s.getRetention()
+	now := time.Now()
+	if hourlyDays > 0 {
+		_, cutoff := s.getBuckets(now.AddDate(0, 0, -hourlyDays))
+		if err := s.rollupHourly(cutoff); err != nil {
+			return err
+		}
+	}
+	if dailyDays > 0 {
+		_, cutoff := s.getBuckets(now.AddDate(0, 0, -dailyDays))
+		if err := database.GetDB().Where("bucket < ?", cutoff).Delete(model.TrafficDaily{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollupHourly 中文注释: 在同一事务中将 cutoff 之前的按小时数据累加到所在天的按天数据，再删除这些按小时数据
+func (s *TrafficHistoryService) rollupHourly(cutoff int64) error {
+	loc := s.getLocation()
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var buckets []int64
+		err := tx.Model(model.TrafficHourly{}).Where("bucket < ?", cutoff).Distinct("bucket").Pluck("bucket", &buckets).Error
+		if err != nil || len(buckets) == 0 {
+			return err
+		}
+		hoursByDay := make(map[int64][]int64)
+		for _, bucket := range buckets {
+			day := dayStartIn(time.UnixMilli(bucket), loc)
+			hoursByDay[day] = append(hoursByDay[day], bucket)
+		}
+		for day, hours := range hoursByDay {
+			var daily []model.TrafficDaily
+			err := tx.Model(model.TrafficHourly{}).
+				Select("kind, name, SUM(up) AS up, SUM(down) AS down").
+				Where("bucket IN ?", hours).
+				Group("kind, name").
+				Scan(&daily).Error
+			if err != nil {
+				return err
+			}
+			if len(daily) == 0 {
+				continue
+			}
+			for i := range daily {
+				daily[i].Bucket = day
+			}
+			if err := tx.Clauses(trafficUpsert()).CreateInBatches(&daily, 100).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("bucket < ?", cutoff).Delete(model.TrafficHourly{}).Error
+	})
+}
+
+// GetHistory 中文注释: 查询指定对象在时间范围内的流量曲线。
+// kind 为 client/inbound/outbound/server(server 不需要 name)；interval 为 hour/day，
+// 为空时若范围超出按小时数据的保留时间则使用按天数据。from/to 为毫秒时间戳，to 为 0 表示当前时间。
+func (s *TrafficHistoryService) GetHistory(kind string, name string, interval string, from int64, to int64) ([]*TrafficPoint, error) {
+	switch kind {
+	case TrafficKindClient, TrafficKindInbound, TrafficKindOutbound:
+		if name == "" {
+			return nil, common.NewError("traffic history name is empty")
+		}
+	case TrafficKindServer:
+	default:
+		return nil, common.NewError("invalid traffic history kind:", kind)
+	}
+	if to <= 0 {
+		to = time.Now().UnixMilli()
+	}
+	if from > to {
+		return nil, common.NewError("invalid traffic history range")
+	}
+
+	if interval == "" {
+		hourlyDays, _ := s.getRetention()
+		if hourlyDays <= 0 {
+			// 中文注释: 按小时数据永久保留时，超过一周的范围同样使用按天数据，避免返回过多的点
+			hourlyDays = 7
+		}
+		interval = TrafficIntervalHour
+		if from < time.Now().AddDate(0, 0, -hourlyDays).UnixMilli() {
+			interval = TrafficIntervalDay
+		}
+	}
+	if interval != TrafficIntervalHour && interval != TrafficIntervalDay {
+		return nil, common.NewError("invalid traffic history interval:", interval)
+	}
+
+	filter := func(query *gorm.DB) *gorm.DB {
+		if kind == TrafficKindServer {
+			return query.Where("kind = ?", TrafficKindInbound)
+		}
+		return query.Where("kind = ? AND name = ?", kind, name)
+	}
+	db := database.GetDB()
+	var hourly []*TrafficPoint
+	err := filter(db.Model(model.TrafficHourly{})).
+		Select("bucket AS time, SUM(up) AS up, SUM(down) AS down").
+		Where("bucket >= ? AND bucket <= ?", s.getBucketStart(interval, from), to).
+		Group("bucket").Order("bucket").Scan(&hourly).Error
+	if err != nil || interval == TrafficIntervalHour {
+		return hourly, err
+	}
+
+	// 中文注释: 按天查询时，尚未汇总的按小时数据按所在天合并到按天数据中
+	var daily []*TrafficPoint
+	err = filter(db.Model(model.TrafficDaily{})).
+		Select("bucket AS time, SUM(up) AS up, SUM(down) AS down").
+		Where("bucket >= ? AND bucket <= ?", s.getBucketStart(interval, from), to).
+		Group("bucket").Order("bucket").Scan(&daily).Error
+	if err != nil {
+		return nil, err
+	}
+	loc := s.getLocation()
+	byDay := make(map[int64]*TrafficPoint, len(daily))
+	for _, point := range daily {
+		byDay[point.Time] = point
+	}
+	for _, point := range hourly {
+		day := dayStartIn(time.UnixMilli(point.Time), loc)
+		if byDay[day] == nil {
+			byDay[day] = &TrafficPoint{Time: day}
+			daily = append(daily, byDay[day])
+		}
+		byDay[day].Up += point.Up
+		byDay[day].Down += point.Down
+	}
+	sort.Slice(daily, func(i, j int) bool {
+		return daily[i].Time < daily[j].Time
+	})
+	return daily, nil
+}
+
+// GetUsage 中文注释: 返回 [from, to) 内指定类型每个对象的用量(按 name)，合并按天数据和尚未汇总的按小时数据，
+// from 对齐到所在天的起点，因此精度为天(面板时区)。
+func (s *TrafficHistoryService) GetUsage(kind string, from int64, to int64) (map[string]*TrafficPoint, error) {
+	type usage struct {
+		Name string
+		Up   int64
+		Down int64
+	}
+	from = s.getBucketStart(TrafficIntervalDay, from)
+	db := database.GetDB()
+	result := make(map[string]*TrafficPoint)
+	for _, table := range []any{model.TrafficDaily{}, model.TrafficHourly{}} {
+		var usages []usage
+		err := db.Model(table).
+			Select("name, SUM(up) AS up, SUM(down) AS down").
+			Where("kind = ? AND bucket >= ? AND bucket < ?", kind, from, to).
+			Group("name").
+			Scan(&usages).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range usages {
+			if result[u.Name] == nil {
+				result[u.Name] = &TrafficPoint{}
+			}
+			result[u.Name].Up += u.Up
+			result[u.Name].Down += u.Down
+		}
+	}
+	return result, nil
+}
+
+func (s *TrafficHistoryService) getRetention() (int, int) {
+	hourlyDays, err := s.settingService.GetTrafficHourlyDays()
+	if err != nil {
+		hourlyDays = 7
+	}
+	dailyDays, err := s.settingService.GetTrafficDailyDays()
+	if err != nil {
+		dailyDays = 365
+	}
+	return hourlyDays, dailyDays
+}
+
+func (s *TrafficHistoryService) getLocation() *time.Location {
+	loc, err := s.settingService.GetTimeLocation()
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// getBuckets 中文注释: 返回时间所在小时和所在天(面板时区)的起点毫秒时间戳。
+func (s *TrafficHistoryService) getBuckets(t time.Time) (int64, int64) {
+	loc := s.getLocation()
+	t = t.In(loc)
+	hourStart := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	return hourStart.UnixMilli(), dayStartIn(t, loc)
+}
+
+// dayStartIn 中文注释: 返回时间在时区 loc 中所在天的起点毫秒时间戳
+func dayStartIn(t time.Time, loc *time.Location) int64 {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc).UnixMilli()
+}
+
+// getBucketStart 中文注释: 将查询起点对齐到所在时间段的起点，使第一个时间段完整包含在结果中。
+func (s *TrafficHistoryService) getBucketStart(interval string, from int64) int64 {
+	hourStart, dayStart := s.getBuckets(time.UnixMilli(from))
+	if interval == TrafficIntervalDay {
+		return dayStart
+	}
+	return hourStart
+}
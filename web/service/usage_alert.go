@@ -0,0 +1,315 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"text/template"
+	"time"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	UsageAlertTraffic = "traffic"
+	UsageAlertExpiry  = "expiry"
+)
+
+// UsageAlertService 中文注释: 按设置的流量百分比和到期天数阈值，通过 Telegram 向客户端绑定的用户(可选抄送管理员)发送提醒。
+// 同一计费周期内每个阈值只提醒一次：流量以上次重置时间区分周期，到期以到期时间区分。
+type UsageAlertService struct {
+	inboundService InboundService
+	settingService SettingService
+	tgbotService   Tgbot
+}
+
+// usageAlertClient 中文注释: 需要检查提醒的客户端。
+type usageAlertClient struct {
+	traffic *xray.ClientTraffic
+	tgId    int64
+}
+
+// CheckAlerts 中文注释: 检查所有启用的客户端，发送新达到阈值的提醒。
+func (s *UsageAlertService) CheckAlerts() error {
+	if !s.tgbotService.IsRunning() {
+		return nil
+	}
+	trafficSetting, err := s.settingService.GetUsageAlertTraffic()
+	if err != nil {
+		return err
+	}
+	trafficThresholds, err := common.ParseIntList(trafficSetting)
+	if err != nil {
+		return err
+	}
+	expirySetting, err := s.settingService.GetUsageAlertExpiry()
+	if err != nil {
+		return err
+	}
+	expiryThresholds, err := common.ParseIntList(expirySetting)
+	if err != nil {
+		return err
+	}
+	if len(trafficThresholds) == 0 && len(expiryThresholds) == 0 {
+		return nil
+	}
+	toAdmins, err := s.settingService.GetUsageAlertAdmins()
+	if err != nil {
+		toAdmins = false
+	}
+
+	clients, err := s.getAlertClients()
+	if err != nil {
+		return err
+	}
+	sent, err := s.getSentAlerts()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UnixMilli()
+	for _, client := range clients {
+		if client.tgId == 0 && !toAdmins {
+			continue
+		}
+		traffic := client.traffic
+		if len(trafficThresholds) > 0 && traffic.Total > 0 {
+			used := traffic.Up + traffic.Down
+			percent := int(used * 100 / traffic.Total)
+			// 中文注释: 只提醒已达到的最高阈值，跳过的较低阈值一并记为已提醒
+			threshold := 0
+			for _, t := range trafficThresholds {
+				if percent >= t {
+					threshold = t
+				}
+			}
+			if threshold > 0 && !sent[s.alertKey(traffic.Email, UsageAlertTraffic, threshold, traffic.LastReset)] {
+				msg, err := s.renderAlert(UsageAlertTraffic, map[string]string{
+					"Email":     traffic.Email,
+					"Threshold": strconv.Itoa(threshold),
+					"Percent":   strconv.Itoa(percent),
+					"Used":      common.FormatTraffic(used),
+					"Total":     common.FormatTraffic(traffic.Total),
+					"Remaining": common.FormatTraffic(max(traffic.Total-used, 0)),
+				})
+				if err != nil {
+					return err
+				}
+				s.sendAlert(client.tgId, toAdmins, msg)
+				var reached []int
+				for _, t := range trafficThresholds {
+					if t <= threshold {
+						reached = append(reached, t)
+					}
+				}
+				if err := s.recordAlerts(traffic.Email, UsageAlertTraffic, reached, traffic.LastReset); err != nil {
+					return err
+				}
+			}
+		}
+		if len(expiryThresholds) > 0 && traffic.ExpiryTime > now {
+			remaining := traffic.ExpiryTime - now
+			// 中文注释: 只提醒已进入的最小天数阈值，较大的阈值一并记为已提醒
+			threshold := 0
+			for i := len(expiryThresholds) - 1; i >= 0; i-- {
+				if remaining <= int64(expiryThresholds[i])*86400000 {
+					threshold = expiryThresholds[i]
+				}
+			}
+			if threshold > 0 && !sent[s.alertKey(traffic.Email, UsageAlertExpiry, threshold, traffic.ExpiryTime)] {
+				loc, err := s.settingService.GetTimeLocation()
+				if err != nil {
+					loc = time.Local
+				}
+				msg, err := s.renderAlert(UsageAlertExpiry, map[string]string{
+					"Email":      traffic.Email,
+					"Threshold":  strconv.Itoa(threshold),
+					"Days":       strconv.FormatInt((remaining+86400000-1)/86400000, 10),
+					"ExpiryTime": time.UnixMilli(traffic.ExpiryTime).In(loc).Format("2006-01-02 15:04:05"),
+				})
+				if err != nil {
+					return err
+				}
+				s.sendAlert(client.tgId, toAdmins, msg)
+				var reached []int
+				for _, t := range expiryThresholds {
+					if t >= threshold {
+						reached = append(reached, t)
+					}
+				}
+				if err := s.recordAlerts(traffic.Email, UsageAlertExpiry, reached, traffic.ExpiryTime); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// getAlertClients 中文注释: 返回启用的入站中启用且未被禁用的客户端及其绑定的 Telegram ID。
+func (s *UsageAlertService) getAlertClients() ([]*usageAlertClient, error) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	var result []*usageAlertClient
+	for _, inbound := range inbounds {
+		if !inbound.Enable {
+			continue
+		}
+		clients, err := s.inboundService.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		tgIds := make(map[string]int64, len(clients))
+		for _, client := range clients {
+			if client.Enable {
+				tgIds[client.Email] = client.TgID
+			}
+		}
+		for i := range inbound.ClientStats {
+			traffic := &inbound.ClientStats[i]
+			tgId, ok := tgIds[traffic.Email]
+			if !ok || !traffic.Enable {
+				continue
+			}
+			result = append(result, &usageAlertClient{traffic: traffic, tgId: tgId})
+		}
+	}
+	return result, nil
+}
+
+func (s *UsageAlertService) alertKey(email string, kind string, threshold int, period int64) string {
+	return fmt.Sprintf("%s|%s|%d|%d", email, kind, threshold, period)
+}
+
+func (s *UsageAlertService) getSentAlerts() (map[string]bool, error) {
+	var alerts []*model.UsageAlert
+	db := database.GetDB()
+	if err := db.Model(model.UsageAlert{}).Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+	sent := make(map[string]bool, len(alerts))
+	for _, alert := range alerts {
+		sent[s.alertKey(alert.Email, alert.Kind, alert.Threshold, alert.Period)] = true
+	}
+	return sent, nil
+}
+
+// recordAlerts 中文注释: 记录已提醒的阈值，并删除该客户端以前周期的记录。
+func (s *UsageAlertService) recordAlerts(email string, kind string, thresholds []int, period int64) error {
+	now := time.Now().UnixMilli()
+	alerts := make([]model.UsageAlert, 0, len(thresholds))
+	for _, threshold := range thresholds {
+		alerts = append(alerts, model.UsageAlert{Email: email, Kind: kind, Threshold: threshold, Period: period, SentAt: now})
+	}
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("email = ? AND kind = ? AND period <> ?", email, kind, period).Delete(model.UsageAlert{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&alerts).Error
+	})
+}
+
+// CleanupAlerts 中文注释: 删除已不存在的客户端的提醒记录。
+func (s *UsageAlertService) CleanupAlerts() error {
+	db := database.GetDB()
+	return db.Where("email NOT IN (?)", db.Model(xray.ClientTraffic{}).Select("email")).
+		Delete(model.UsageAlert{}).Error
+}
+
+func (s *UsageAlertService) sendAlert(tgId int64, toAdmins bool, msg string) {
+	if tgId != 0 {
+		s.tgbotService.SendMsgToTgbot(tgId, msg)
+	}
+	if toAdmins {
+		s.tgbotService.SendMsgToTgbotAdmins(msg)
+	}
+}
+
+// renderAlert 中文注释: 使用当前机器人语言的自定义模板渲染提醒，没有自定义模板时使用内置翻译。
+func (s *UsageAlertService) renderAlert(kind string, data map[string]string) (string, error) {
+	lang, err := s.settingService.GetTgLang()
+	if err != nil {
+		return "", err
+	}
+	tpl := &model.UsageAlertTemplate{}
+	db := database.GetDB()
+	err = db.Model(model.UsageAlertTemplate{}).Where("lang = ? AND kind = ?", lang, kind).First(tpl).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return "", err
+	}
+	if err == nil && tpl.Content != "" {
+		msg, err := executeAlertTemplate(tpl.Content, data)
+		if err == nil {
+			return msg, nil
+		}
+		logger.Warning("Invalid usage alert template:", err)
+	}
+
+	params := make([]string, 0, len(data))
+	for key, value := range data {
+		params = append(params, key+"=="+value)
+	}
+	if kind == UsageAlertExpiry {
+		return s.tgbotService.I18nBot("tgbot.messages.usageAlertExpiry", params...), nil
+	}
+	return s.tgbotService.I18nBot("tgbot.messages.usageAlertTraffic", params...), nil
+}
+
+func executeAlertTemplate(content string, data map[string]string) (string, error) {
+	parsed, err := template.New("alert").Option("missingkey=zero").Parse(content)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := parsed.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (s *UsageAlertService) GetTemplates() ([]*model.UsageAlertTemplate, error) {
+	db := database.GetDB()
+	var templates []*model.UsageAlertTemplate
+	err := db.Model(model.UsageAlertTemplate{}).Order("lang, kind").Find(&templates).Error
+	if err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// SaveTemplate 中文注释: 新增或更新指定语言和类型的模板。
+func (s *UsageAlertService) SaveTemplate(tpl *model.UsageAlertTemplate) error {
+	if tpl.Lang == "" {
+		return common.NewError("usage alert template language is empty")
+	}
+	if tpl.Kind != UsageAlertTraffic && tpl.Kind != UsageAlertExpiry {
+		return common.NewError("invalid usage alert kind:", tpl.Kind)
+	}
+	if tpl.Content == "" {
+		return common.NewError("usage alert template is empty")
+	}
+	if _, err := executeAlertTemplate(tpl.Content, map[string]string{}); err != nil {
+		return common.NewError("invalid usage alert template:", err)
+	}
+	db := database.GetDB()
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "lang"}, {Name: "kind"}},
+		DoUpdates: clause.AssignmentColumns([]string{"content"}),
+	}).Create(&model.UsageAlertTemplate{Lang: tpl.Lang, Kind: tpl.Kind, Content: tpl.Content}).Error
+}
+
+func (s *UsageAlertService) DelTemplate(id int) error {
+	db := database.GetDB()
+	return db.Delete(model.UsageAlertTemplate{}, id).Error
+}
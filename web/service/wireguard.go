@@ -0,0 +1,374 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/util/crypto"
+	"x-ui/util/random"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+// 中文注释: WireGuard 入站的对端在面板中作为普通客户端保存在 settings.clients 中，
+// 与其他协议共用邮箱、订阅ID、流量统计和到期逻辑；生成 Xray 配置时再转换为 peers。
+
+const (
+	defaultWireguardSubnet    = "10.0.0.0/24"
+	defaultWireguardClientDns = "1.1.1.1, 1.0.0.1"
+)
+
+// fillWireguardClients 中文注释: 为缺少密钥或地址的 WireGuard 客户端生成密钥对，并从入站子网中分配地址。
+func (s *InboundService) fillWireguardClients(inbound *model.Inbound) error {
+	if inbound.Protocol != model.WireGuard {
+		return nil
+	}
+	var settings map[string]any
+	if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+		return err
+	}
+	clients, ok := settings["clients"].([]any)
+	if !ok {
+		return nil
+	}
+
+	subnet, serverIp := wireguardSubnet(settings)
+	used := map[string]bool{
+		subnet.IP.String(): true,
+		serverIp.String():  true,
+	}
+	for _, clientRaw := range clients {
+		c, _ := clientRaw.(map[string]any)
+		for _, ip := range wireguardClientIps(c) {
+			used[ip] = true
+		}
+	}
+
+	for i, clientRaw := range clients {
+		c, ok := clientRaw.(map[string]any)
+		if !ok {
+			continue
+		}
+		privateKey, _ := c["privateKey"].(string)
+		publicKey, _ := c["publicKey"].(string)
+		switch {
+		case privateKey == "" && publicKey == "":
+			newPrivate, newPublic, err := crypto.GenerateWireguardKeyPair()
+			if err != nil {
+				return err
+			}
+			c["privateKey"] = newPrivate
+			c["publicKey"] = newPublic
+		case privateKey != "" && publicKey == "":
+			newPublic, err := crypto.GetWireguardPublicKey(privateKey)
+			if err != nil {
+				return common.NewError("invalid wireguard private key:", err)
+			}
+			c["publicKey"] = newPublic
+		}
+
+		if len(wireguardClientIps(c)) == 0 {
+			ip, err := allocateWireguardIp(subnet, used)
+			if err != nil {
+				return err
+			}
+			used[ip] = true
+			c["allowedIPs"] = []any{ip + "/32"}
+		}
+		clients[i] = c
+	}
+
+	settings["clients"] = clients
+	newSettings, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	inbound.Settings = string(newSettings)
+	return nil
+}
+
+// wireguardSubnet 中文注释: 入站子网取自 settings.address 的第一个 IPv4 地址(支持 CIDR，裸 IP 按 /24 处理)，
+// 未设置时使用 10.0.0.0/24。返回子网和服务端自身地址。
+func wireguardSubnet(settings map[string]any) (*net.IPNet, net.IP) {
+	if addresses, ok := settings["address"].([]any); ok {
+		for _, addressRaw := range addresses {
+			address, _ := addressRaw.(string)
+			if ip, subnet, err := net.ParseCIDR(address); err == nil && ip.To4() != nil {
+				return subnet, ip.To4()
+			}
+			if ip := net.ParseIP(address); ip != nil && ip.To4() != nil {
+				mask := net.CIDRMask(24, 32)
+				return &net.IPNet{IP: ip.To4().Mask(mask), Mask: mask}, ip.To4()
+			}
+		}
+	}
+	_, subnet, _ := net.ParseCIDR(defaultWireguardSubnet)
+	serverIp := make(net.IP, len(subnet.IP))
+	copy(serverIp, subnet.IP)
+	serverIp[len(serverIp)-1]++
+	return subnet, serverIp
+}
+
+func wireguardClientIps(c map[string]any) []string {
+	var result []string
+	allowedIPs, _ := c["allowedIPs"].([]any)
+	for _, allowedIp := range allowedIPs {
+		value, _ := allowedIp.(string)
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if ip, _, err := net.ParseCIDR(value); err == nil {
+			result = append(result, ip.String())
+		} else if ip := net.ParseIP(value); ip != nil {
+			result = append(result, ip.String())
+		}
+	}
+	return result
+}
+
+func allocateWireguardIp(subnet *net.IPNet, used map[string]bool) (string, error) {
+	ip := subnet.IP.To4()
+	if ip == nil {
+		return "", common.NewError("wireguard subnet must be IPv4:", subnet.String())
+	}
+	ones, bits := subnet.Mask.Size()
+	size := uint32(1) << uint(bits-ones)
+	base := uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+	// 中文注释: 跳过网络地址和广播地址
+	for offset := uint32(1); offset+1 < size; offset++ {
+		n := base + offset
+		candidate := net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n)).String()
+		if !used[candidate] {
+			return candidate, nil
+		}
+	}
+	return "", common.NewError("no free address left in wireguard subnet:", subnet.String())
+}
+
+// wireguardSharedInbounds 中文注释: 已提示过无法按对端统计流量的入站，避免每个统计周期重复告警
+var wireguardSharedInbounds struct {
+	sync.Mutex
+	warned map[string]bool
+}
+
+// getWireguardClientTraffics 中文注释: Xray 的 WireGuard 入站不区分对端统计流量，只能拿到入站总流量。
+// 只有入站恰好一个启用的对端时流量才能准确计入该对端；有多个对端时只统计到入站并记录一次告警，
+// 这类入站不支持对端的流量配额(见 checkWireguardQuotas)。
+func (s *InboundService) getWireguardClientTraffics(tx *gorm.DB, traffics []*xray.Traffic) ([]*xray.ClientTraffic, error) {
+	trafficByTag := make(map[string]*xray.Traffic)
+	for _, traffic := range traffics {
+		if traffic.IsInbound && traffic.Up+traffic.Down > 0 {
+			trafficByTag[traffic.Tag] = traffic
+		}
+	}
+	if len(trafficByTag) == 0 {
+		return nil, nil
+	}
+	var inbounds []*model.Inbound
+	err := tx.Model(model.Inbound{}).Where("protocol = ?", model.WireGuard).Find(&inbounds).Error
+	if err != nil || len(inbounds) == 0 {
+		return nil, err
+	}
+
+	wireguardSharedInbounds.Lock()
+	defer wireguardSharedInbounds.Unlock()
+	if wireguardSharedInbounds.warned == nil {
+		wireguardSharedInbounds.warned = make(map[string]bool)
+	}
+
+	var result []*xray.ClientTraffic
+	for _, inbound := range inbounds {
+		traffic, ok := trafficByTag[inbound.Tag]
+		if !ok {
+			continue
+		}
+		clients, err := s.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		var emails []string
+		for _, client := range clients {
+			if client.Enable && client.Email != "" && client.PublicKey != "" {
+				emails = append(emails, client.Email)
+			}
+		}
+		if len(emails) != 1 {
+			if len(emails) > 1 && !wireguardSharedInbounds.warned[inbound.Tag] {
+				logger.Warningf("WireGuard inbound %s has %d enabled peers, Xray cannot count traffic per peer so it is only counted for the inbound", inbound.Tag, len(emails))
+				wireguardSharedInbounds.warned[inbound.Tag] = true
+			}
+			continue
+		}
+		delete(wireguardSharedInbounds.warned, inbound.Tag)
+		result = append(result, &xray.ClientTraffic{Email: emails[0], Up: traffic.Up, Down: traffic.Down})
+	}
+	return result, nil
+}
+
+// checkWireguardQuotas 中文注释: 有多个对端的 WireGuard 入站无法按对端统计流量，拒绝为其中的对端设置流量配额
+func (s *InboundService) checkWireguardQuotas(inbound *model.Inbound) error {
+	if inbound.Protocol != model.WireGuard {
+		return nil
+	}
+	clients, err := s.GetClients(inbound)
+	if err != nil || len(clients) < 2 {
+		return err
+	}
+	for _, client := range clients {
+		if client.TotalGB > 0 {
+			return common.NewError("per-peer traffic quota is only supported on WireGuard inbounds with a single peer:", client.Email)
+		}
+	}
+	return nil
+}
+
+// GetWireguardConfig 中文注释: 生成客户端可直接导入的 WireGuard .conf 配置。
+// host 为入站未指定监听地址时使用的服务器地址。
+func (s *InboundService) GetWireguardConfig(email string, host string) (string, error) {
+	_, inbound, err := s.GetClientInboundByEmail(email)
+	if err != nil {
+		return "", err
+	}
+	if inbound == nil || inbound.Protocol != model.WireGuard {
+		return "", common.NewError("client is not a wireguard peer:", email)
+	}
+	clients, err := s.GetClients(inbound)
+	if err != nil {
+		return "", err
+	}
+	var client *model.Client
+	for i := range clients {
+		if clients[i].Email == email {
+			client = &clients[i]
+			break
+		}
+	}
+	if client == nil {
+		return "", common.NewError("client not found:", email)
+	}
+
+	var settings map[string]any
+	if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+		return "", err
+	}
+	secretKey, _ := settings["secretKey"].(string)
+	serverPublicKey, err := crypto.GetWireguardPublicKey(secretKey)
+	if err != nil {
+		return "", common.NewError("invalid wireguard secret key:", err)
+	}
+
+	address := host
+	if inbound.Listen != "" && inbound.Listen != "0.0.0.0" && inbound.Listen != "::" && inbound.Listen != "::0" {
+		address = inbound.Listen
+	}
+
+	var conf strings.Builder
+	conf.WriteString("[Interface]\n")
+	conf.WriteString(fmt.Sprintf("PrivateKey = %s\n", client.PrivateKey))
+	conf.WriteString(fmt.Sprintf("Address = %s\n", strings.Join(client.AllowedIPs, ", ")))
+	if dns := wireguardClientDns(settings); dns != "" {
+		conf.WriteString(fmt.Sprintf("DNS = %s\n", dns))
+	}
+	if mtu, ok := settings["mtu"].(float64); ok && mtu > 0 {
+		conf.WriteString(fmt.Sprintf("MTU = %d\n", int(mtu)))
+	}
+	conf.WriteString(fmt.Sprintf("\n# %s\n", email))
+	conf.WriteString("[Peer]\n")
+	conf.WriteString(fmt.Sprintf("PublicKey = %s\n", serverPublicKey))
+	conf.WriteString("AllowedIPs = 0.0.0.0/0, ::/0\n")
+	conf.WriteString(fmt.Sprintf("Endpoint = %s\n", net.JoinHostPort(address, fmt.Sprint(inbound.Port))))
+	if client.PreSharedKey != "" {
+		conf.WriteString(fmt.Sprintf("PresharedKey = %s\n", client.PreSharedKey))
+	}
+	if client.KeepAlive > 0 {
+		conf.WriteString(fmt.Sprintf("PersistentKeepalive = %d\n", client.KeepAlive))
+	}
+	return conf.String(), nil
+}
+
+// wireguardClientDns 中文注释: 写入客户端配置的 DNS 取自入站的 clientDns，未设置时使用默认值，设置为空则不写入
+func wireguardClientDns(settings map[string]any) string {
+	dns, ok := settings["clientDns"].(string)
+	if !ok {
+		return defaultWireguardClientDns
+	}
+	return strings.TrimSpace(dns)
+}
+
+// migrateWireguardPeers 中文注释: 将旧版 WireGuard 入站的 settings.peers 转换为面板管理的 clients，
+// 为每个对端生成邮箱和订阅ID，并补齐流量统计记录。生成的 "入站tag-peer序号" 与已有客户端重名时追加序号，并记录警告。
+func (s *InboundService) migrateWireguardPeers(tx *gorm.DB) error {
+	var inbounds []*model.Inbound
+	err := tx.Model(model.Inbound{}).Where("protocol = ?", model.WireGuard).Find(&inbounds).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+	used, err := s.migrationUsedEmails(tx)
+	if err != nil {
+		return err
+	}
+	for _, inbound := range inbounds {
+		settings := map[string]any{}
+		if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+			continue
+		}
+		if _, ok := settings["clients"]; ok {
+			continue
+		}
+		peers, _ := settings["peers"].([]any)
+		now := time.Now().UnixMilli()
+		clients := make([]any, 0, len(peers))
+		for index, peerRaw := range peers {
+			peer, ok := peerRaw.(map[string]any)
+			if !ok {
+				continue
+			}
+			name := fmt.Sprintf("%s-peer%d", inbound.Tag, index+1)
+			email := uniqueMigrationEmail(used, name, name)
+			if email != name {
+				logger.Warningf("WireGuard peer %d of inbound %s named %s: %s is already used by another client", index+1, inbound.Tag, email, name)
+			}
+			peer["email"] = email
+			peer["enable"] = true
+			peer["subId"] = random.Seq(16)
+			peer["created_at"] = now
+			peer["updated_at"] = now
+			clients = append(clients, peer)
+		}
+		delete(settings, "peers")
+		settings["clients"] = clients
+		newSettings, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return err
+		}
+		inbound.Settings = string(newSettings)
+		if err := s.fillWireguardClients(inbound); err != nil {
+			return err
+		}
+		if err := tx.Model(model.Inbound{}).Where("id = ?", inbound.Id).Update("settings", inbound.Settings).Error; err != nil {
+			return err
+		}
+
+		modelClients, err := s.GetClients(inbound)
+		if err != nil {
+			return err
+		}
+		for _, modelClient := range modelClients {
+			var count int64
+			tx.Model(xray.ClientTraffic{}).Where("email = ?", modelClient.Email).Count(&count)
+			if count == 0 {
+				s.AddClientStat(tx, inbound.Id, &modelClient)
+			}
+		}
+	}
+	return nil
+}
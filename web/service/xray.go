@@ -6,6 +6,7 @@ import (
 	"sync"
     "strconv"
 
+	"x-ui/database/model"
 	"x-ui/logger"
 	"x-ui/xray"
 	json_util "x-ui/util/json_util"
@@ -83,6 +84,22 @@ func (s *XrayService) IsXrayApiAvailable() bool {
 	return err == nil
 }
 
+// IsOnlineIpsSupported 中文注释: Xray 是否支持在线IP统计，支持时设备限制和 IP 限制无需解析 access.log
+func (s *XrayService) IsOnlineIpsSupported() bool {
+	apiPort := s.GetApiPort()
+	if apiPort <= 0 {
+		return false
+	}
+	tempAPI := &xray.XrayAPI{}
+	if err := tempAPI.Init(apiPort); err != nil {
+		return false
+	}
+	defer tempAPI.Close()
+
+	_, err := tempAPI.GetOnlineIps("")
+	return err == nil
+}
+
 // 中文注释:
 // 新增 GetApiPort 函数。
 // 这个函数的作用是安全地返回当前 Xray 进程正在监听的 API 端口号。
@@ -141,28 +158,55 @@ func RemoveIndex(s []any, index int) []any {
 	return append(s[:index], s[index+1:]...)
 }
 
-func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
+// ensureApiService 中文注释: 确保 api.services 中包含 service，模板没有配置 api 时原样返回。
+func ensureApiService(api json_util.RawMessage, service string) json_util.RawMessage {
+	if len(api) == 0 {
+		return api
+	}
+	apiConfig := map[string]any{}
+	if err := json.Unmarshal(api, &apiConfig); err != nil {
+		return api
+	}
+	services, _ := apiConfig["services"].([]any)
+	for _, s := range services {
+		if s == service {
+			return api
+		}
+	}
+	apiConfig["services"] = append(services, service)
+	result, err := json.Marshal(apiConfig)
+	if err != nil {
+		return api
+	}
+	return result
+}
+
+// GetXrayConfig 中文注释: 生成 Xray 配置，同时返回配置中限速到 level 的映射。生成配置没有副作用，
+// 调用方在配置启动或热更新后再用 setSpeedLevels 记录映射。
+func (s *XrayService) GetXrayConfig() (*xray.Config, SpeedLevels, error) {
 	templateConfig, err := s.settingService.GetXrayConfigTemplate()
 	if err != nil {
-		return nil, err
+		return nil, SpeedLevels{}, err
 	}
 
 	xrayConfig := &xray.Config{}
 	if err := json.Unmarshal([]byte(templateConfig), xrayConfig); err != nil {
-		return nil, err
+		return nil, SpeedLevels{}, err
 	}
+	// 中文注释: 设备限制的 kickOldest 策略通过 RoutingService 阻断旧设备，模板中未启用时自动加上
+	xrayConfig.API = ensureApiService(xrayConfig.API, "RoutingService")
 
 
 	inbounds, err := s.inboundService.GetAllInbounds()
 	if err != nil {
-		return nil, err
+		return nil, SpeedLevels{}, err
 	}
 
 	// =================================================================
 	// 中文注释: 动态限速核心逻辑 - 第一步: 收集所有限速值 
 	// =================================================================
-    // 创建一个 map 用于存储所有出现过的、不为0的限速值
-	uniqueSpeeds := make(map[int]bool)
+    // 创建一个 map 用于存储所有出现过的上下行限速组合（已合并入站的默认限速，并包含各限速时段的限速）
+	uniqueLimits := make(map[SpeedLimit]bool)
 	for _, inbound := range inbounds {
 		if !inbound.Enable {
 			continue
@@ -170,12 +214,23 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 		
         // 获取该入站下的所有客户端设置
 		dbClients, _ := s.inboundService.GetClients(inbound)
-		for _, dbClient := range dbClients {
-			if dbClient.SpeedLimit > 0 {
-				uniqueSpeeds[dbClient.SpeedLimit] = true
+		for i := range dbClients {
+			for _, limit := range possibleSpeedLimits(inbound, &dbClients[i]) {
+				if !limit.IsZero() {
+					uniqueLimits[limit] = true
+				}
 			}
 		}
 	}
+	// 中文注释: 再为限速档位的全部组合预先建立 level，之后修改客户端限速时只需通过 API 重新添加该用户，不必重启 Xray
+	speedPresets, err := s.settingService.GetSpeedLevelPresets()
+	if err != nil {
+		logger.Warning("Unable to parse speed level presets:", err)
+		speedPresets = nil
+	}
+	for _, limit := range presetSpeedLimits(speedPresets) {
+		uniqueLimits[limit] = true
+	}
 
 	// =================================================================
 	// 中文注释: 动态限速核心逻辑 - 第二步: 根据收集到的限速值，动态生成 Policy Levels
@@ -226,13 +281,14 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 	// 〔中文注释〕: 将完整配置好的 level 0 写回 policyLevels，确保最终生成的 config.json 是正确的。
 	policyLevels["0"] = level0
 
-	// 4. 遍历所有收集到的限速值，为每个独立的限速值创建对应的 level
-	for speed := range uniqueSpeeds {
-		// 为每个速率创建一个 level，level 的名字就是速率的字符串形式
-		// 例如，速率 1024 KB/s 对应 level "1024"
-		policyLevels[strconv.Itoa(speed)] = map[string]interface{}{
-			"downlinkOnly": speed,
-			"uplinkOnly":   speed,
+	// 4. 遍历所有收集到的限速组合，为每个组合创建对应的 level
+	// 上下行相同时 level 的名字就是速率，例如 1024 KB/s 对应 level "1024"；
+	// 上下行不同时由 buildSpeedLevels 在已占用的 level 之后分配，避免冲突
+	speedLevelMap := buildSpeedLevels(uniqueLimits, policyLevels)
+	for limit, level := range speedLevelMap {
+		policyLevels[strconv.Itoa(level)] = map[string]interface{}{
+			"downlinkOnly": limit.Down,
+			"uplinkOnly":   limit.Up,
 			"handshake":         4,
 			"connIdle":          300,
 			"statsUserUplink":   true,
@@ -245,16 +301,18 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 	finalPolicy["levels"] = policyLevels
 	policyJSON, err := json.Marshal(finalPolicy)
 	if err != nil {
-		return nil, err
+		return nil, SpeedLevels{}, err
 	}
 	xrayConfig.Policy = json_util.RawMessage(policyJSON)
 
 	// =================================================================
     // 中文注释: 在这里增加日志，打印最终生成的限速策略
     // =================================================================
-	if len(uniqueSpeeds) > 0 {
+	if len(uniqueLimits) > 0 {
 		finalPolicyLog, _ := json.Marshal(policyLevels)
-		logger.Infof("已为Xray动态生成〔限速策略〕: %s", string(finalPolicyLog))
+		// 中文注释: 限速档位会生成较多 level，完整策略只在调试日志中输出
+		logger.Infof("已为Xray动态生成〔限速策略〕: %d 个 level", len(speedLevelMap))
+		logger.Debugf("〔限速策略〕: %s", string(finalPolicyLog))
 	}
 
 	// =================================================================
@@ -262,6 +320,14 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 	// =================================================================
     // 触发一次空调用以处理可能的残留任务	
     s.inboundService.AddTraffic(nil, nil) 
+
+	// 中文注释: 被设备限制封禁的客户端不写入配置，使封禁在重启后依然有效，解封时再通过 API 添加
+	deviceLimitService := DeviceLimitService{}
+	bannedEmails, err := deviceLimitService.GetBannedEmails()
+	if err != nil {
+		logger.Warning("Unable to load device bans:", err)
+	}
+	speedNow := s.inboundService.speedNow()
 	
 	for _, inbound := range inbounds {
 		if !inbound.Enable {
@@ -271,17 +337,18 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 		// 先生成一个 inboundConfig（后面会覆盖 Settings/StreamSettings）
 		inboundConfig := inbound.GenXrayInboundConfig()
 
-		// 从 DB clients 建立 email/id -> speedLimit 映射（优先使用 DB 的值）
-		speedByEmail := make(map[string]int)
-		speedById := make(map[string]int)
+		// 从 DB clients 建立 email/id -> 当前实际限速映射（已合并入站的默认限速和限速时段）
+		speedByEmail := make(map[string]SpeedLimit)
+		speedById := make(map[string]SpeedLimit)
 		dbClients, _ := s.inboundService.GetClients(inbound)
-		for _, dbc := range dbClients {
-			if dbc.Email != "" {
-				speedByEmail[dbc.Email] = dbc.SpeedLimit
+		for i := range dbClients {
+			limit := ResolveClientSpeedLimit(inbound, &dbClients[i], speedNow)
+			if dbClients[i].Email != "" {
+				speedByEmail[dbClients[i].Email] = limit
 			}
 			// 如果有 id 字段也建立映射（以防 email 不存在）
-			if dbc.ID != "" {
-				speedById[dbc.ID] = dbc.SpeedLimit
+			if dbClients[i].ID != "" {
+				speedById[dbClients[i].ID] = limit
 			}
 		}
 
@@ -329,6 +396,16 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 					logger.Infof("已从Xray配置中移除被禁用的用户: %s", email)
 					continue
 				}
+				if bannedEmails[email] {
+					logger.Infof("已从Xray配置中移除因设备数超限被封禁的用户: %s", email)
+					continue
+				}
+
+				// 中文注释: WireGuard/SOCKS/HTTP 客户端保留完整字段，稍后统一转换为 peers 或 accounts
+				if inbound.Protocol == model.WireGuard || inbound.Protocol == model.Socks || inbound.Protocol == model.HTTP {
+					xrayClients = append(xrayClients, c)
+					continue
+				}
 
 				// -----------------------------------------------------------------
 				// 中文注释: 构建干净的 xrayClient（只保留白名单字段）
@@ -351,7 +428,7 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 				// ⚠️ security 字段已移除，不再加入到 xrayClient
 
 				// -----------------------------------------------------------------
-				// 中文注释: 限速等级映射（优先 DB，再回退 settings.speedLimit）
+				// 中文注释: 限速等级映射（优先 DB，再回退入站的默认限速）
 				// -----------------------------------------------------------------
 
 				// =================================================================
@@ -359,38 +436,19 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 				// 我们需要将 speedLimit 转换为 Xray 认识的 level 字段。
 				// 这样可以确保包含 speedLimit 的完整用户信息被用于生成配置。
 				// =================================================================
-				level := 0
-				if email != "" {
-					if v, ok := speedByEmail[email]; ok && v > 0 {
-						level = v
-					}
+				limit, found := speedByEmail[email]
+				if !found && idStr != "" {
+					limit, found = speedById[idStr]
 				}
-				if level == 0 && idStr != "" {
-					if v, ok := speedById[idStr]; ok && v > 0 {
-						level = v
-					}
-				}
-				if level == 0 {
-					if sl, ok := c["speedLimit"]; ok {
-						switch vv := sl.(type) {
-						case float64:
-							level = int(vv)
-						case int:
-							level = vv
-						case int64:
-							level = int(vv)
-						case string:
-							if n, err := strconv.Atoi(vv); err == nil {
-								level = n
-							}
-						}
-					}
+				if !found {
+					limit = ResolveSpeedLimit(inbound, &model.Client{})
 				}
+				level := speedLevelMap[limit]
 
 				// 【新增功能】在这里添加日志记录
 				// 只有当最终计算出的 level 大于 0，且 email 存在时，才记录日志
 				if level > 0 && email != "" {
-					logger.Infof("为用户 %s 应用〔独立限速〕: %d KB/s", email, level)
+					logger.Infof("为用户 %s 应用〔独立限速〕: 上行 %d KB/s, 下行 %d KB/s (level %d)", email, limit.Up, limit.Down, level)
 				}
 				// =================================================================
 
@@ -406,6 +464,7 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 				logger.Warningf("无法序列化用于Xray的入站设置 in GetXrayConfig for inbound %d: %v，跳过该入站", inbound.Id, err)
 				continue
 			}
+			finalSettingsForXray = []byte(model.GenProtocolSettings(inbound.Protocol, string(finalSettingsForXray)))
 			inboundConfig.Settings = json_util.RawMessage(finalSettingsForXray)
 		}
 
@@ -429,7 +488,7 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 
 			newStream, err := json.Marshal(stream)
 			if err != nil {
-				return nil, err
+				return nil, SpeedLevels{}, err
 			}
 			inboundConfig.StreamSettings = json_util.RawMessage(newStream)
 		}
@@ -437,7 +496,7 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 		xrayConfig.InboundConfigs = append(xrayConfig.InboundConfigs, *inboundConfig)
 	}
 
-	return xrayConfig, nil
+	return xrayConfig, SpeedLevels{Levels: speedLevelMap, Presets: speedPresets}, nil
 }
 
 
@@ -472,7 +531,7 @@ func (s *XrayService) RestartXray(isForce bool) error {
 	logger.Debug("restart Xray, force:", isForce)
 	isManuallyStopped.Store(false)
 
-	xrayConfig, err := s.GetXrayConfig()
+	xrayConfig, levels, err := s.GetXrayConfig()
 	if err != nil {
 		return err
 	}
@@ -486,11 +545,18 @@ func (s *XrayService) RestartXray(isForce bool) error {
     }
 
 
+	reason := "xray not running"
 	if s.IsXrayRunning() {
-		// 检查是否需要重启: 如果有进程对象且配置未变,则跳过
-		if !isForce && p != nil && p.GetConfig().Equals(xrayConfig) && !isNeedXrayRestart.Load() {
-			logger.Debug("It does not need to restart Xray")
-			return nil
+		// 检查是否需要重启: 配置未变化时跳过；只有入站和用户变化时通过 API 增量应用，
+		// 只有 routing、dns、policy 等无法热更新的部分变化或热更新失败时才重启
+		reason = "forced"
+		if !isForce && !isNeedXrayRestart.Load() {
+			var applied bool
+			if applied, reason = s.tryHotApply(xrayConfig); applied {
+				setSpeedLevels(levels)
+				setAppliedSpeeds(appliedSpeedsFromConfig(xrayConfig, levels.Levels))
+				return nil
+			}
 		}
 		// 如果有进程对象,使用进程对象停止;否则使用 pkill
 		if p != nil {
@@ -506,6 +572,10 @@ func (s *XrayService) RestartXray(isForce bool) error {
 	if err != nil {
 		return err
 	}
+	// 中文注释: 进程已使用新配置启动，记录其中的限速 level 和各用户的限速，限速时段切换时据此判断是否需要通过 API 重新添加用户
+	setSpeedLevels(levels)
+	setAppliedSpeeds(appliedSpeedsFromConfig(xrayConfig, levels.Levels))
+	setApplyResult(XrayApplyRestart, reason, "")
 
 	return nil
 }
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"x-ui/logger"
+	"x-ui/xray"
+)
+
+// 中文注释: 应用 Xray 配置的方式
+const (
+	XrayApplyUnchanged = "unchanged" // 配置未变化
+	XrayApplyHot       = "hot"       // 通过 handler API 增量应用，不中断其他用户的连接
+	XrayApplyRestart   = "restart"   // 重启 Xray 进程
+)
+
+// XrayApplyResult 中文注释: 最近一次应用 Xray 配置的结果，Reason 说明为什么重启，Summary 为热更新的变化摘要
+type XrayApplyResult struct {
+	Path    string `json:"path"`
+	Reason  string `json:"reason"`
+	Summary string `json:"summary"`
+	Time    int64  `json:"time"`
+}
+
+var (
+	lastApplyResult XrayApplyResult
+	lastApplyLock   sync.RWMutex
+)
+
+// setApplyResult 中文注释: 记录并输出本次应用配置的方式
+func setApplyResult(path string, reason string, summary string) {
+	lastApplyLock.Lock()
+	lastApplyResult = XrayApplyResult{Path: path, Reason: reason, Summary: summary, Time: time.Now().UnixMilli()}
+	lastApplyLock.Unlock()
+	switch path {
+	case XrayApplyUnchanged:
+		logger.Debug("Xray config unchanged")
+	case XrayApplyHot:
+		logger.Infof("Xray 配置已通过 API 热更新: %s", summary)
+	default:
+		logger.Infof("Xray 已重启: %s", reason)
+	}
+}
+
+// GetLastApplyResult 中文注释: 返回最近一次应用 Xray 配置的方式
+func (s *XrayService) GetLastApplyResult() XrayApplyResult {
+	lastApplyLock.RLock()
+	defer lastApplyLock.RUnlock()
+	return lastApplyResult
+}
+
+// runningConfig 中文注释: 返回运行中的 Xray 使用的配置，接管的外部进程(proc 为 nil)从配置文件读取
+func (s *XrayService) runningConfig(proc *xray.Process) *xray.Config {
+	if proc != nil {
+		return proc.GetConfig()
+	}
+	xrayConfig, err := xray.ReadConfig()
+	if err != nil {
+		logger.Debug("Unable to read running Xray config:", err)
+		return nil
+	}
+	return xrayConfig
+}
+
+// saveRunningConfig 中文注释: 热更新成功后记录新的运行配置
+func (s *XrayService) saveRunningConfig(proc *xray.Process, xrayConfig *xray.Config) error {
+	if proc != nil {
+		return proc.UpdateConfig(xrayConfig)
+	}
+	return xray.WriteConfig(xrayConfig)
+}
+
+// tryHotApply 中文注释: 比较运行中的配置和新配置，能通过 API 应用时增量应用。
+// 返回 true 表示已处理(未变化或热更新成功)；返回 false 时 reason 说明需要重启的原因。
+func (s *XrayService) tryHotApply(xrayConfig *xray.Config) (bool, string) {
+	// 中文注释: 记录比较时的进程，应用后确认仍是同一个运行中的进程才保存配置，
+	// 否则新进程的配置会被替换为按旧进程计算的结果
+	proc := p
+	running := s.runningConfig(proc)
+	if running == nil {
+		return false, "running config unknown"
+	}
+	diff := xray.DiffConfig(running, xrayConfig)
+	if diff.IsEmpty() {
+		setApplyResult(XrayApplyUnchanged, "", "")
+		return true, ""
+	}
+	if diff.NeedRestart() {
+		return false, diff.String()
+	}
+	if err := s.applyConfigDiff(diff); err != nil {
+		logger.Warning("Hot apply of Xray config failed, restarting:", err)
+		return false, "hot apply failed: " + err.Error()
+	}
+	if p != proc || !s.IsXrayRunning() {
+		return false, "xray process changed during hot apply"
+	}
+	if err := s.saveRunningConfig(proc, xrayConfig); err != nil {
+		logger.Warning("Unable to save hot-applied Xray config:", err)
+	}
+	setApplyResult(XrayApplyHot, "", diff.String())
+	return true, ""
+}
+
+// applyConfigDiff 中文注释: 通过 handler API 应用入站和用户的变化。入站先删除再添加，用户先删除再添加，
+// 因此已通过 API 提前应用过的变化可以重复执行。任一步失败时返回错误，由调用方重启 Xray。
+func (s *XrayService) applyConfigDiff(diff *xray.ConfigDiff) error {
+	apiPort := s.GetApiPort()
+	if apiPort <= 0 {
+		apiPort = xray.GetApiPortFromConfig()
+	}
+	api := &xray.XrayAPI{}
+	if err := api.Init(apiPort); err != nil {
+		return err
+	}
+	defer api.Close()
+
+	for _, tag := range diff.RemovedInbounds {
+		if err := api.DelInbound(tag); err != nil {
+			logger.Debug("Inbound already removed:", tag, err)
+		}
+	}
+	for _, inbound := range slices.Concat(diff.UpdatedInbounds, diff.AddedInbounds) {
+		if err := api.DelInbound(inbound.Tag); err == nil {
+			logger.Debug("Old inbound deleted by api:", inbound.Tag)
+		}
+		inboundJson, err := json.MarshalIndent(inbound, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err = api.AddInbound(inboundJson); err != nil {
+			return fmt.Errorf("add inbound %s: %w", inbound.Tag, err)
+		}
+	}
+	for _, change := range diff.Users {
+		for _, email := range change.Removed {
+			if err := api.RemoveUser(change.Tag, email); err != nil && !strings.Contains(err.Error(), "not found") {
+				return fmt.Errorf("remove user %s from %s: %w", email, change.Tag, err)
+			}
+		}
+		for _, user := range change.Added {
+			email := user["email"].(string)
+			// 中文注释: 用户可能已通过 API 添加过，先删除以便按新的配置重新添加
+			api.RemoveUser(change.Tag, email)
+			if err := api.AddUser(change.Protocol, change.Tag, user); err != nil {
+				return fmt.Errorf("add user %s to %s: %w", email, change.Tag, err)
+			}
+		}
+	}
+	return nil
+}
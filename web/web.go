@@ -389,12 +389,22 @@ func (s *Server) startTask() {
 		s.cron.AddJob("@every 10s", job.NewXrayTrafficJob())
 	}()
 
+	// 中文注释: 检测一次可用的 IP 限制防火墙，并清理切换执行方式前留下的表和规则
+	ipFirewallService := service.IpFirewallService{}
+	ipFirewallService.InitBackend()
+
 	// check client ips from log file every 10 sec
 	s.cron.AddJob("@every 10s", job.NewCheckClientIpJob())
 
+	// Switch client speed levels at speed schedule boundaries, at the start of every minute
+	s.cron.AddJob("0 * * * * *", job.NewSpeedScheduleJob())
+
 	// check client ips from log file every day
 	s.cron.AddJob("@daily", job.NewClearLogsJob())
 
+	// Remove expired traffic history every hour
+	s.cron.AddJob("@hourly", job.NewTrafficHistoryJob())
+
 	// Make a traffic condition every day, 8:30
 	var entry cron.EntryID
 	isTgbotenabled, err := s.settingService.GetTgbotEnabled()
@@ -414,6 +424,25 @@ func (s *Server) startTask() {
 		// check for Telegram bot callback query hash storage reset
 		s.cron.AddJob("@every 2m", job.NewCheckHashStorageJob())
 
+		// Send usage and expiry alerts to clients every minute
+		s.cron.AddJob("@every 1m", job.NewUsageAlertJob())
+		s.cron.AddJob("@daily", job.NewUsageAlertCleanupJob())
+
+		// Send usage report of the last period, shortly after the period ends
+		reportPeriod, err := s.settingService.GetTgReportPeriod()
+		if err == nil && reportPeriod != "" {
+			reportRuntime := map[string]string{
+				service.ReportPeriodDaily:   "0 10 0 * * *",
+				service.ReportPeriodWeekly:  "0 10 0 * * 1",
+				service.ReportPeriodMonthly: "0 10 0 1 * *",
+			}[reportPeriod]
+			if reportRuntime == "" {
+				logger.Warning("Invalid usage report period:", reportPeriod)
+			} else if _, err := s.cron.AddJob(reportRuntime, job.NewUsageReportJob()); err != nil {
+				logger.Warning("Add NewUsageReportJob error", err)
+			}
+		}
+
 		// Check CPU load and alarm to TgBot if threshold passes
 		cpuThreshold, err := s.settingService.GetTgCpu()
 		if (err == nil) && (cpuThreshold > 0) {
@@ -541,6 +570,13 @@ func (s *Server) Stop() error {
 	if s.cron != nil {
 		s.cron.Stop()
 	}
+	// 中文注释: 默认在面板退出时解除内置防火墙的封禁，开启保留封禁时留给下次启动继续使用
+	if keepBans, err := s.settingService.GetIpLimitKeepBans(); err != nil || !keepBans {
+		ipFirewallService := service.IpFirewallService{}
+		if err := ipFirewallService.Cleanup(); err != nil {
+			logger.Warning("Clean up IP limit firewall failed:", err)
+		}
+	}
 	if s.tgbotService.IsRunning() {
 		s.tgbotService.Stop()
 	}
@@ -289,6 +289,8 @@ uninstall() {
     fi
     service_stop
     service_disable
+    # 删除内置 IP 限制防火墙的表和规则
+    /usr/local/x-ui/x-ui firewall-cleanup >/dev/null 2>&1
     if [[ "${release}" == "alpine" ]]; then
         rm /etc/init.d/x-ui -f
     else
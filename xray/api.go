@@ -12,6 +12,7 @@ import (
 	"x-ui/util/common"
 
 	"github.com/xtls/xray-core/app/proxyman/command"
+	routerService "github.com/xtls/xray-core/app/router/command"
 	statsService "github.com/xtls/xray-core/app/stats/command"
 	"github.com/xtls/xray-core/common/protocol"
 	"github.com/xtls/xray-core/common/serial"
@@ -22,12 +23,18 @@ import (
 	"github.com/xtls/xray-core/proxy/vless"
 	"github.com/xtls/xray-core/proxy/vmess"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
+// ErrOnlineIpsUnsupported 中文注释: 旧版本 Xray 没有在线 IP 统计接口，调用方需要改为解析 access.log
+var ErrOnlineIpsUnsupported = common.NewError("xray online IP stats are not supported")
+
 type XrayAPI struct {
 	HandlerServiceClient *command.HandlerServiceClient
 	StatsServiceClient   *statsService.StatsServiceClient
+	RoutingServiceClient *routerService.RoutingServiceClient
 	grpcClient           *grpc.ClientConn
 	isConnected          bool
 }
@@ -48,9 +55,11 @@ func (x *XrayAPI) Init(apiPort int) error {
 
 	hsClient := command.NewHandlerServiceClient(conn)
 	ssClient := statsService.NewStatsServiceClient(conn)
+	rsClient := routerService.NewRoutingServiceClient(conn)
 
 	x.HandlerServiceClient = &hsClient
 	x.StatsServiceClient = &ssClient
+	x.RoutingServiceClient = &rsClient
 
 	return nil
 }
@@ -61,6 +70,7 @@ func (x *XrayAPI) Close() {
 	}
 	x.HandlerServiceClient = nil
 	x.StatsServiceClient = nil
+	x.RoutingServiceClient = nil
 	x.isConnected = false
 }
 
@@ -136,7 +146,8 @@ func (x *XrayAPI) AddUser(Protocol string, inboundTag string, user map[string]an
 			})
 		}
 	default:
-		return nil
+		// 中文注释: 不支持按用户增删的协议(wireguard/socks/http)返回错误，由调用方重新加载入站或重启 Xray
+		return common.NewError("unsupported protocol for api user management:", Protocol)
 	}
 
 	// 〔中文注释〕: (修改点) 创建一个有5秒超时限制的上下文（Context）。
@@ -148,10 +159,20 @@ func (x *XrayAPI) AddUser(Protocol string, inboundTag string, user map[string]an
 
 	client := *x.HandlerServiceClient
 
+	// 中文注释: level 对应 policy 中的限速等级，未提供时为 level 0
+	var level uint32
+	switch v := user["level"].(type) {
+	case int:
+		level = uint32(v)
+	case float64:
+		level = uint32(v)
+	}
+
 	_, err := client.AlterInbound(ctx, &command.AlterInboundRequest{ // 〔中文注释〕: (修改点) 使用上面创建的带超时的 ctx
 		Tag: inboundTag,
 		Operation: serial.ToTypedMessage(&command.AddUserOperation{
 			User: &protocol.User{
+				Level:   level,
 				Email:   user["email"].(string),
 				Account: account,
 			},
@@ -185,6 +206,40 @@ func (x *XrayAPI) RemoveUser(inboundTag, email string) error {
 	return nil
 }
 
+// AddRoutingRule 中文注释: 通过 RoutingService 在现有路由规则之后追加一条规则，
+// rule 为 Xray 配置中 routing.rules 的单条规则 JSON，需要带 ruleTag 以便之后删除。
+func (x *XrayAPI) AddRoutingRule(rule []byte) error {
+	routerConfig := &conf.RouterConfig{RuleList: []json.RawMessage{rule}}
+	config, err := routerConfig.Build()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = (*x.RoutingServiceClient).AddRule(ctx, &routerService.AddRuleRequest{
+		Config:       serial.ToTypedMessage(config),
+		ShouldAppend: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add routing rule: %w", err)
+	}
+	return nil
+}
+
+// RemoveRoutingRule 中文注释: 删除指定 ruleTag 的路由规则，规则不存在时不报错。
+func (x *XrayAPI) RemoveRoutingRule(ruleTag string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := (*x.RoutingServiceClient).RemoveRule(ctx, &routerService.RemoveRuleRequest{RuleTag: ruleTag})
+	if err != nil {
+		return fmt.Errorf("failed to remove routing rule: %w", err)
+	}
+	return nil
+}
+
 func (x *XrayAPI) GetTraffic(reset bool) ([]*Traffic, []*ClientTraffic, error) {
 	if x.grpcClient == nil {
 		return nil, nil, common.NewError("xray api is not initialized")
@@ -219,6 +274,36 @@ func (x *XrayAPI) GetTraffic(reset bool) ([]*Traffic, []*ClientTraffic, error) {
 	return mapToSlice(tagTrafficMap), mapToSlice(emailTrafficMap), nil
 }
 
+// GetOnlineIps 中文注释: 通过 statsUserOnline 统计查询用户当前在线的 IP 及最后连接时间，用户不在线时返回空。
+// Xray 不支持此接口时返回 ErrOnlineIpsUnsupported。
+func (x *XrayAPI) GetOnlineIps(email string) (map[string]time.Time, error) {
+	if x.StatsServiceClient == nil {
+		return nil, common.NewError("xray StatusServiceClient is not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	resp, err := (*x.StatsServiceClient).GetStatsOnlineIpList(ctx, &statsService.GetStatsRequest{
+		Name: "user>>>" + email + ">>>online",
+	})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.NotFound:
+			return map[string]time.Time{}, nil
+		case codes.Unimplemented:
+			return nil, ErrOnlineIpsUnsupported
+		}
+		return nil, err
+	}
+
+	ips := make(map[string]time.Time, len(resp.GetIps()))
+	for ip, lastSeen := range resp.GetIps() {
+		ips[ip] = time.Unix(lastSeen, 0)
+	}
+	return ips, nil
+}
+
 func processTraffic(matches []string, value int64, trafficMap map[string]*Traffic) {
 	isInbound := matches[1] == "inbound"
 	tag := matches[2]
@@ -12,4 +12,13 @@ type ClientTraffic struct {
 	Total      int64  `json:"total" form:"total"`
 	Reset      int    `json:"reset" form:"reset" gorm:"default:0"`
 	LastOnline int64  `json:"lastOnline" form:"lastOnline" gorm:"default:0"`
+
+	// 中文注释: Up/Down 为按入站计费规则折算后的流量，RawUp/RawDown 为原始流量
+	RawUp   int64 `json:"rawUp" form:"rawUp" gorm:"default:0"`
+	RawDown int64 `json:"rawDown" form:"rawDown" gorm:"default:0"`
+
+	// 中文注释: 按日历重置流量的计划(同 Client.ResetSchedule)，以及上次(含手动和续订清零)和下次重置的毫秒时间戳
+	ResetSchedule string `json:"resetSchedule" form:"resetSchedule"`
+	LastReset     int64  `json:"lastReset" form:"lastReset" gorm:"default:0"`
+	NextReset     int64  `json:"nextReset" form:"nextReset" gorm:"default:0;index"`
 }
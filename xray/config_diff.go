@@ -0,0 +1,239 @@
+package xray
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// userProtocols 中文注释: 支持通过 handler API 逐个增删用户的协议，其他协议的用户变化需要重新添加入站
+var userProtocols = map[string]bool{
+	"vmess":       true,
+	"vless":       true,
+	"trojan":      true,
+	"shadowsocks": true,
+}
+
+// UserChange 中文注释: 一个入站中需要删除和添加的用户，修改过的用户先删除再添加，因此同时出现在两个列表中
+type UserChange struct {
+	Tag      string
+	Protocol string
+	Removed  []string
+	Added    []map[string]any
+}
+
+// ConfigDiff 中文注释: 新旧配置的差异。RestartSections 记录无法通过 API 热更新的部分(如 routing、dns、policy)，
+// 非空时只能重启 Xray；否则按入站和用户的变化通过 handler API 增量应用。
+type ConfigDiff struct {
+	RestartSections []string
+	RemovedInbounds []string
+	// UpdatedInbounds 中文注释: 端口、传输、嗅探或用户以外的设置发生变化的入站，需要删除后重新添加
+	UpdatedInbounds []InboundConfig
+	AddedInbounds   []InboundConfig
+	Users           []UserChange
+}
+
+// IsEmpty 中文注释: 新旧配置等价，不需要任何操作
+func (d *ConfigDiff) IsEmpty() bool {
+	return len(d.RestartSections) == 0 && len(d.RemovedInbounds) == 0 && len(d.UpdatedInbounds) == 0 &&
+		len(d.AddedInbounds) == 0 && len(d.Users) == 0
+}
+
+// NeedRestart 中文注释: 存在无法热更新的变化
+func (d *ConfigDiff) NeedRestart() bool {
+	return len(d.RestartSections) > 0
+}
+
+// String 中文注释: 差异摘要，用于日志和应用结果
+func (d *ConfigDiff) String() string {
+	if d.NeedRestart() {
+		return "changed: " + strings.Join(d.RestartSections, ", ")
+	}
+	removedUsers, addedUsers := 0, 0
+	for _, change := range d.Users {
+		removedUsers += len(change.Removed)
+		addedUsers += len(change.Added)
+	}
+	return fmt.Sprintf("inbounds -%d ~%d +%d, users -%d +%d",
+		len(d.RemovedInbounds), len(d.UpdatedInbounds), len(d.AddedInbounds), removedUsers, addedUsers)
+}
+
+// DiffConfig 中文注释: 按入站 tag 和用户 email 比较新旧配置。JSON 按语义比较，因此从配置文件读回的旧配置
+// 与新生成的配置格式不同也不会被当作变化。
+func DiffConfig(oldConfig, newConfig *Config) *ConfigDiff {
+	diff := &ConfigDiff{}
+	sections := []struct {
+		name     string
+		old, new []byte
+	}{
+		{"log", oldConfig.LogConfig, newConfig.LogConfig},
+		{"routing", oldConfig.RouterConfig, newConfig.RouterConfig},
+		{"dns", oldConfig.DNSConfig, newConfig.DNSConfig},
+		{"outbounds", oldConfig.OutboundConfigs, newConfig.OutboundConfigs},
+		{"transport", oldConfig.Transport, newConfig.Transport},
+		{"policy", oldConfig.Policy, newConfig.Policy},
+		{"api", oldConfig.API, newConfig.API},
+		{"stats", oldConfig.Stats, newConfig.Stats},
+		{"reverse", oldConfig.Reverse, newConfig.Reverse},
+		{"fakedns", oldConfig.FakeDNS, newConfig.FakeDNS},
+		{"observatory", oldConfig.Observatory, newConfig.Observatory},
+		{"burstObservatory", oldConfig.BurstObservatory, newConfig.BurstObservatory},
+		{"metrics", oldConfig.Metrics, newConfig.Metrics},
+	}
+	for _, section := range sections {
+		if !jsonEqual(section.old, section.new) {
+			diff.RestartSections = append(diff.RestartSections, section.name)
+		}
+	}
+
+	oldInbounds := make(map[string]*InboundConfig, len(oldConfig.InboundConfigs))
+	for i := range oldConfig.InboundConfigs {
+		oldInbounds[oldConfig.InboundConfigs[i].Tag] = &oldConfig.InboundConfigs[i]
+	}
+	newTags := make(map[string]bool, len(newConfig.InboundConfigs))
+	for i := range newConfig.InboundConfigs {
+		inbound := newConfig.InboundConfigs[i]
+		newTags[inbound.Tag] = true
+		old, ok := oldInbounds[inbound.Tag]
+		switch {
+		case inbound.Tag == "":
+			// 中文注释: 没有 tag 的入站无法通过 API 删除
+			if !ok || !inboundEqual(old, &inbound) {
+				diff.RestartSections = append(diff.RestartSections, "inbound without tag")
+			}
+		case !ok:
+			diff.AddedInbounds = append(diff.AddedInbounds, inbound)
+		case inboundEqual(old, &inbound):
+		case inbound.Tag == "api":
+			// 中文注释: 面板通过 api 入站调用 Xray，不能通过 API 删除它
+			diff.RestartSections = append(diff.RestartSections, "api inbound")
+		default:
+			if change, ok := diffUsers(old, &inbound); ok {
+				diff.Users = append(diff.Users, change)
+			} else {
+				diff.UpdatedInbounds = append(diff.UpdatedInbounds, inbound)
+			}
+		}
+	}
+	for _, inbound := range oldConfig.InboundConfigs {
+		if newTags[inbound.Tag] {
+			continue
+		}
+		if inbound.Tag == "" || inbound.Tag == "api" {
+			diff.RestartSections = append(diff.RestartSections, "inbound "+inbound.Tag+" removed")
+			continue
+		}
+		diff.RemovedInbounds = append(diff.RemovedInbounds, inbound.Tag)
+	}
+	return diff
+}
+
+// inboundEqual 中文注释: 按语义比较两个入站
+func inboundEqual(a, b *InboundConfig) bool {
+	return jsonEqual(a.Listen, b.Listen) && a.Port == b.Port && a.Protocol == b.Protocol &&
+		jsonEqual(a.Settings, b.Settings) && jsonEqual(a.StreamSettings, b.StreamSettings) &&
+		a.Tag == b.Tag && jsonEqual(a.Sniffing, b.Sniffing)
+}
+
+// diffUsers 中文注释: 入站只有用户变化时返回需要删除和添加的用户；入站本身也有变化、协议不支持按用户增删
+// 或存在无法按 email 区分的用户时返回 false，需要重新添加整个入站。
+func diffUsers(old, new *InboundConfig) (UserChange, bool) {
+	change := UserChange{Tag: new.Tag, Protocol: new.Protocol}
+	if !userProtocols[new.Protocol] || old.Protocol != new.Protocol || old.Port != new.Port ||
+		!jsonEqual(old.Listen, new.Listen) || !jsonEqual(old.StreamSettings, new.StreamSettings) ||
+		!jsonEqual(old.Sniffing, new.Sniffing) {
+		return change, false
+	}
+	var oldSettings, newSettings map[string]any
+	if json.Unmarshal(old.Settings, &oldSettings) != nil || json.Unmarshal(new.Settings, &newSettings) != nil {
+		return change, false
+	}
+	oldClients, ok := clientsByEmail(oldSettings["clients"])
+	if !ok {
+		return change, false
+	}
+	newClients, ok := clientsByEmail(newSettings["clients"])
+	if !ok {
+		return change, false
+	}
+	delete(oldSettings, "clients")
+	delete(newSettings, "clients")
+	if !reflect.DeepEqual(oldSettings, newSettings) {
+		return change, false
+	}
+
+	for email, client := range oldClients {
+		if newClient, ok := newClients[email]; !ok || !reflect.DeepEqual(client, newClient) {
+			change.Removed = append(change.Removed, email)
+		}
+	}
+	for email, client := range newClients {
+		if oldClient, ok := oldClients[email]; !ok || !reflect.DeepEqual(client, oldClient) {
+			change.Added = append(change.Added, apiUser(newSettings, client))
+		}
+	}
+	sort.Strings(change.Removed)
+	sort.Slice(change.Added, func(i, j int) bool {
+		return change.Added[i]["email"].(string) < change.Added[j]["email"].(string)
+	})
+	return change, true
+}
+
+// clientsByEmail 中文注释: 按 email 索引用户，有用户缺少 email 或 email 重复时返回 false
+func clientsByEmail(raw any) (map[string]map[string]any, bool) {
+	list, _ := raw.([]any)
+	clients := make(map[string]map[string]any, len(list))
+	for _, item := range list {
+		client, ok := item.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		email, _ := client["email"].(string)
+		if email == "" {
+			return nil, false
+		}
+		if _, exists := clients[email]; exists {
+			return nil, false
+		}
+		clients[email] = client
+	}
+	return clients, true
+}
+
+// apiUser 中文注释: 转换为 XrayAPI.AddUser 需要的字段，缺少的字段补为空值
+func apiUser(settings map[string]any, client map[string]any) map[string]any {
+	text := func(key string) string {
+		value, _ := client[key].(string)
+		return value
+	}
+	cipher := text("method")
+	if cipher == "" {
+		cipher, _ = settings["method"].(string)
+	}
+	return map[string]any{
+		"email":    text("email"),
+		"id":       text("id"),
+		"flow":     text("flow"),
+		"password": text("password"),
+		"cipher":   cipher,
+		"level":    client["level"],
+	}
+}
+
+// jsonEqual 中文注释: 按语义比较两段 JSON，空值与 null 视为相同
+func jsonEqual(a, b []byte) bool {
+	var va, vb any
+	if len(a) > 0 {
+		if err := json.Unmarshal(a, &va); err != nil {
+			return string(a) == string(b)
+		}
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &vb); err != nil {
+			return false
+		}
+	}
+	return reflect.DeepEqual(va, vb)
+}
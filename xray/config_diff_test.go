@@ -0,0 +1,160 @@
+package xray
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testInbound(tag string, port int, settings string) InboundConfig {
+	return InboundConfig{
+		Listen:   []byte(`null`),
+		Port:     port,
+		Protocol: "vless",
+		Settings: []byte(settings),
+		Tag:      tag,
+	}
+}
+
+func testConfig() *Config {
+	return &Config{
+		LogConfig:       []byte(`{"loglevel":"warning"}`),
+		RouterConfig:    []byte(`{"rules":[]}`),
+		DNSConfig:       []byte(`null`),
+		OutboundConfigs: []byte(`[{"protocol":"freedom"}]`),
+		Policy:          []byte(`{"levels":{"0":{}}}`),
+		API:             []byte(`{"tag":"api"}`),
+		Stats:           []byte(`{}`),
+		InboundConfigs: []InboundConfig{
+			testInbound("api", 62789, `{"address":"127.0.0.1"}`),
+			testInbound("in-1", 443, `{"clients":[{"email":"a","id":"1"}],"decryption":"none"}`),
+		},
+	}
+}
+
+func TestDiffConfigRestartSections(t *testing.T) {
+	tests := []struct {
+		section string
+		change  func(c *Config)
+	}{
+		{"log", func(c *Config) { c.LogConfig = []byte(`{"loglevel":"debug"}`) }},
+		{"routing", func(c *Config) { c.RouterConfig = []byte(`{"rules":[{"outboundTag":"direct"}]}`) }},
+		{"dns", func(c *Config) { c.DNSConfig = []byte(`{"servers":["1.1.1.1"]}`) }},
+		{"outbounds", func(c *Config) { c.OutboundConfigs = []byte(`[{"protocol":"blackhole"}]`) }},
+		{"transport", func(c *Config) { c.Transport = []byte(`{"tcpSettings":{}}`) }},
+		{"policy", func(c *Config) { c.Policy = []byte(`{"levels":{"0":{},"512":{}}}`) }},
+		{"api", func(c *Config) { c.API = []byte(`{"tag":"api","services":["StatsService"]}`) }},
+		{"stats", func(c *Config) { c.Stats = nil }},
+		{"reverse", func(c *Config) { c.Reverse = []byte(`{"bridges":[]}`) }},
+		{"fakedns", func(c *Config) { c.FakeDNS = []byte(`[{"ipPool":"198.18.0.0/15"}]`) }},
+		{"observatory", func(c *Config) { c.Observatory = []byte(`{"subjectSelector":["out"]}`) }},
+		{"burstObservatory", func(c *Config) { c.BurstObservatory = []byte(`{"subjectSelector":["out"]}`) }},
+		{"metrics", func(c *Config) { c.Metrics = []byte(`{"tag":"metrics"}`) }},
+		{"api inbound", func(c *Config) { c.InboundConfigs[0].Port = 62790 }},
+		{"inbound api removed", func(c *Config) { c.InboundConfigs = c.InboundConfigs[1:] }},
+		{"inbound without tag", func(c *Config) {
+			c.InboundConfigs = append(c.InboundConfigs, testInbound("", 8443, `{"clients":[]}`))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.section, func(t *testing.T) {
+			newConfig := testConfig()
+			tt.change(newConfig)
+			diff := DiffConfig(testConfig(), newConfig)
+			if !diff.NeedRestart() || !reflect.DeepEqual(diff.RestartSections, []string{tt.section}) {
+				t.Errorf("RestartSections = %v; want [%s]", diff.RestartSections, tt.section)
+			}
+		})
+	}
+}
+
+func TestDiffConfigHotApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		want    string
+		inspect func(t *testing.T, diff *ConfigDiff)
+	}{
+		{
+			name:   "same config with different formatting",
+			change: func(c *Config) { c.LogConfig = []byte(`{ "loglevel" : "warning" }`) },
+			want:   "inbounds -0 ~0 +0, users -0 +0",
+			inspect: func(t *testing.T, diff *ConfigDiff) {
+				if !diff.IsEmpty() {
+					t.Errorf("diff = %+v; want empty", diff)
+				}
+			},
+		},
+		{
+			name: "user added",
+			change: func(c *Config) {
+				c.InboundConfigs[1].Settings = []byte(`{"clients":[{"email":"a","id":"1"},{"email":"b","id":"2","level":512}],"decryption":"none"}`)
+			},
+			want: "inbounds -0 ~0 +0, users -0 +1",
+			inspect: func(t *testing.T, diff *ConfigDiff) {
+				added := diff.Users[0].Added[0]
+				if diff.Users[0].Tag != "in-1" || added["email"] != "b" || added["id"] != "2" || added["level"] != float64(512) {
+					t.Errorf("Users = %+v", diff.Users)
+				}
+			},
+		},
+		{
+			name: "user changed is removed and added",
+			change: func(c *Config) {
+				c.InboundConfigs[1].Settings = []byte(`{"clients":[{"email":"a","id":"1","level":256}],"decryption":"none"}`)
+			},
+			want: "inbounds -0 ~0 +0, users -1 +1",
+		},
+		{
+			name:   "user removed",
+			change: func(c *Config) { c.InboundConfigs[1].Settings = []byte(`{"clients":[],"decryption":"none"}`) },
+			want:   "inbounds -0 ~0 +0, users -1 +0",
+		},
+		{
+			name: "inbound settings besides users changed",
+			change: func(c *Config) {
+				c.InboundConfigs[1].Settings = []byte(`{"clients":[{"email":"a","id":"1"}],"decryption":"mlkem"}`)
+			},
+			want: "inbounds -0 ~1 +0, users -0 +0",
+		},
+		{
+			name:   "inbound port changed",
+			change: func(c *Config) { c.InboundConfigs[1].Port = 8443 },
+			want:   "inbounds -0 ~1 +0, users -0 +0",
+		},
+		{
+			name: "inbound protocol changed",
+			change: func(c *Config) {
+				c.InboundConfigs[1].Protocol = "socks"
+			},
+			want: "inbounds -0 ~1 +0, users -0 +0",
+		},
+		{
+			name: "inbound added",
+			change: func(c *Config) {
+				c.InboundConfigs = append(c.InboundConfigs, testInbound("in-2", 8443, `{"clients":[]}`))
+			},
+			want: "inbounds -0 ~0 +1, users -0 +0",
+		},
+		{
+			name:   "inbound removed",
+			change: func(c *Config) { c.InboundConfigs = c.InboundConfigs[:1] },
+			want:   "inbounds -1 ~0 +0, users -0 +0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newConfig := testConfig()
+			tt.change(newConfig)
+			diff := DiffConfig(testConfig(), newConfig)
+			if diff.NeedRestart() {
+				t.Fatalf("RestartSections = %v; want none", diff.RestartSections)
+			}
+			if got := diff.String(); got != tt.want {
+				t.Errorf("diff = %q; want %q", got, tt.want)
+			}
+			if tt.inspect != nil {
+				tt.inspect(t, diff)
+			}
+		})
+	}
+}
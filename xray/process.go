@@ -86,6 +86,32 @@ func GetApiPortFromConfig() int {
 	return 0
 }
 
+// WriteConfig 中文注释: 将配置写入 Xray 的配置文件
+func WriteConfig(xrayConfig *Config) error {
+	data, err := json.MarshalIndent(xrayConfig, "", "  ")
+	if err != nil {
+		return common.NewErrorf("Failed to generate XRAY configuration files: %v", err)
+	}
+	err = os.WriteFile(GetConfigPath(), data, fs.ModePerm)
+	if err != nil {
+		return common.NewErrorf("Failed to write configuration file: %v", err)
+	}
+	return nil
+}
+
+// ReadConfig 中文注释: 读取配置文件中的配置，接管外部启动的 Xray 时以它作为运行中的配置
+func ReadConfig() (*Config, error) {
+	data, err := os.ReadFile(GetConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	xrayConfig := &Config{}
+	if err = json.Unmarshal(data, xrayConfig); err != nil {
+		return nil, err
+	}
+	return xrayConfig, nil
+}
+
 func GetAccessPersistentLogPath() string {
 	return config.GetLogFolder() + "/3xipl-ap.log"
 }
@@ -188,10 +214,21 @@ func (p *Process) GetAPIPort() int {
 	return p.apiPort
 }
 
-func (p *Process) GetConfig() *Config {
+// GetConfig 中文注释: 返回进程当前使用的配置，热更新会在其他 goroutine 中替换它，因此需要加锁读取
+func (p *process) GetConfig() *Config {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
 	return p.config
 }
 
+// UpdateConfig 中文注释: 通过 API 热更新后记录运行中的配置并写回配置文件，下次比较以它为准
+func (p *Process) UpdateConfig(xrayConfig *Config) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.config = xrayConfig
+	return WriteConfig(xrayConfig)
+}
+
 func (p *Process) GetOnlineClients() []string {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
@@ -211,7 +248,7 @@ func (p *Process) GetUptime() uint64 {
 }
 
 func (p *process) refreshAPIPort() {
-	for _, inbound := range p.config.InboundConfigs {
+	for _, inbound := range p.GetConfig().InboundConfigs {
 		if inbound.Tag == "api" {
 			p.apiPort = inbound.Port
 			break
@@ -246,22 +283,17 @@ func (p *process) Start() (err error) {
 		}
 	}()
 
-	data, err := json.MarshalIndent(p.config, "", "  ")
-	if err != nil {
-		return common.NewErrorf("Failed to generate XRAY configuration files: %v", err)
-	}
-
 	err = os.MkdirAll(config.GetLogFolder(), 0o770)
 	if err != nil {
 		logger.Warningf("Failed to create log folder: %s", err)
 	}
 
-	configPath := GetConfigPath()
-	err = os.WriteFile(configPath, data, fs.ModePerm)
+	err = WriteConfig(p.GetConfig())
 	if err != nil {
-		return common.NewErrorf("Failed to write configuration file: %v", err)
+		return err
 	}
 
+	configPath := GetConfigPath()
 	cmd := exec.Command(GetBinaryPath(), "-c", configPath)
 	p.cmd = cmd
 